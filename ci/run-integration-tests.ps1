@@ -8,8 +8,16 @@ param (
 
 $ExamplesDir = "dd"
 $TestableDirs = (
+    "onpremise/common",
+    "onpremise/common/updatetest",
+    "onpremise/memory_profile",
+    "onpremise/offline_processing",
+    "onpremise/rest_service",
     "uach", 
-    "web"
+    "web",
+    "web/clienthintstest",
+    "web/metrics",
+    "web/middleware"
 )
 
 $DarkRed = 31
@@ -0,0 +1,138 @@
+/* *********************************************************************
+ * This Original Work is copyright of 51 Degrees Mobile Experts Limited.
+ * Copyright 2019 51 Degrees Mobile Experts Limited, 5 Charlotte Close,
+ * Caversham, Reading, Berkshire, United Kingdom RG4 7BY.
+ *
+ * This Original Work is licensed under the European Union Public Licence (EUPL)
+ * v.1.2 and is subject to its terms as set out below.
+ *
+ * If a copy of the EUPL was not distributed with this file, You can obtain
+ * one at https://opensource.org/licenses/EUPL-1.2.
+ *
+ * The 'Compatible Licences' set out in the Appendix to the EUPL (as may be
+ * amended by the European Commission) shall be deemed incompatible for
+ * the purposes of the Work and the provisions of the compatibility
+ * clause in Article 5 of the EUPL shall not apply.
+ *
+ * If using the Work as, or as part of, a network application, by
+ * including the attribution notice(s) required under Article 5 of the EUPL
+ * in the end user terms of the application under an appropriate heading,
+ * such notice(s) shall fulfill the requirements of that article.
+ * ********************************************************************* */
+
+package dd_example
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/51Degrees/device-detection-examples-go/v4/onpremise/common"
+	"github.com/51Degrees/device-detection-go/v4/dd"
+)
+
+// BenchmarkData is the input of the detection benchmarks, read once and
+// reused for every performance profile.
+type BenchmarkData struct {
+	// User-Agent of each Evidence Record which has one
+	UserAgents []string
+	// Evidence of each Evidence Record
+	Evidence []*dd.Evidence
+}
+
+// ReadBenchmarkData reads the User-Agents and evidence used by the detection
+// benchmarks from an Evidence Records file. The data must be freed once the
+// benchmarks are complete.
+func ReadBenchmarkData(evidenceFilePath string) (*BenchmarkData, error) {
+	records, err := common.ReadAllEvidence(evidenceFilePath)
+	if err != nil {
+		return nil, err
+	}
+
+	data := &BenchmarkData{
+		UserAgents: make([]string, 0, len(records)),
+		Evidence:   make([]*dd.Evidence, 0, len(records)),
+	}
+	for _, record := range records {
+		evidence := dd.NewEvidenceHash(uint32(len(record)))
+		for _, e := range record {
+			if e.Prefix == dd.HttpHeaderString &&
+				strings.EqualFold(e.Key, "User-Agent") {
+				data.UserAgents = append(data.UserAgents, e.Value)
+			}
+			evidence.Add(e.Prefix, e.Key, e.Value)
+		}
+		data.Evidence = append(data.Evidence, evidence)
+	}
+	if len(data.UserAgents) == 0 {
+		data.Free()
+		return nil, fmt.Errorf(
+			"no User-Agents found in \"%s\"", evidenceFilePath)
+	}
+	return data, nil
+}
+
+// Free frees the evidence.
+func (data *BenchmarkData) Free() {
+	for _, evidence := range data.Evidence {
+		evidence.Free()
+	}
+	data.Evidence = nil
+}
+
+// NewBenchmarkManager creates a resource manager for the performance profile
+// which is configured the same way for every profile, so that only the
+// profile differs between benchmarks. The manager must be freed.
+func NewBenchmarkManager(
+	perf dd.PerformanceProfile,
+	dataFilePath string) (*dd.ResourceManager, error) {
+	manager := dd.NewResourceManager()
+	config := dd.NewConfigHash(perf)
+	config.SetUseUpperPrefixHeaders(false)
+	config.SetUpdateMatchedUserAgent(false)
+	if err := dd.InitManagerFromFile(
+		manager,
+		*config,
+		"",
+		dataFilePath); err != nil {
+		manager.Free()
+		return nil, fmt.Errorf(
+			"failed to initialise %s manager: %w",
+			PerformanceProfileName(perf), err)
+	}
+	return manager, nil
+}
+
+// DetectUserAgents performs n detections on a single User-Agent, cycling
+// through the User-Agents.
+func DetectUserAgents(
+	manager *dd.ResourceManager,
+	userAgents []string,
+	n int) error {
+	for i := 0; i < n; i++ {
+		results := dd.NewResultsHash(manager, 1, 0)
+		err := results.MatchUserAgent(userAgents[i%len(userAgents)])
+		results.Free()
+		if err != nil {
+			return fmt.Errorf("failed to perform detection: %w", err)
+		}
+	}
+	return nil
+}
+
+// DetectEvidence performs n detections on all the evidence of an Evidence
+// Record, cycling through the records.
+func DetectEvidence(
+	manager *dd.ResourceManager,
+	evidence []*dd.Evidence,
+	n int) error {
+	for i := 0; i < n; i++ {
+		e := evidence[i%len(evidence)]
+		results := dd.NewResultsHash(manager, uint32(e.Count()), 0)
+		err := results.MatchEvidence(e)
+		results.Free()
+		if err != nil {
+			return fmt.Errorf("failed to perform detection: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,237 @@
+/* *********************************************************************
+ * This Original Work is copyright of 51 Degrees Mobile Experts Limited.
+ * Copyright 2019 51 Degrees Mobile Experts Limited, 5 Charlotte Close,
+ * Caversham, Reading, Berkshire, United Kingdom RG4 7BY.
+ *
+ * This Original Work is licensed under the European Union Public Licence (EUPL)
+ * v.1.2 and is subject to its terms as set out below.
+ *
+ * If a copy of the EUPL was not distributed with this file, You can obtain
+ * one at https://opensource.org/licenses/EUPL-1.2.
+ *
+ * The 'Compatible Licences' set out in the Appendix to the EUPL (as may be
+ * amended by the European Commission) shall be deemed incompatible for
+ * the purposes of the Work and the provisions of the compatibility
+ * clause in Article 5 of the EUPL shall not apply.
+ *
+ * If using the Work as, or as part of, a network application, by
+ * including the attribution notice(s) required under Article 5 of the EUPL
+ * in the end user terms of the application under an appropriate heading,
+ * such notice(s) shall fulfill the requirements of that article.
+ * ********************************************************************* */
+
+package main
+
+/*
+This example compares the performance profiles of the Hash engine so that a
+profile can be chosen with data. Each profile is benchmarked on a single
+User-Agent and on all the evidence of an Evidence Record, in a separate
+process so that the memory footprint of one profile does not affect another.
+
+To run this example, perform the following command from the `dd/benchmark`
+directory:
+```
+go run benchmark.go -d ../../51Degrees-LiteV4.1.hash -e "../../20000 Evidence Records.yml"
+```
+A table similar to the following is printed:
+```
+Profile          Detection   ns/op   Detections/s  B/op  allocs/op  Memory (MB)
+Default          User-Agent  2914    343171        48    2          62.4
+Default          Evidence    4207    237700        48    2          62.4
+LowMemory        User-Agent  7731    129349        48    2          9.8
+...
+```
+Memory is the peak resident memory of the process after loading the data file
+and performing the benchmarks, less the memory used before loading. It is only
+available on Linux. Each benchmark runs for one second by default, which can
+be changed with `-test.benchtime`, e.g. `-test.benchtime 5s`.
+*/
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"runtime"
+	"testing"
+	"text/tabwriter"
+
+	dd_example "github.com/51Degrees/device-detection-examples-go/v4/dd"
+	"github.com/51Degrees/device-detection-examples-go/v4/onpremise/common"
+	"github.com/51Degrees/device-detection-go/v4/dd"
+)
+
+// Result of a benchmark of a performance profile
+type result struct {
+	Profile             string  `json:"profile"`
+	Detection           string  `json:"detection"`
+	NsPerOp             int64   `json:"nsPerOp"`
+	DetectionsPerSecond float64 `json:"detectionsPerSecond"`
+	BytesPerOp          int64   `json:"bytesPerOp"`
+	AllocsPerOp         int64   `json:"allocsPerOp"`
+	// Memory footprint in bytes, or -1 if it could not be measured
+	MemoryBytes int64 `json:"memoryBytes"`
+}
+
+// benchmarkDetections returns a benchmark timing b.N detections performed by
+// detect.
+func benchmarkDetections(detect func(n int) error) func(b *testing.B) {
+	return func(b *testing.B) {
+		b.ReportAllocs()
+		b.ResetTimer()
+		if err := detect(b.N); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// benchmarkProfile runs the benchmarks of a single performance profile.
+func benchmarkProfile(
+	perf dd.PerformanceProfile,
+	options dd_example.Options) ([]result, error) {
+	dataFilePath, err := dd_example.FindFilePathByPath(options.DataFilePath)
+	if err != nil {
+		return nil, err
+	}
+	evidenceFilePath, err := dd_example.FindFilePathByPath(options.EvidenceFilePath)
+	if err != nil {
+		return nil, err
+	}
+	data, err := dd_example.ReadBenchmarkData(evidenceFilePath)
+	if err != nil {
+		return nil, err
+	}
+	defer data.Free()
+
+	runtime.GC()
+	baseline := common.ReadProcessMemory().RSS
+	manager, err := dd_example.NewBenchmarkManager(perf, dataFilePath)
+	if err != nil {
+		return nil, err
+	}
+	defer manager.Free()
+
+	benchmarks := []struct {
+		detection string
+		fn        func(b *testing.B)
+	}{
+		{"User-Agent", benchmarkDetections(func(n int) error {
+			return dd_example.DetectUserAgents(manager, data.UserAgents, n)
+		})},
+		{"Evidence", benchmarkDetections(func(n int) error {
+			return dd_example.DetectEvidence(manager, data.Evidence, n)
+		})},
+	}
+	results := make([]result, 0, len(benchmarks))
+	for _, benchmark := range benchmarks {
+		r := testing.Benchmark(benchmark.fn)
+		if r.N == 0 {
+			return nil, fmt.Errorf("%s benchmark failed", benchmark.detection)
+		}
+		res := result{
+			Profile:     dd_example.PerformanceProfileName(perf),
+			Detection:   benchmark.detection,
+			NsPerOp:     r.NsPerOp(),
+			BytesPerOp:  r.AllocedBytesPerOp(),
+			AllocsPerOp: r.AllocsPerOp(),
+		}
+		if res.NsPerOp > 0 {
+			res.DetectionsPerSecond = 1e9 / float64(res.NsPerOp)
+		}
+		results = append(results, res)
+	}
+
+	// Peak memory includes any cache growth during the benchmarks
+	memory := int64(-1)
+	if peak := common.ReadProcessMemory().PeakRSS; peak >= 0 && baseline >= 0 {
+		memory = peak - baseline
+	}
+	for i := range results {
+		results[i].MemoryBytes = memory
+	}
+	return results, nil
+}
+
+// runProfile runs this example in a new process for a single performance
+// profile and returns the results it writes.
+func runProfile(perf dd.PerformanceProfile) ([]result, error) {
+	exe, err := os.Executable()
+	if err != nil {
+		return nil, err
+	}
+	args := append(os.Args[1:], "-profile", dd_example.PerformanceProfileName(perf))
+	cmd := exec.Command(exe, args...)
+	cmd.Stderr = os.Stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("%s profile failed: %w",
+			dd_example.PerformanceProfileName(perf), err)
+	}
+	var results []result
+	if err := json.NewDecoder(bytes.NewReader(out)).Decode(&results); err != nil {
+		return nil, fmt.Errorf("invalid output from %s profile: %w",
+			dd_example.PerformanceProfileName(perf), err)
+	}
+	return results, nil
+}
+
+// printTable prints the results as a table.
+func printTable(results []result) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "Profile\tDetection\tns/op\tDetections/s\tB/op\tallocs/op\tMemory (MB)")
+	for _, r := range results {
+		memory := "n/a"
+		if r.MemoryBytes >= 0 {
+			memory = fmt.Sprintf("%.1f", float64(r.MemoryBytes)/(1<<20))
+		}
+		fmt.Fprintf(w, "%s\t%s\t%d\t%.0f\t%d\t%d\t%s\n",
+			r.Profile,
+			r.Detection,
+			r.NsPerOp,
+			r.DetectionsPerSecond,
+			r.BytesPerOp,
+			r.AllocsPerOp,
+			memory)
+	}
+	w.Flush()
+}
+
+func main() {
+	// Register the testing flags so that -test.benchtime can be used
+	testing.Init()
+	profileName := flag.String("profile", "",
+		"Benchmark a single performance profile and output the results as JSON")
+	options := dd_example.ParseOptions()
+
+	// Benchmark a single profile when run by the parent process
+	if *profileName != "" {
+		perf, err := dd_example.ParsePerformanceProfile(*profileName)
+		if err != nil {
+			log.Fatalf("ERROR: %v\n", err)
+		}
+		results, err := benchmarkProfile(perf, options)
+		if err != nil {
+			log.Fatalf("ERROR: Failed to benchmark %s profile. %v\n",
+				*profileName, err)
+		}
+		if err := json.NewEncoder(os.Stdout).Encode(results); err != nil {
+			log.Fatalf("ERROR: Failed to write results. %v\n", err)
+		}
+		return
+	}
+
+	all := make([]result, 0, 2*len(dd_example.PerformanceProfiles))
+	for _, perf := range dd_example.PerformanceProfiles {
+		fmt.Fprintf(os.Stderr, "Benchmarking %s profile...\n",
+			dd_example.PerformanceProfileName(perf))
+		results, err := runProfile(perf)
+		if err != nil {
+			log.Fatalf("ERROR: %v\n", err)
+		}
+		all = append(all, results...)
+	}
+	printTable(all)
+}
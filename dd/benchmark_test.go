@@ -0,0 +1,105 @@
+/* *********************************************************************
+ * This Original Work is copyright of 51 Degrees Mobile Experts Limited.
+ * Copyright 2019 51 Degrees Mobile Experts Limited, 5 Charlotte Close,
+ * Caversham, Reading, Berkshire, United Kingdom RG4 7BY.
+ *
+ * This Original Work is licensed under the European Union Public Licence (EUPL)
+ * v.1.2 and is subject to its terms as set out below.
+ *
+ * If a copy of the EUPL was not distributed with this file, You can obtain
+ * one at https://opensource.org/licenses/EUPL-1.2.
+ *
+ * The 'Compatible Licences' set out in the Appendix to the EUPL (as may be
+ * amended by the European Commission) shall be deemed incompatible for
+ * the purposes of the Work and the provisions of the compatibility
+ * clause in Article 5 of the EUPL shall not apply.
+ *
+ * If using the Work as, or as part of, a network application, by
+ * including the attribution notice(s) required under Article 5 of the EUPL
+ * in the end user terms of the application under an appropriate heading,
+ * such notice(s) shall fulfill the requirements of that article.
+ * ********************************************************************* */
+
+package dd_example
+
+/*
+Benchmarks of detection with each performance profile, on a single User-Agent
+and on all the evidence of an Evidence Record. To run the benchmarks, perform
+the following command from the `dd` directory:
+```
+go test -run ^$ -bench . -benchmem
+```
+Use `dd/benchmark` to render the results as a table which includes the memory
+footprint of each profile.
+*/
+
+import (
+	"testing"
+
+	"github.com/51Degrees/device-detection-go/v4/dd"
+)
+
+// readTestBenchmarkData finds the data file and reads the benchmark data, or
+// skips the benchmark if either file is not available.
+func readTestBenchmarkData(b *testing.B) (string, *BenchmarkData) {
+	dataFilePath, err := FindFilePathByName([]string{LiteDataFile})
+	if err != nil {
+		b.Skipf("Data file is not available. %v", err)
+	}
+	evidenceFilePath, err := FindFilePathByName([]string{EvidenceFileYaml})
+	if err != nil {
+		b.Skipf("Evidence file is not available. %v", err)
+	}
+	data, err := ReadBenchmarkData(evidenceFilePath)
+	if err != nil {
+		b.Skipf("Evidence file could not be read. %v", err)
+	}
+	return dataFilePath, data
+}
+
+// benchmarkDetections times b.N detections performed by detect.
+func benchmarkDetections(b *testing.B, detect func(n int) error) {
+	b.ReportAllocs()
+	b.ResetTimer()
+	if err := detect(b.N); err != nil {
+		b.Fatal(err)
+	}
+}
+
+// benchmarkProfiles runs the benchmark function with a manager for each
+// performance profile.
+func benchmarkProfiles(
+	b *testing.B,
+	fn func(b *testing.B, manager *dd.ResourceManager, data *BenchmarkData)) {
+	dataFilePath, data := readTestBenchmarkData(b)
+	defer data.Free()
+
+	for _, perf := range PerformanceProfiles {
+		b.Run(PerformanceProfileName(perf), func(b *testing.B) {
+			manager, err := NewBenchmarkManager(perf, dataFilePath)
+			if err != nil {
+				b.Skipf("%v", err)
+			}
+			defer manager.Free()
+			fn(b, manager, data)
+		})
+	}
+}
+
+func BenchmarkUserAgent(b *testing.B) {
+	benchmarkProfiles(b,
+		func(b *testing.B, manager *dd.ResourceManager, data *BenchmarkData) {
+			benchmarkDetections(b, func(n int) error {
+				return DetectUserAgents(manager, data.UserAgents, n)
+			})
+		})
+}
+
+func BenchmarkFullEvidence(b *testing.B) {
+	benchmarkProfiles(b,
+		func(b *testing.B, manager *dd.ResourceManager, data *BenchmarkData) {
+			benchmarkDetections(b, func(n int) error {
+				return DetectEvidence(manager, data.Evidence, n)
+			})
+		})
+}
@@ -31,14 +31,13 @@ import (
 	"bufio"
 	"flag"
 	"fmt"
-	"io"
 	"log"
 	"os"
 	"path/filepath"
 	"strings"
 
+	"github.com/51Degrees/device-detection-examples-go/v4/onpremise/common"
 	"github.com/51Degrees/device-detection-go/v4/dd"
-	"gopkg.in/yaml.v3"
 )
 
 // Constants
@@ -81,34 +80,91 @@ func ExtractEvidence(strEvidence []stringEvidence) *dd.Evidence {
 	return evidence
 }
 
+// All performance profiles supported by the Hash engine
+var PerformanceProfiles = []dd.PerformanceProfile{
+	dd.Default,
+	dd.LowMemory,
+	dd.Balanced,
+	dd.BalancedTemp,
+	dd.HighPerformance,
+	dd.InMemory,
+}
+
+// PerformanceProfileName returns the name of a performance profile.
+func PerformanceProfileName(p dd.PerformanceProfile) string {
+	switch p {
+	case dd.LowMemory:
+		return "LowMemory"
+	case dd.Balanced:
+		return "Balanced"
+	case dd.BalancedTemp:
+		return "BalancedTemp"
+	case dd.HighPerformance:
+		return "HighPerformance"
+	case dd.InMemory:
+		return "InMemory"
+	default:
+		return "Default"
+	}
+}
+
+// ParsePerformanceProfile returns the performance profile with the name,
+// ignoring case.
+func ParsePerformanceProfile(name string) (dd.PerformanceProfile, error) {
+	for _, p := range PerformanceProfiles {
+		if strings.EqualFold(name, PerformanceProfileName(p)) {
+			return p, nil
+		}
+	}
+	return dd.Default, fmt.Errorf("unknown performance profile '%s'", name)
+}
+
 // Type take a performance profile, run the code and get the return output
 type ExampleFunc func(p dd.PerformanceProfile) string
 type ExampleOptFunc func(p dd.PerformanceProfile, o Options) string
 
-// Returns a full path to a file to be used for examples by file name
-func GetFilePathByName(names []string) string {
+// FindFilePathByName returns a full path to a file to be used for examples by
+// file name. A common.FileNotFoundError is returned if no file matches.
+func FindFilePathByName(names []string) (string, error) {
 	filePath, err := dd.GetFilePath(
 		"..",
 		names,
 	)
 	if err != nil {
-		log.Fatalf("Could not find any file that matches any of \"%s\".\n",
-			strings.Join(names, ", "))
+		return "", &common.FileNotFoundError{Dir: "..", Names: names}
+	}
+	return filePath, nil
+}
+
+// Returns a full path to a file to be used for examples by file name
+func GetFilePathByName(names []string) string {
+	filePath, err := FindFilePathByName(names)
+	if err != nil {
+		log.Fatalf("ERROR: %v\n", err)
 	}
 	return filePath
 }
 
-// Returns a full path to a file to be used for examples by path to a file
-func GetFilePathByPath(path string) string {
+// FindFilePathByPath returns a full path to a file to be used for examples by
+// path to a file. A common.FileNotFoundError is returned if the file does not
+// exist.
+func FindFilePathByPath(path string) (string, error) {
 	dir, file := filepath.Split(path)
 	filePath, err := dd.GetFilePath(
 		dir,
 		[]string{file},
 	)
 	if err != nil {
-		log.Fatalf("Could not find any file that matches \"%s\" at path \"%s\".\n",
-			file,
-			dir)
+		return "", &common.FileNotFoundError{Dir: dir, Names: []string{file}}
+	}
+	return filePath, nil
+}
+
+// Returns a full path to a file to be used for examples by path to a file
+func GetFilePathByPath(path string) string {
+	filePath, err := FindFilePathByPath(path)
+	if err != nil {
+		log.Fatalf("ERROR: %v\n", err)
 	}
 	return filePath
 }
@@ -124,65 +180,56 @@ func isFlagOn(value string) bool {
 	return false
 }
 
-// Count the number of User-Agents in a User-Agents file and return the number
-// of user agents found.
-func CountUAFromFiles(
-	uaFilePath string) uint64 {
-	var count uint64 = 0
-	// Count the number of User Agents
+// CountUA counts the number of User-Agents in a User-Agents file.
+func CountUA(uaFilePath string) (count uint64, err error) {
 	f, err := os.OpenFile(uaFilePath, os.O_RDONLY, 0444)
 	if err != nil {
-		log.Fatalf("ERROR: Failed to open file \"%s\".\n", uaFilePath)
+		return 0, common.NewFileNotFoundError(uaFilePath, err)
 	}
 	defer func() {
-		if err := f.Close(); err != nil {
-			log.Fatalf("ERROR: Failed to close file \"%s\".\n", uaFilePath)
-		}
-	}()
-
-	// Count the number of UA.
-	s := bufio.NewScanner(f)
-	defer func() {
-		if err := s.Err(); err != nil {
-			log.Fatalf("ERROR: Error during scanning file\"%s\".\n", uaFilePath)
+		if cerr := f.Close(); cerr != nil && err == nil {
+			err = cerr
 		}
 	}()
 
 	// Count the User-Agents
+	s := bufio.NewScanner(f)
 	for s.Scan() {
 		count++
 	}
+	if err := s.Err(); err != nil {
+		return 0, &common.DecodeError{
+			Path: uaFilePath, Record: int(count) + 1, Err: err}
+	}
+	return count, nil
+}
+
+// Count the number of User-Agents in a User-Agents file and return the number
+// of user agents found.
+func CountUAFromFiles(
+	uaFilePath string) uint64 {
+	count, err := CountUA(uaFilePath)
+	if err != nil {
+		log.Fatalf("ERROR: Failed to count User-Agents. %v\n", err)
+	}
 	return count
 }
 
+// CountEvidence counts the number of Evidence Records in a Evidence Records
+// file.
+func CountEvidence(evidenceFilePath string) (uint64, error) {
+	return common.CountEvidence(evidenceFilePath)
+}
+
 // Count the number of Evidence Records in a Evidence Records file and return the number
 // of evidence found.
 func CountEvidenceFromFiles(
 	evidenceFilePath string) uint64 {
-	var count uint64 = 0
-	// Count the number of Evidence Records
-	f, err := os.OpenFile(evidenceFilePath, os.O_RDONLY, 0444)
-	if err != nil {
-		log.Fatalf("ERROR: Failed to open file \"%s\".\n", evidenceFilePath)
-	}
-	defer func() {
-		if err := f.Close(); err != nil {
-			log.Fatalf("ERROR: Failed to close file \"%s\".\n", evidenceFilePath)
-		}
-	}()
-
-	dec := yaml.NewDecoder(f)
 	// Count the Evidence Records
-	for {
-		// Decode Evidence file by line
-		var doc interface{}
-		if err := dec.Decode(&doc); err == io.EOF {
-			break
-		} else if err != nil {
-			// Make sure there is no decoder error
-			log.Fatalf("ERROR: Failed during decoding file \"%s\". %v\n", evidenceFilePath, err)
-		}
-		count++
+	count, err := CountEvidence(evidenceFilePath)
+	if err != nil {
+		// Make sure there is no decoder error
+		log.Fatalf("ERROR: Failed during decoding file \"%s\". %v\n", evidenceFilePath, err)
 	}
 	return count
 }
@@ -194,14 +241,7 @@ func PerformExample(perf dd.PerformanceProfile, eFunc ExampleFunc) {
 	perfs := []dd.PerformanceProfile{perf}
 	// If running under ci, use all performance profiles
 	if isFlagOn("ci") {
-		perfs = []dd.PerformanceProfile{
-			dd.Default,
-			dd.LowMemory,
-			dd.Balanced,
-			dd.BalancedTemp,
-			dd.HighPerformance,
-			dd.InMemory,
-		}
+		perfs = PerformanceProfiles
 	}
 
 	// Execute the example function with all performance profiles
@@ -227,14 +267,7 @@ func PerformExampleOptions(perf dd.PerformanceProfile, eFunc ExampleOptFunc) {
 	perfs := []dd.PerformanceProfile{perf}
 	// If running under ci, use all performance profiles
 	if isFlagOn("ci") {
-		perfs = []dd.PerformanceProfile{
-			dd.Default,
-			dd.LowMemory,
-			dd.Balanced,
-			dd.BalancedTemp,
-			dd.HighPerformance,
-			dd.InMemory,
-		}
+		perfs = PerformanceProfiles
 	}
 
 	// Execute the example function with all performance profiles
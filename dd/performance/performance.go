@@ -47,19 +47,17 @@ Number of CPUs: 2
 import ( //	"runtime"
 	"bufio"
 	"fmt"
-	"io"
 	"log"
 	_ "net/http/pprof"
 	"os"
 	"path/filepath"
 	"runtime"
-	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
 
 	dd_example "github.com/51Degrees/device-detection-examples-go/v4/dd"
-	"gopkg.in/yaml.v3"
+	"github.com/51Degrees/device-detection-examples-go/v4/onpremise/common"
 
 	"github.com/51Degrees/device-detection-go/v4/dd"
 )
@@ -95,16 +93,14 @@ func matchEvidenceRecord(
 		log.Fatal("ERROR: Failed to perform detection.")
 	}
 
-	// Get the value in string
-	res, err := results.ValuesString(
-		"IsMobile",
-		",")
+	// Get the typed value
+	isMobile, _, err := dd_example.NewTypedResults(results).IsMobile()
 	if err != nil {
 		log.Fatalln(err)
 	}
 
 	// Update report
-	if strings.Compare("True", res) == 0 {
+	if isMobile {
 		atomic.AddUint64(&rep.evidenceIsMobile, 1)
 	}
 
@@ -124,7 +120,7 @@ func performDetections(
 	evidenceFilePath := dd_example.GetFilePathByPath(options.EvidenceFilePath)
 
 	// Read and extract Evidence for the performance check
-	evidenceSlice := readYAMLFile(evidenceFilePath)
+	evidenceSlice := readEvidenceFile(evidenceFilePath)
 	defer func() {
 		// Free up evidence after test completion
 		for _, evidence := range evidenceSlice {
@@ -153,35 +149,19 @@ func performDetections(
 
 // Open, read, decode and extract Evidence to be used in the performance test.
 // Data can be reused for multiple iterations.
-func readYAMLFile(evidenceFilePath string) []*dd.Evidence {
-	// Open YAML file
-	file, err := os.OpenFile(evidenceFilePath, os.O_RDONLY, 0444)
+func readEvidenceFile(evidenceFilePath string) []*dd.Evidence {
+	records, err := common.ReadAllEvidence(evidenceFilePath)
 	if err != nil {
-		log.Fatalf("ERROR: Failed to open file \"%s\".\n", evidenceFilePath)
+		log.Fatalf("ERROR: Failed to read file \"%s\". %v\n", evidenceFilePath, err)
 	}
-	defer func() {
-		// Make sure the file is closed properly
-		if err := file.Close(); err != nil {
-			log.Fatalf("ERROR: Failed to close file \"%s\".\n", evidenceFilePath)
-		}
-	}()
 
-	// Decode YAML file
-	var res []*dd.Evidence
-	dec := yaml.NewDecoder(file)
-	for {
-		// Decode Evidence file by line
-		var doc map[string]string
-		if err := dec.Decode(&doc); err == io.EOF {
-			break
-		} else if err != nil {
-			// Make sure there is no decoder error
-			log.Fatalf("ERROR: Failed during decoding file \"%s\". %v\n", evidenceFilePath, err)
+	// Prepare evidence for usage
+	res := make([]*dd.Evidence, 0, len(records))
+	for _, record := range records {
+		evidence := dd.NewEvidenceHash(uint32(len(record)))
+		for _, e := range record {
+			evidence.Add(e.Prefix, e.Key, e.Value)
 		}
-		// Prepare evidence for usage
-		filteredEvidence := dd_example.ConvertEvidenceMap(doc)
-		evidence := dd_example.ExtractEvidence(filteredEvidence)
-
 		res = append(res, evidence)
 	}
 	return res
@@ -23,12 +23,308 @@
 package main
 
 /*
-TODO: To be implemented
+Illustrates how a data set held in memory, for example after being downloaded
+from object storage, can be reloaded while detections are performed.
+
+The data file is read into a byte buffer which is then used to reload the
+running resource manager a number of times while detections continue on other
+goroutines. The results of each detection are hashed and combined for each
+iteration over the Evidence Records. At the end all iterations must have the
+same hash value, and no detection must have failed, for the swap to be
+verified as zero-downtime.
+
+NOTE: ResourceManager.ReloadFromMemory is not yet implemented by the
+device-detection-go package, so the buffer is staged in a temporary file and
+the manager is reloaded from it. Unless the InMemory profile is used the
+manager continues to read the file, so each staged file is kept until the
+manager has been reloaded again or freed.
+
+To run this example, perform the following command:
+```
+go run reload_from_memory.go
+```
 */
 
-// import "fmt"
-// import "github.com/51Degrees/device-detection-go/ddonpremise"
+import (
+	"hash/fnv"
+	"log"
+	"os"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	dd_example "github.com/51Degrees/device-detection-examples-go/v4/dd"
+	"github.com/51Degrees/device-detection-examples-go/v4/onpremise/common"
+
+	"github.com/51Degrees/device-detection-go/v4/dd"
+	"github.com/51Degrees/device-detection-go/v4/onpremise"
+)
+
+// Number of iterations to perform over the Evidence Records.
+const mIterationCount = 4
+
+// Time to wait between reloads
+const reloadInterval = 200 * time.Millisecond
+
+// Report struct for reload from memory run
+type mreport struct {
+	mu                sync.Mutex // Mutex
+	evidenceCount     uint64
+	hashCodes         [mIterationCount]uint32
+	evidenceProcessed uint64
+	detectionErrors   uint64
+	reloads           int
+	reloadFails       int
+}
+
+// updateHashCode updates the hash code with the input code ad the index
+// specified. The update use XOR operation. This function is thread safe to
+// make sure multiple threads can update the hash code correctly
+func (rep *mreport) updateHashCode(code uint32, i uint32) {
+	rep.mu.Lock()
+	rep.hashCodes[i] ^= code
+	rep.mu.Unlock()
+}
+
+// generateHash generate 32bit hash code for an input string
+func generateHash(str string) uint32 {
+	h := fnv.New32()
+	h.Write([]byte(str))
+	return h.Sum32()
+}
+
+// detect performs a detection on the evidence and returns the values of all
+// available properties.
+func detect(
+	manager *dd.ResourceManager,
+	record []onpremise.Evidence) ([]string, error) {
+	evidence := dd.NewEvidenceHash(uint32(len(record)))
+	defer evidence.Free()
+	for _, e := range record {
+		evidence.Add(e.Prefix, e.Key, e.Value)
+	}
+
+	// Create results
+	results := dd.NewResultsHash(manager, uint32(evidence.Count()), 0)
+
+	// Make sure results object is freed after function execution.
+	defer results.Free()
+
+	// Perform detection
+	if err := results.MatchEvidence(evidence); err != nil {
+		return nil, err
+	}
+
+	// Loop through all properties
+	properties := results.AvailableProperties()
+	values := make([]string, len(properties))
+	for i, property := range properties {
+		// Get the value in string
+		value, err := results.ValuesString(
+			property,
+			",")
+		if err != nil {
+			return nil, err
+		}
+		values[i] = value
+	}
+	return values, nil
+}
+
+func executeTest(
+	wg *sync.WaitGroup,
+	manager *dd.ResourceManager,
+	record []onpremise.Evidence,
+	rep *mreport,
+	iteration uint32) {
+	// Complete and mark as done
+	defer wg.Done()
+
+	// Detection errors are counted rather than terminating so that all
+	// failures during reloads are reported.
+	values, err := detect(manager, record)
+	if err != nil {
+		atomic.AddUint64(&rep.detectionErrors, 1)
+	} else {
+		for _, value := range values {
+			rep.updateHashCode(generateHash(value), iteration)
+		}
+	}
+
+	// Increase the number of Evidence Records processed
+	atomic.AddUint64(&rep.evidenceProcessed, 1)
+}
+
+// performDetectionIterations performs detection on each Evidence Record for a
+// number of iterations.
+func performDetectionIterations(
+	manager *dd.ResourceManager,
+	records [][]onpremise.Evidence,
+	wg *sync.WaitGroup,
+	rep *mreport) {
+	for i := 0; i < mIterationCount; i++ {
+		for _, record := range records {
+			// Increase wait group
+			wg.Add(1)
+			go executeTest(
+				wg,
+				manager,
+				record,
+				rep,
+				uint32(i))
+		}
+	}
+	wg.Done()
+}
+
+// reloadFromMemory reloads the manager from a data file held in memory and
+// returns the path of the file in dir the data was staged in. The file must
+// not be removed until the manager has been reloaded again or freed.
+func reloadFromMemory(
+	manager *dd.ResourceManager,
+	data []byte,
+	dir string) (string, error) {
+	// Stage the data in a temporary file as ReloadFromMemory is not yet
+	// implemented by the device detection package.
+	f, err := os.CreateTemp(dir, "51Degrees-*.hash")
+	if err != nil {
+		return "", err
+	}
+	_, err = f.Write(data)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = manager.ReloadFromFile(f.Name())
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+	return f.Name(), nil
+}
+
+func runReloadFromMemorySub(
+	manager *dd.ResourceManager,
+	data []byte,
+	dir string,
+	evidenceFilePath string) string {
+	// Create a wait group for iteration function
+	var wg sync.WaitGroup
+
+	// Read the Evidence Records once so they can be used for all iterations
+	records, err := common.ReadAllEvidence(evidenceFilePath)
+	if err != nil {
+		log.Fatalf("ERROR: Failed to read file \"%s\". %v\n", evidenceFilePath, err)
+	}
+	var rep mreport
+	rep.evidenceCount = uint64(len(records)) * mIterationCount
+
+	// Perform detections
+	wg.Add(1)
+	go performDetectionIterations(manager, records, &wg, &rep)
+
+	// Perform reload from memory until all Evidence Records have been
+	// processed. At least one reload is performed.
+	var staged string
+	for {
+		if path, err := reloadFromMemory(manager, data, dir); err == nil {
+			// The manager no longer uses the previously staged file
+			if staged != "" {
+				os.Remove(staged)
+			}
+			staged = path
+			rep.reloads++
+		} else {
+			log.Printf("Failed to reload. %v\n", err)
+			rep.reloadFails++
+		}
+		if atomic.LoadUint64(&rep.evidenceProcessed) >= rep.evidenceCount {
+			break
+		}
+		time.Sleep(reloadInterval)
+	}
+
+	// Wait until all goroutines finish
+	wg.Wait()
+
+	// Construct report
+	log.Printf("Reloaded '%d' times.\n", rep.reloads)
+	log.Printf("Failed to reload '%d' times.\n", rep.reloadFails)
+	log.Printf("Detection errors '%d'.\n", rep.detectionErrors)
+	if rep.detectionErrors > 0 {
+		log.Fatalf("'%d' detections failed while reloading. This indicates "+
+			"that the swap was not zero-downtime.", rep.detectionErrors)
+	}
+	var initHashCode uint32
+	for i := 0; i < mIterationCount; i++ {
+		if i == 0 {
+			initHashCode = rep.hashCodes[i]
+		} else if initHashCode != rep.hashCodes[i] {
+			log.Fatalf("Hash codes do not match. Initial hash code is '%d', "+
+				"but iteration '%d' has hash code '%d'. This indicates not "+
+				"all Evidence Records have been processed correctly for each "+
+				"iteration.", initHashCode, i, rep.hashCodes[i])
+		}
+		log.Printf("Hashcode '%d' for iteration '%d'.\n",
+			rep.hashCodes[i], i)
+	}
+	return "Program execution complete."
+}
+
+func runReloadFromMemory(perf dd.PerformanceProfile) string {
+	dataFilePath := dd_example.GetFilePathByName([]string{dd_example.LiteDataFile})
+	evidenceFilePath := dd_example.GetFilePathByName([]string{dd_example.EvidenceFileYaml})
+
+	// Read the data file into memory as if it had been downloaded
+	data, err := os.ReadFile(dataFilePath)
+	if err != nil {
+		log.Fatalf("ERROR: Failed to read file \"%s\". %v\n", dataFilePath, err)
+	}
+
+	// Create a directory for the staged data files which is removed once the
+	// manager has been freed
+	dir, err := os.MkdirTemp("", "51Degrees-")
+	if err != nil {
+		log.Fatalln(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// Create Resource Manager
+	manager := dd.NewResourceManager()
+	config := dd.NewConfigHash(perf)
+	config.SetConcurrency(uint16(runtime.NumCPU()))
+	config.SetUseUpperPrefixHeaders(false)
+	config.SetUpdateMatchedUserAgent(false)
+	err = dd.InitManagerFromFile(
+		manager,
+		*config,
+		"IsMobile,BrowserName,DeviceType",
+		dataFilePath)
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	// Make sure manager object will be freed after the function execution
+	defer manager.Free()
+
+	// Run the reload tests
+	return runReloadFromMemorySub(manager, data, dir, evidenceFilePath)
+}
 
 func main() {
-	// TODO: To be implemented
+	dd_example.PerformExample(dd.InMemory, runReloadFromMemory)
+	// The output log of this example is in for the following format:
+	//
+	// 2021/11/10 11:42:05 Reloaded '2' times.
+	// 2021/11/10 11:42:05 Failed to reload '0' times.
+	// 2021/11/10 11:42:05 Detection errors '0'.
+	// 2021/11/10 11:42:05 Hashcode '4217895257' for iteration '0'.
+	// 2021/11/10 11:42:05 Hashcode '4217895257' for iteration '1'.
+	// 2021/11/10 11:42:05 Hashcode '4217895257' for iteration '2'.
+	// 2021/11/10 11:42:05 Hashcode '4217895257' for iteration '3'.
+
+	// Output:
+	// Program execution complete.
 }
@@ -23,12 +23,138 @@
 package main
 
 /*
-TODO: To be implemented
+This example illustrates how to read the values of a detection as Go types
+rather than strings, using the typed accessor over ResultsHash.
+
+Each accessor returns the typed value, whether the property has a matched value
+and an error if the value could not be read or parsed. This means a property
+without a matched value is not mistaken for a parse failure, and there is no
+need to compare strings such as "True".
+
+To run this example, perform the following command:
+```
+go run strongly_typed.go
+```
 */
 
-// import "fmt"
-// import "github.com/51Degrees/device-detection-go/ddonpremise"
+import (
+	"fmt"
+	"log"
+
+	dd_example "github.com/51Degrees/device-detection-examples-go/v4/dd"
+
+	"github.com/51Degrees/device-detection-go/v4/dd"
+)
+
+// function match performs a match on an input User-Agent string and reads
+// the typed values of a number of properties. Returns output string and
+// whether the device is a mobile device.
+func match(
+	results *dd.ResultsHash,
+	ua string) (string, bool) {
+	// Perform detection
+	err := results.MatchUserAgent(ua)
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	typed := dd_example.NewTypedResults(results)
+
+	// Boolean value
+	isMobile, ok, err := typed.IsMobile()
+	if err != nil {
+		log.Fatalln(err)
+	}
+	returnStr := ""
+	if !ok {
+		returnStr += "\tIsMobile does not have a matched value.\n"
+	} else {
+		returnStr += fmt.Sprintf("\tIsMobile: %t\n", isMobile)
+	}
+
+	// String value
+	platformName, ok, err := typed.PlatformName()
+	if err != nil {
+		log.Fatalln(err)
+	}
+	if ok {
+		returnStr += fmt.Sprintf("\tPlatformName: %s\n", platformName)
+	}
+
+	// Version value
+	platformVersion, ok, err := typed.PlatformVersion()
+	if err != nil {
+		log.Fatalln(err)
+	}
+	if ok {
+		returnStr += fmt.Sprintf("\tPlatformVersion: %s\n", platformVersion)
+	}
+
+	// Versions can be compared rather than matched as strings
+	browserVersion, ok, err := typed.BrowserVersion()
+	if err != nil {
+		log.Fatalln(err)
+	}
+	if ok {
+		modern := browserVersion.Compare(dd_example.Version{Major: 40}) >= 0
+		returnStr += fmt.Sprintf("\tBrowserVersion: %s (40 or later: %t)\n",
+			browserVersion, modern)
+	}
+
+	return returnStr, isMobile
+}
+
+func runStronglyTyped(perf dd.PerformanceProfile) string {
+	// Initialise manager
+	manager := dd.NewResourceManager()
+	config := dd.NewConfigHash(perf)
+	filePath := dd_example.GetFilePathByName([]string{dd_example.LiteDataFile})
+
+	err := dd.InitManagerFromFile(
+		manager,
+		*config,
+		"",
+		filePath)
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	// Make sure manager object will be freed after the function execution
+	defer manager.Free()
+
+	// Create results
+	results := dd.NewResultsHash(manager, 1, 0)
+
+	// Make sure results object is freed after function execution.
+	defer results.Free()
+
+	// User-Agent string of an iPhone mobile device.
+	const uaMobile = "Mozilla/5.0 (iPhone; CPU iPhone OS 7_1 like Mac OS X) " +
+		"AppleWebKit/537.51.2 (KHTML, like Gecko) Version/7.0 Mobile/11D167 " +
+		"Safari/9537.53"
+
+	// User-Agent string of Firefox Web browser version 41 on desktop.
+	const uaDesktop = "Mozilla/5.0 (Windows NT 6.3; WOW64; rv:41.0) " +
+		"Gecko/20100101 Firefox/41.0"
+
+	// Perform detection on mobile User-Agent
+	actual := fmt.Sprintf("Mobile User-Agent: %s\n", uaMobile)
+	output, mobileIsMobile := match(results, uaMobile)
+	actual += output
+
+	// Perform detection on desktop User-Agent
+	actual += fmt.Sprintf("\nDesktop User-Agent: %s\n", uaDesktop)
+	output, desktopIsMobile := match(results, uaDesktop)
+	actual += output
+
+	// The typed values can be used directly in conditions
+	if !mobileIsMobile || desktopIsMobile {
+		log.Println(actual)
+		log.Fatalln("IsMobile does not match expected.")
+	}
+	return actual
+}
 
 func main() {
-	// TODO: To be implemented
+	dd_example.PerformExample(dd.Default, runStronglyTyped)
 }
@@ -0,0 +1,185 @@
+/* *********************************************************************
+ * This Original Work is copyright of 51 Degrees Mobile Experts Limited.
+ * Copyright 2019 51 Degrees Mobile Experts Limited, 5 Charlotte Close,
+ * Caversham, Reading, Berkshire, United Kingdom RG4 7BY.
+ *
+ * This Original Work is licensed under the European Union Public Licence (EUPL)
+ * v.1.2 and is subject to its terms as set out below.
+ *
+ * If a copy of the EUPL was not distributed with this file, You can obtain
+ * one at https://opensource.org/licenses/EUPL-1.2.
+ *
+ * The 'Compatible Licences' set out in the Appendix to the EUPL (as may be
+ * amended by the European Commission) shall be deemed incompatible for
+ * the purposes of the Work and the provisions of the compatibility
+ * clause in Article 5 of the EUPL shall not apply.
+ *
+ * If using the Work as, or as part of, a network application, by
+ * including the attribution notice(s) required under Article 5 of the EUPL
+ * in the end user terms of the application under an appropriate heading,
+ * such notice(s) shall fulfill the requirements of that article.
+ * ********************************************************************* */
+
+package dd_example
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/51Degrees/device-detection-go/v4/dd"
+)
+
+// ValueSource is the part of dd.ResultsHash used to read property values.
+type ValueSource interface {
+	HasValues(propertyName string) (bool, error)
+	ValuesString(propertyName string, separator string) (string, error)
+}
+
+// TypedResults provides strongly typed access to the property values of a
+// detection. Each accessor returns false if the property does not have a
+// matched value, and an error if the value could not be read or parsed.
+type TypedResults struct {
+	results ValueSource
+}
+
+// NewTypedResults creates a typed accessor over the results of a detection.
+func NewTypedResults(results ValueSource) *TypedResults {
+	return &TypedResults{results}
+}
+
+// Version is a version number such as "14.4.1". Missing parts are zero.
+type Version struct {
+	Major int
+	Minor int
+	Patch int
+}
+
+// ParseVersion parses a version number of '.' separated numbers such as
+// "124.0.6367.208". Parts after the patch number are ignored.
+func ParseVersion(s string) (Version, error) {
+	var v Version
+	numbers := []*int{&v.Major, &v.Minor, &v.Patch}
+	for i, part := range strings.Split(strings.TrimSpace(s), ".") {
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 {
+			return Version{}, fmt.Errorf("version \"%s\" is not a number", s)
+		}
+		if i < len(numbers) {
+			*numbers[i] = n
+		}
+	}
+	return v, nil
+}
+
+// Compare returns -1, 0 or 1 if the version is less than, equal to or greater
+// than the other version.
+func (v Version) Compare(other Version) int {
+	a := []int{v.Major, v.Minor, v.Patch}
+	b := []int{other.Major, other.Minor, other.Patch}
+	for i := range a {
+		if a[i] < b[i] {
+			return -1
+		} else if a[i] > b[i] {
+			return 1
+		}
+	}
+	return 0
+}
+
+// String returns the version in the "major.minor.patch" format.
+func (v Version) String() string {
+	return fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Patch)
+}
+
+// String returns the value of a property with multiple values joined by ','.
+func (r *TypedResults) String(property string) (string, bool, error) {
+	hasValues, err := r.results.HasValues(property)
+	if err != nil || !hasValues {
+		return "", false, err
+	}
+	value, err := r.results.ValuesString(property, ",")
+	if err != nil {
+		return "", false, err
+	}
+	return value, true, nil
+}
+
+// Bool returns the value of a boolean property.
+func (r *TypedResults) Bool(property string) (bool, bool, error) {
+	value, ok, err := r.String(property)
+	if err != nil || !ok {
+		return false, ok, err
+	}
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, false, fmt.Errorf(
+			"property %s value \"%s\" is not a boolean", property, value)
+	}
+	return b, true, nil
+}
+
+// Int returns the value of an integer property.
+func (r *TypedResults) Int(property string) (int, bool, error) {
+	value, ok, err := r.String(property)
+	if err != nil || !ok {
+		return 0, ok, err
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, false, fmt.Errorf(
+			"property %s value \"%s\" is not an integer", property, value)
+	}
+	return n, true, nil
+}
+
+// Version returns the value of a version property.
+func (r *TypedResults) Version(property string) (Version, bool, error) {
+	value, ok, err := r.String(property)
+	if err != nil || !ok {
+		return Version{}, ok, err
+	}
+	v, err := ParseVersion(value)
+	if err != nil {
+		return Version{}, false, fmt.Errorf("property %s: %w", property, err)
+	}
+	return v, true, nil
+}
+
+// IsMobile returns whether the device is a mobile device.
+func (r *TypedResults) IsMobile() (bool, bool, error) {
+	return r.Bool("IsMobile")
+}
+
+// ScreenPixelsWidth returns the width of the screen in pixels.
+func (r *TypedResults) ScreenPixelsWidth() (int, bool, error) {
+	return r.Int("ScreenPixelsWidth")
+}
+
+// ScreenPixelsHeight returns the height of the screen in pixels.
+func (r *TypedResults) ScreenPixelsHeight() (int, bool, error) {
+	return r.Int("ScreenPixelsHeight")
+}
+
+// PlatformName returns the name of the operating system.
+func (r *TypedResults) PlatformName() (string, bool, error) {
+	return r.String("PlatformName")
+}
+
+// PlatformVersion returns the version of the operating system.
+func (r *TypedResults) PlatformVersion() (Version, bool, error) {
+	return r.Version("PlatformVersion")
+}
+
+// BrowserName returns the name of the browser.
+func (r *TypedResults) BrowserName() (string, bool, error) {
+	return r.String("BrowserName")
+}
+
+// BrowserVersion returns the version of the browser.
+func (r *TypedResults) BrowserVersion() (Version, bool, error) {
+	return r.Version("BrowserVersion")
+}
+
+// Make sure dd.ResultsHash can be used as a value source
+var _ ValueSource = (*dd.ResultsHash)(nil)
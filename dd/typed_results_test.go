@@ -0,0 +1,118 @@
+/* *********************************************************************
+ * This Original Work is copyright of 51 Degrees Mobile Experts Limited.
+ * Copyright 2019 51 Degrees Mobile Experts Limited, 5 Charlotte Close,
+ * Caversham, Reading, Berkshire, United Kingdom RG4 7BY.
+ *
+ * This Original Work is licensed under the European Union Public Licence (EUPL)
+ * v.1.2 and is subject to its terms as set out below.
+ *
+ * If a copy of the EUPL was not distributed with this file, You can obtain
+ * one at https://opensource.org/licenses/EUPL-1.2.
+ *
+ * The 'Compatible Licences' set out in the Appendix to the EUPL (as may be
+ * amended by the European Commission) shall be deemed incompatible for
+ * the purposes of the Work and the provisions of the compatibility
+ * clause in Article 5 of the EUPL shall not apply.
+ *
+ * If using the Work as, or as part of, a network application, by
+ * including the attribution notice(s) required under Article 5 of the EUPL
+ * in the end user terms of the application under an appropriate heading,
+ * such notice(s) shall fulfill the requirements of that article.
+ * ********************************************************************* */
+
+package dd_example
+
+import (
+	"errors"
+	"testing"
+)
+
+// Property values keyed by name. Properties which are not present do not
+// have a matched value.
+type testValues map[string]string
+
+func (v testValues) HasValues(propertyName string) (bool, error) {
+	if propertyName == "Missing" {
+		return false, errors.New("property is not available")
+	}
+	_, ok := v[propertyName]
+	return ok, nil
+}
+
+func (v testValues) ValuesString(propertyName string, separator string) (string, error) {
+	return v[propertyName], nil
+}
+
+// Test if values are parsed to their types.
+func TestTypedResults(t *testing.T) {
+	typed := NewTypedResults(testValues{
+		"IsMobile":          "True",
+		"ScreenPixelsWidth": "1080",
+		"PlatformVersion":   "14.4.1",
+		"BrowserVersion":    "124.0.6367.208",
+	})
+
+	if isMobile, ok, err := typed.IsMobile(); !isMobile || !ok || err != nil {
+		t.Errorf("Expected IsMobile true but got %t, %t, %v", isMobile, ok, err)
+	}
+	if width, ok, err := typed.ScreenPixelsWidth(); width != 1080 || !ok || err != nil {
+		t.Errorf("Expected width 1080 but got %d, %t, %v", width, ok, err)
+	}
+	expected := Version{14, 4, 1}
+	if v, ok, err := typed.PlatformVersion(); v != expected || !ok || err != nil {
+		t.Errorf("Expected version %s but got %s, %t, %v", expected, v, ok, err)
+	}
+	expected = Version{124, 0, 6367}
+	if v, ok, err := typed.BrowserVersion(); v != expected || !ok || err != nil {
+		t.Errorf("Expected version %s but got %s, %t, %v", expected, v, ok, err)
+	}
+}
+
+// Test if no value is distinguished from parse and read errors.
+func TestTypedResultsNoValue(t *testing.T) {
+	typed := NewTypedResults(testValues{
+		"IsMobile":        "Unknown",
+		"PlatformVersion": "Unknown",
+	})
+
+	if _, ok, err := typed.ScreenPixelsWidth(); ok || err != nil {
+		t.Errorf("Expected no value without error but got %t, %v", ok, err)
+	}
+	if _, ok, err := typed.IsMobile(); ok || err == nil {
+		t.Errorf("Expected parse error but got %t, %v", ok, err)
+	}
+	if _, ok, err := typed.PlatformVersion(); ok || err == nil {
+		t.Errorf("Expected parse error but got %t, %v", ok, err)
+	}
+	if _, ok, err := typed.Int("Missing"); ok || err == nil {
+		t.Errorf("Expected read error but got %t, %v", ok, err)
+	}
+}
+
+// Test if versions are compared part by part.
+func TestVersionCompare(t *testing.T) {
+	testData := []struct {
+		a, b     string
+		expected int
+	}{
+		{"14.4.1", "14.4.1", 0},
+		{"14.4", "14.4.0", 0},
+		{"9.0", "10.0", -1},
+		{"14.10", "14.9", 1},
+	}
+
+	for _, data := range testData {
+		a, err := ParseVersion(data.a)
+		if err != nil {
+			t.Fatalf("Failed to parse '%s': %v", data.a, err)
+		}
+		b, err := ParseVersion(data.b)
+		if err != nil {
+			t.Fatalf("Failed to parse '%s': %v", data.b, err)
+		}
+		if c := a.Compare(b); c != data.expected {
+			t.Errorf("Expected '%s' compared to '%s' to be %d but got %d",
+				data.a, data.b, data.expected, c)
+		}
+	}
+}
@@ -4,7 +4,16 @@ go 1.19
 
 require (
 	github.com/51Degrees/device-detection-go/v4 v4.5.9
+	go.opentelemetry.io/otel v1.16.0
+	go.opentelemetry.io/otel/sdk v1.16.0
+	go.opentelemetry.io/otel/trace v1.16.0
 	gopkg.in/yaml.v3 v3.0.1
 )
 
-require github.com/51Degrees/common-go/v4 v4.5.0 // indirect
+require (
+	github.com/51Degrees/common-go/v4 v4.5.0 // indirect
+	github.com/go-logr/logr v1.2.4 // indirect
+	github.com/go-logr/stdr v1.2.2 // indirect
+	go.opentelemetry.io/otel/metric v1.16.0 // indirect
+	golang.org/x/sys v0.8.0 // indirect
+)
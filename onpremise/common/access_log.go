@@ -0,0 +1,296 @@
+/* *********************************************************************
+ * This Original Work is copyright of 51 Degrees Mobile Experts Limited.
+ * Copyright 2019 51 Degrees Mobile Experts Limited, 5 Charlotte Close,
+ * Caversham, Reading, Berkshire, United Kingdom RG4 7BY.
+ *
+ * This Original Work is licensed under the European Union Public Licence (EUPL)
+ * v.1.2 and is subject to its terms as set out below.
+ *
+ * If a copy of the EUPL was not distributed with this file, You can obtain
+ * one at https://opensource.org/licenses/EUPL-1.2.
+ *
+ * The 'Compatible Licences' set out in the Appendix to the EUPL (as may be
+ * amended by the European Commission) shall be deemed incompatible for
+ * the purposes of the Work and the provisions of the compatibility
+ * clause in Article 5 of the EUPL shall not apply.
+ *
+ * If using the Work as, or as part of, a network application, by
+ * including the attribution notice(s) required under Article 5 of the EUPL
+ * in the end user terms of the application under an appropriate heading,
+ * such notice(s) shall fulfill the requirements of that article.
+ * ********************************************************************* */
+
+package common
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/textproto"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/51Degrees/device-detection-go/v4/onpremise"
+)
+
+// CombinedLogPattern matches a line in the combined log format used by
+// Apache and nginx and captures the User-Agent. Fields after the User-Agent,
+// as added by many extended formats, are ignored.
+const CombinedLogPattern = `^\S+ \S+ \S+ \[[^\]]*\] "(?:[^"\\]|\\.)*" \d{3} (?:\d+|-) ` +
+	`"(?:[^"\\]|\\.)*" "(?P<user_agent>(?:[^"\\]|\\.)*)"`
+
+var combinedLogRegexp = regexp.MustCompile(CombinedLogPattern)
+
+// Headers used by device detection which are commonly logged
+var logHeaders = []string{
+	"User-Agent",
+	"Sec-CH-UA",
+	"Sec-CH-UA-Full-Version-List",
+	"Sec-CH-UA-Mobile",
+	"Sec-CH-UA-Model",
+	"Sec-CH-UA-Platform",
+	"Sec-CH-UA-Platform-Version",
+}
+
+// DefaultJSONLogFields maps the JSON fields of headers used by device
+// detection to evidence keys. Fields are named after the nginx variables
+// of the headers, e.g. 'http_user_agent' for the User-Agent.
+var DefaultJSONLogFields = defaultJSONLogFields()
+
+func defaultJSONLogFields() map[string]string {
+	fields := make(map[string]string, len(logHeaders))
+	for _, header := range logHeaders {
+		lower := strings.ToLower(header)
+		fields["http_"+strings.ReplaceAll(lower, "-", "_")] = "header." +
+			textproto.CanonicalMIMEHeaderKey(header)
+	}
+	return fields
+}
+
+// LogParser extracts evidence values keyed by 'prefix.key' from a line of an
+// access log. ok is false if the line is not in the expected format.
+type LogParser interface {
+	Parse(line string) (values map[string]string, ok bool)
+}
+
+// RegexLogParser parses lines with a regular expression. Each named group
+// captures the HTTP header with the name of the group, with underscores
+// replaced by hyphens, e.g. 'sec_ch_ua_platform' captures the
+// Sec-Ch-Ua-Platform header.
+type RegexLogParser struct {
+	re *regexp.Regexp
+	// Evidence key of each group, empty if the group is not named
+	keys []string
+}
+
+// NewRegexLogParser creates a parser for lines which match the pattern. The
+// pattern must have at least one named group.
+func NewRegexLogParser(pattern string) (*RegexLogParser, error) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	return newRegexLogParser(re)
+}
+
+// NewCombinedLogParser creates a parser for the combined log format.
+func NewCombinedLogParser() *RegexLogParser {
+	p, _ := newRegexLogParser(combinedLogRegexp)
+	return p
+}
+
+func newRegexLogParser(re *regexp.Regexp) (*RegexLogParser, error) {
+	keys := make([]string, len(re.SubexpNames()))
+	found := false
+	for i, name := range re.SubexpNames() {
+		if name != "" {
+			keys[i] = "header." +
+				textproto.CanonicalMIMEHeaderKey(strings.ReplaceAll(name, "_", "-"))
+			found = true
+		}
+	}
+	if !found {
+		return nil, fmt.Errorf("pattern '%s' has no named groups to capture headers", re)
+	}
+	return &RegexLogParser{re, keys}, nil
+}
+
+// Parse returns the headers captured from the line. Headers which are empty
+// or logged as '-' are omitted.
+func (p *RegexLogParser) Parse(line string) (map[string]string, bool) {
+	match := p.re.FindStringSubmatch(line)
+	if match == nil {
+		return nil, false
+	}
+	values := make(map[string]string)
+	for i, key := range p.keys {
+		if key == "" {
+			continue
+		}
+		if value := unescapeLogValue(match[i]); value != "" && value != "-" {
+			values[key] = value
+		}
+	}
+	return values, true
+}
+
+// unescapeLogValue reverses the escaping of quoted log fields: '\"' and '\\'
+// as used by Apache, and '\xHH' as used by nginx.
+func unescapeLogValue(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+1 < len(s) {
+			switch s[i+1] {
+			case '"', '\\':
+				b.WriteByte(s[i+1])
+				i++
+				continue
+			case 'x':
+				if i+4 <= len(s) {
+					if c, err := strconv.ParseUint(s[i+2:i+4], 16, 8); err == nil {
+						b.WriteByte(byte(c))
+						i += 3
+						continue
+					}
+				}
+			}
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+// JSONLogParser parses lines which are JSON objects, taking evidence from
+// the mapped fields.
+type JSONLogParser struct {
+	// Evidence key of each field
+	fields map[string]string
+}
+
+// NewJSONLogParser creates a parser which maps the fields of each line to
+// evidence keys in the 'prefix.key' format. Fields of nested objects are
+// named by their path, e.g. 'request.headers.user-agent'.
+func NewJSONLogParser(fields map[string]string) (*JSONLogParser, error) {
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("no JSON fields are mapped to evidence")
+	}
+	for _, key := range fields {
+		if _, _, err := ParseEvidenceKey(key); err != nil {
+			return nil, err
+		}
+	}
+	return &JSONLogParser{fields}, nil
+}
+
+// ParseLogFields parses a mapping of JSON fields to evidence keys in the
+// format 'field=prefix.key,field=prefix.key'.
+func ParseLogFields(s string) (map[string]string, error) {
+	fields := make(map[string]string)
+	for _, mapping := range strings.Split(s, ",") {
+		field, key, found := strings.Cut(strings.TrimSpace(mapping), "=")
+		if !found || field == "" || key == "" {
+			return nil, fmt.Errorf("field mapping '%s' must be in the "+
+				"'field=prefix.key' format", mapping)
+		}
+		fields[field] = key
+	}
+	return fields, nil
+}
+
+// Parse returns the values of the mapped fields in the line. Fields which
+// are missing, are not strings, are empty or are logged as '-' are omitted.
+func (p *JSONLogParser) Parse(line string) (map[string]string, bool) {
+	var doc map[string]interface{}
+	if err := json.Unmarshal([]byte(line), &doc); err != nil {
+		return nil, false
+	}
+	values := make(map[string]string)
+	for field, key := range p.fields {
+		if value, ok := lookupJSONField(doc, field); ok && value != "" && value != "-" {
+			values[key] = value
+		}
+	}
+	return values, true
+}
+
+// lookupJSONField returns the string value of a field. A field name which
+// contains '.' is looked for as is and then as a path through nested objects.
+func lookupJSONField(doc map[string]interface{}, field string) (string, bool) {
+	if value, ok := doc[field]; ok {
+		s, ok := value.(string)
+		return s, ok
+	}
+	for i := 0; i < len(field); i++ {
+		if field[i] != '.' {
+			continue
+		}
+		if nested, ok := doc[field[:i]].(map[string]interface{}); ok {
+			if s, ok := lookupJSONField(nested, field[i+1:]); ok {
+				return s, true
+			}
+		}
+	}
+	return "", false
+}
+
+// LogEvidenceSource reads evidence from an access log with one request per
+// line. Lines which cannot be parsed, or which contain no evidence, are
+// skipped and counted.
+type LogEvidenceSource struct {
+	scanner  *bufio.Scanner
+	parser   LogParser
+	unparsed uint64
+	sourceBase
+}
+
+// OpenLogEvidenceSource opens an access log parsed by the parser.
+func OpenLogEvidenceSource(path string, parser LogParser) (*LogEvidenceSource, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, NewFileNotFoundError(path, err)
+	}
+	return &LogEvidenceSource{
+		newLineScanner(file),
+		parser,
+		0,
+		sourceBase{closer: file, path: path},
+	}, nil
+}
+
+// NewLogEvidenceSource creates a source reading an access log from r, parsed
+// by the parser. Closing the source does not close r.
+func NewLogEvidenceSource(r io.Reader, parser LogParser) *LogEvidenceSource {
+	return &LogEvidenceSource{newLineScanner(r), parser, 0, sourceBase{}}
+}
+
+func (s *LogEvidenceSource) Next() ([]onpremise.Evidence, error) {
+	for s.scanner.Scan() {
+		line := strings.TrimSpace(s.scanner.Text())
+		if line == "" {
+			continue
+		}
+		values, ok := s.parser.Parse(line)
+		if !ok || len(values) == 0 {
+			s.unparsed++
+			continue
+		}
+		return s.parse(values)
+	}
+	if err := s.scanner.Err(); err != nil {
+		s.record++
+		return nil, s.decodeError(err)
+	}
+	return nil, io.EOF
+}
+
+// Unparsed returns the number of lines skipped so far because they could not
+// be parsed or contained no evidence.
+func (s *LogEvidenceSource) Unparsed() uint64 {
+	return s.unparsed
+}
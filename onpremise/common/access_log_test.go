@@ -0,0 +1,151 @@
+/* *********************************************************************
+ * This Original Work is copyright of 51 Degrees Mobile Experts Limited.
+ * Copyright 2019 51 Degrees Mobile Experts Limited, 5 Charlotte Close,
+ * Caversham, Reading, Berkshire, United Kingdom RG4 7BY.
+ *
+ * This Original Work is licensed under the European Union Public Licence (EUPL)
+ * v.1.2 and is subject to its terms as set out below.
+ *
+ * If a copy of the EUPL was not distributed with this file, You can obtain
+ * one at https://opensource.org/licenses/EUPL-1.2.
+ *
+ * The 'Compatible Licences' set out in the Appendix to the EUPL (as may be
+ * amended by the European Commission) shall be deemed incompatible for
+ * the purposes of the Work and the provisions of the compatibility
+ * clause in Article 5 of the EUPL shall not apply.
+ *
+ * If using the Work as, or as part of, a network application, by
+ * including the attribution notice(s) required under Article 5 of the EUPL
+ * in the end user terms of the application under an appropriate heading,
+ * such notice(s) shall fulfill the requirements of that article.
+ * ********************************************************************* */
+
+package common
+
+import (
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/51Degrees/device-detection-go/v4/onpremise"
+)
+
+// Test if the User-Agent is captured from combined log lines.
+func TestCombinedLogParser(t *testing.T) {
+	testData := []struct {
+		line     string
+		expected map[string]string
+	}{
+		{`127.0.0.1 - frank [10/Oct/2000:13:55:36 -0700] "GET /a.gif HTTP/1.0" 200 2326 ` +
+			`"http://www.example.com/" "Mozilla/5.0 (X11; Linux x86_64)"`,
+			map[string]string{"header.User-Agent": "Mozilla/5.0 (X11; Linux x86_64)"}},
+		// Escaped quotes and extra fields as logged by nginx
+		{`10.0.0.1 - - [10/Oct/2000:13:55:36 +0000] "GET /\"x\" HTTP/1.1" 404 - ` +
+			`"-" "Agent \x22quoted\x22 \"too\"" "203.0.113.1"`,
+			map[string]string{"header.User-Agent": `Agent "quoted" "too"`}},
+		// No User-Agent
+		{`10.0.0.1 - - [10/Oct/2000:13:55:36 +0000] "GET / HTTP/1.1" 200 5 "-" "-"`,
+			map[string]string{}},
+	}
+
+	parser := NewCombinedLogParser()
+	for _, data := range testData {
+		values, ok := parser.Parse(data.line)
+		if !ok || !reflect.DeepEqual(values, data.expected) {
+			t.Errorf("Expected %v from '%s' but got %v, %t",
+				data.expected, data.line, values, ok)
+		}
+	}
+	if _, ok := parser.Parse("not a log line"); ok {
+		t.Errorf("Expected a line in another format not to be parsed")
+	}
+}
+
+// Test if named groups of a custom pattern capture headers.
+func TestRegexLogParser(t *testing.T) {
+	parser, err := NewRegexLogParser(`ua="(?P<user_agent>[^"]*)" ch="(?P<sec_ch_ua_platform>(?:[^"\\]|\\.)*)"`)
+	if err != nil {
+		t.Fatalf("Failed to create parser: %v", err)
+	}
+	values, ok := parser.Parse(`ua="Mozilla/5.0" ch="\"Windows\""`)
+	expected := map[string]string{
+		"header.User-Agent":         "Mozilla/5.0",
+		"header.Sec-Ch-Ua-Platform": `"Windows"`,
+	}
+	if !ok || !reflect.DeepEqual(values, expected) {
+		t.Errorf("Expected %v but got %v, %t", expected, values, ok)
+	}
+
+	if _, err := NewRegexLogParser(`ua="([^"]*)"`); err == nil {
+		t.Errorf("Expected an error for a pattern without named groups")
+	}
+	if _, err := NewRegexLogParser(`(`); err == nil {
+		t.Errorf("Expected an error for an invalid pattern")
+	}
+}
+
+// Test if mapped fields, including nested fields, are taken from JSON lines.
+func TestJSONLogParser(t *testing.T) {
+	fields, err := ParseLogFields("ua=header.user-agent, " +
+		"request.headers.sec-ch-ua-mobile=header.sec-ch-ua-mobile,status=query.status")
+	if err != nil {
+		t.Fatalf("Failed to parse fields: %v", err)
+	}
+	parser, err := NewJSONLogParser(fields)
+	if err != nil {
+		t.Fatalf("Failed to create parser: %v", err)
+	}
+	values, ok := parser.Parse(`{"ua":"Mozilla/5.0","status":200,` +
+		`"request":{"headers":{"sec-ch-ua-mobile":"?1"}}}`)
+	expected := map[string]string{
+		"header.user-agent":       "Mozilla/5.0",
+		"header.sec-ch-ua-mobile": "?1",
+	}
+	if !ok || !reflect.DeepEqual(values, expected) {
+		t.Errorf("Expected %v but got %v, %t", expected, values, ok)
+	}
+	if _, ok := parser.Parse(`{"ua":`); ok {
+		t.Errorf("Expected invalid JSON not to be parsed")
+	}
+
+	if _, err := ParseLogFields("ua"); err == nil {
+		t.Errorf("Expected an error for a field without a key")
+	}
+	if _, err := NewJSONLogParser(map[string]string{"ua": "user-agent"}); err == nil {
+		t.Errorf("Expected an error for a malformed evidence key")
+	}
+	for field, key := range DefaultJSONLogFields {
+		if _, _, err := ParseEvidenceKey(key); err != nil {
+			t.Errorf("Expected field '%s' to map to a valid key: %v", field, err)
+		}
+	}
+}
+
+// Test if lines which cannot be parsed are skipped and counted.
+func TestLogEvidenceSource(t *testing.T) {
+	log := `1.1.1.1 - - [10/Oct/2000:13:55:36 +0000] "GET / HTTP/1.1" 200 5 "-" "Agent 1"
+garbage
+
+1.1.1.1 - - [10/Oct/2000:13:55:36 +0000] "GET / HTTP/1.1" 200 5 "-" "-"
+1.1.1.1 - - [10/Oct/2000:13:55:36 +0000] "GET / HTTP/1.1" 200 5 "-" "Agent 2"
+`
+	src := NewLogEvidenceSource(strings.NewReader(log), NewCombinedLogParser())
+	var agents []string
+	err := ForEachEvidence(src, func(evidence []onpremise.Evidence) error {
+		agents = append(agents, GetEvidenceUserAgent(evidence))
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Failed to read log: %v", err)
+	}
+	if !reflect.DeepEqual(agents, []string{"Agent 1", "Agent 2"}) {
+		t.Errorf("Expected two User-Agents but got %v", agents)
+	}
+	if src.Unparsed() != 2 {
+		t.Errorf("Expected 2 unparsed lines but got %d", src.Unparsed())
+	}
+	if _, err := src.Next(); err != io.EOF {
+		t.Errorf("Expected EOF but got %v", err)
+	}
+}
@@ -0,0 +1,159 @@
+/* *********************************************************************
+ * This Original Work is copyright of 51 Degrees Mobile Experts Limited.
+ * Copyright 2019 51 Degrees Mobile Experts Limited, 5 Charlotte Close,
+ * Caversham, Reading, Berkshire, United Kingdom RG4 7BY.
+ *
+ * This Original Work is licensed under the European Union Public Licence (EUPL)
+ * v.1.2 and is subject to its terms as set out below.
+ *
+ * If a copy of the EUPL was not distributed with this file, You can obtain
+ * one at https://opensource.org/licenses/EUPL-1.2.
+ *
+ * The 'Compatible Licences' set out in the Appendix to the EUPL (as may be
+ * amended by the European Commission) shall be deemed incompatible for
+ * the purposes of the Work and the provisions of the compatibility
+ * clause in Article 5 of the EUPL shall not apply.
+ *
+ * If using the Work as, or as part of, a network application, by
+ * including the attribution notice(s) required under Article 5 of the EUPL
+ * in the end user terms of the application under an appropriate heading,
+ * such notice(s) shall fulfill the requirements of that article.
+ * ********************************************************************* */
+
+package common
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"sync"
+
+	"github.com/51Degrees/device-detection-go/v4/dd"
+	"github.com/51Degrees/device-detection-go/v4/onpremise"
+)
+
+// BatchFunc is called with the results of each evidence set in a batch. The
+// results are freed once the function returns so any values needed must be
+// copied out, typically into a slice at the given index.
+type BatchFunc func(index int, results *dd.ResultsHash) error
+
+// BatchWorkers returns the number of workers to use for a batch so that it
+// matches the concurrency the engine was configured for. If the concurrency
+// has not been set the number of CPUs is used.
+func BatchWorkers(config *dd.ConfigHash) int {
+	if config != nil && config.Concurrency() > 0 {
+		return int(config.Concurrency())
+	}
+	return runtime.NumCPU()
+}
+
+// ProcessBatch performs detection on each evidence set in the batch using a
+// fixed number of workers. The returned errors are in the same order as the
+// batch with a nil entry for each evidence set processed successfully, so a
+// failure of one evidence set does not affect the others.
+func ProcessBatch(
+	engine *onpremise.Engine,
+	batch [][]onpremise.Evidence,
+	workers int,
+	fn BatchFunc) []error {
+	errs, _ := ProcessBatchContext(
+		context.Background(), nil, engine, batch, nil, workers, fn)
+	return errs
+}
+
+// ProcessBatchContext is ProcessBatch with each detection performed by the
+// tracer in a span which is a child of any span in the context. The tracer
+// can be nil to disable tracing.
+//
+// invalid holds the errors of evidence sets which must not be processed, such
+// as those which failed validation, and can be nil. They are returned in
+// place of the errors of detection.
+//
+// Detection stops once the context is done. The evidence sets which were not
+// processed then have the error of the context, which is also returned.
+func ProcessBatchContext(
+	ctx context.Context,
+	tracer *Tracer,
+	engine *onpremise.Engine,
+	batch [][]onpremise.Evidence,
+	invalid []error,
+	workers int,
+	fn BatchFunc) ([]error, error) {
+	errs := make([]error, len(batch))
+	copy(errs, invalid)
+	if workers < 1 {
+		workers = 1
+	}
+	if workers > len(batch) {
+		workers = len(batch)
+	}
+
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	wg.Add(workers)
+	for w := 0; w < workers; w++ {
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				if err := ctx.Err(); err != nil {
+					errs[i] = err
+					continue
+				}
+				errs[i] = processBatchItem(ctx, tracer, engine, i, batch[i], fn)
+			}
+		}()
+	}
+
+	next := 0
+dispatch:
+	for ; next < len(batch); next++ {
+		if errs[next] != nil {
+			continue
+		}
+		select {
+		case indexes <- next:
+		case <-ctx.Done():
+			break dispatch
+		}
+	}
+	close(indexes)
+
+	// Wait until all workers finish
+	wg.Wait()
+
+	err := ctx.Err()
+	if err != nil {
+		for ; next < len(batch); next++ {
+			if errs[next] == nil {
+				errs[next] = err
+			}
+		}
+	}
+	return errs, err
+}
+
+// processBatchItem performs detection on a single evidence set and passes the
+// results to the batch function. A panic is reported as an error for the item
+// rather than terminating the batch.
+func processBatchItem(
+	ctx context.Context,
+	tracer *Tracer,
+	engine *onpremise.Engine,
+	index int,
+	evidence []onpremise.Evidence,
+	fn BatchFunc) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic while processing evidence %d: %v", index, r)
+		}
+	}()
+
+	results, err := tracer.Process(ctx, engine, evidence)
+	if err != nil {
+		return err
+	}
+	// Make sure results object is freed after function execution.
+	defer results.Free()
+
+	return fn(index, results)
+}
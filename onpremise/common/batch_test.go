@@ -0,0 +1,181 @@
+/* *********************************************************************
+ * This Original Work is copyright of 51 Degrees Mobile Experts Limited.
+ * Copyright 2019 51 Degrees Mobile Experts Limited, 5 Charlotte Close,
+ * Caversham, Reading, Berkshire, United Kingdom RG4 7BY.
+ *
+ * This Original Work is licensed under the European Union Public Licence (EUPL)
+ * v.1.2 and is subject to its terms as set out below.
+ *
+ * If a copy of the EUPL was not distributed with this file, You can obtain
+ * one at https://opensource.org/licenses/EUPL-1.2.
+ *
+ * The 'Compatible Licences' set out in the Appendix to the EUPL (as may be
+ * amended by the European Commission) shall be deemed incompatible for
+ * the purposes of the Work and the provisions of the compatibility
+ * clause in Article 5 of the EUPL shall not apply.
+ *
+ * If using the Work as, or as part of, a network application, by
+ * including the attribution notice(s) required under Article 5 of the EUPL
+ * in the end user terms of the application under an appropriate heading,
+ * such notice(s) shall fulfill the requirements of that article.
+ * ********************************************************************* */
+
+package common
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+
+	"github.com/51Degrees/device-detection-go/v4/dd"
+	"github.com/51Degrees/device-detection-go/v4/onpremise"
+)
+
+// newTestEngine creates an engine from the Lite data file. The test is
+// skipped if the data file has not been fetched.
+func newTestEngine(t testing.TB) *onpremise.Engine {
+	filePath, err := dd.GetFilePath("../..", []string{"51Degrees-LiteV4.1.hash"})
+	if err != nil {
+		t.Skip("Data file '51Degrees-LiteV4.1.hash' not found.")
+	}
+
+	config := dd.NewConfigHash(dd.Balanced)
+	config.SetUseUpperPrefixHeaders(false)
+	engine, err := onpremise.New(
+		onpremise.WithConfigHash(config),
+		onpremise.WithDataFile(filePath),
+		onpremise.WithAutoUpdate(false),
+		onpremise.WithFileWatch(false),
+		onpremise.WithLogging(false),
+	)
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	t.Cleanup(engine.Stop)
+	return engine
+}
+
+// Test if the batch output is in input order with errors reported per item.
+func TestProcessBatch(t *testing.T) {
+	engine := newTestEngine(t)
+
+	batch := make([][]onpremise.Evidence, 0, 100)
+	for i := 0; i < 100; i++ {
+		switch i % 3 {
+		case 0:
+			batch = append(batch, ExampleEvidenceMobile)
+		case 1:
+			batch = append(batch, ExampleEvidenceDesktop)
+		default:
+			batch = append(batch, ExampleEvidenceMediaHub)
+		}
+	}
+
+	failure := errors.New("failure")
+	values := make([]string, len(batch))
+	var calls int64
+	errs := ProcessBatch(engine, batch, 4, func(i int, results *dd.ResultsHash) error {
+		atomic.AddInt64(&calls, 1)
+		if i == 50 {
+			return failure
+		}
+		if i == 51 {
+			panic("unexpected")
+		}
+		value, err := results.ValuesString("IsMobile", ",")
+		values[i] = value
+		return err
+	})
+
+	if calls != int64(len(batch)) {
+		t.Errorf("Expected %d calls but got %d", len(batch), calls)
+	}
+	if len(errs) != len(batch) {
+		t.Fatalf("Expected %d errors but got %d", len(batch), len(errs))
+	}
+	for i, err := range errs {
+		switch i {
+		case 50:
+			if err != failure {
+				t.Errorf("Expected failure for item %d but got %v", i, err)
+			}
+		case 51:
+			if err == nil {
+				t.Errorf("Expected panic to be reported for item %d", i)
+			}
+		default:
+			if err != nil {
+				t.Errorf("Unexpected error for item %d: %v", i, err)
+			}
+		}
+	}
+
+	// Mobile and desktop evidence must be in the order they were given
+	for i := 0; i < 50; i++ {
+		expected := "True"
+		if i%3 == 2 {
+			continue
+		} else if i%3 == 1 {
+			expected = "False"
+		}
+		if values[i] != expected {
+			t.Errorf("Expected IsMobile '%s' for item %d but got '%s'",
+				expected, i, values[i])
+		}
+	}
+}
+
+// Test if evidence sets which failed validation are reported without
+// detection being performed.
+func TestProcessBatchInvalid(t *testing.T) {
+	batch := [][]onpremise.Evidence{nil, nil}
+	invalid := []error{errors.New("invalid 0"), errors.New("invalid 1")}
+	// No engine is needed as no detection is performed
+	errs, err := ProcessBatchContext(context.Background(), nil, nil, batch,
+		invalid, 2, func(i int, results *dd.ResultsHash) error {
+			t.Errorf("Unexpected detection for item %d", i)
+			return nil
+		})
+	if err != nil {
+		t.Fatalf("Unexpected error. %v", err)
+	}
+	for i := range batch {
+		if errs[i] != invalid[i] {
+			t.Errorf("Expected '%v' for item %d but got '%v'", invalid[i], i, errs[i])
+		}
+	}
+}
+
+// Test if no detection is performed once the context is done and the
+// evidence sets are reported with the error of the context.
+func TestProcessBatchCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	batch := make([][]onpremise.Evidence, 10)
+	errs, err := ProcessBatchContext(ctx, nil, nil, batch, nil, 4,
+		func(i int, results *dd.ResultsHash) error {
+			t.Errorf("Unexpected detection for item %d", i)
+			return nil
+		})
+	if err != context.Canceled {
+		t.Errorf("Expected context.Canceled but got %v", err)
+	}
+	for i, err := range errs {
+		if err != context.Canceled {
+			t.Errorf("Expected context.Canceled for item %d but got %v", i, err)
+		}
+	}
+}
+
+// Test if the number of workers follows the configured concurrency.
+func TestBatchWorkers(t *testing.T) {
+	config := dd.NewConfigHash(dd.Balanced)
+	config.SetConcurrency(3)
+	if workers := BatchWorkers(config); workers != 3 {
+		t.Errorf("Expected 3 workers but got %d", workers)
+	}
+	if workers := BatchWorkers(nil); workers < 1 {
+		t.Errorf("Expected at least 1 worker but got %d", workers)
+	}
+}
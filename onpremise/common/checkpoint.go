@@ -0,0 +1,232 @@
+/* *********************************************************************
+ * This Original Work is copyright of 51 Degrees Mobile Experts Limited.
+ * Copyright 2019 51 Degrees Mobile Experts Limited, 5 Charlotte Close,
+ * Caversham, Reading, Berkshire, United Kingdom RG4 7BY.
+ *
+ * This Original Work is licensed under the European Union Public Licence (EUPL)
+ * v.1.2 and is subject to its terms as set out below.
+ *
+ * If a copy of the EUPL was not distributed with this file, You can obtain
+ * one at https://opensource.org/licenses/EUPL-1.2.
+ *
+ * The 'Compatible Licences' set out in the Appendix to the EUPL (as may be
+ * amended by the European Commission) shall be deemed incompatible for
+ * the purposes of the Work and the provisions of the compatibility
+ * clause in Article 5 of the EUPL shall not apply.
+ *
+ * If using the Work as, or as part of, a network application, by
+ * including the attribution notice(s) required under Article 5 of the EUPL
+ * in the end user terms of the application under an appropriate heading,
+ * such notice(s) shall fulfill the requirements of that article.
+ * ********************************************************************* */
+
+package common
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// Checkpoint records how much of an input file has been processed and
+// written to an output file, so that processing can resume from there rather
+// than starting again.
+type Checkpoint struct {
+	// Path of the input file
+	Input string `json:"input"`
+	// Settings which affect the output, which must be the same to resume
+	Settings string `json:"settings"`
+	// Number of input records processed and written to the output
+	Records uint64 `json:"records"`
+	// Size of the output in bytes once the records were written
+	Offset int64 `json:"offset"`
+}
+
+// PartialPath returns the path an output file is written to until it is
+// complete.
+func PartialPath(path string) string {
+	return path + ".partial"
+}
+
+// CheckpointPath returns the path of the checkpoint of an output file.
+func CheckpointPath(path string) string {
+	return path + ".checkpoint"
+}
+
+// ReadCheckpoint reads a checkpoint file. The error satisfies
+// errors.Is(err, os.ErrNotExist) if there is no checkpoint.
+func ReadCheckpoint(path string) (*Checkpoint, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var c Checkpoint
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, fmt.Errorf("invalid checkpoint '%s': %w", path, err)
+	}
+	return &c, nil
+}
+
+// WriteCheckpoint writes a checkpoint file. The checkpoint is written to a
+// temporary file which replaces the previous checkpoint, so the checkpoint
+// file is never partially written.
+func WriteCheckpoint(path string, c *Checkpoint) error {
+	data, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// SkipEvidence reads and discards n records from the source.
+func SkipEvidence(src EvidenceSource, n uint64) error {
+	for i := uint64(0); i < n; i++ {
+		if _, err := src.Next(); err == io.EOF {
+			return fmt.Errorf("expected %d records but found %d", n, i)
+		} else if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// OutputFile is an output file which can be resumed from its last
+// checkpoint. It is written to PartialPath until Commit renames it, so a
+// partially written file is never mistaken for a complete one.
+type OutputFile struct {
+	path       string
+	file       *os.File
+	checkpoint Checkpoint
+	// Records already written when the file was opened
+	resumed uint64
+}
+
+// CreateOutputFile creates an output file for the input and settings of the
+// checkpoint, discarding any partial output and checkpoint.
+func CreateOutputFile(path string, checkpoint Checkpoint) (*OutputFile, error) {
+	if err := os.Remove(CheckpointPath(path)); err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	file, err := os.Create(PartialPath(path))
+	if err != nil {
+		return nil, err
+	}
+	checkpoint.Records = 0
+	checkpoint.Offset = 0
+	return &OutputFile{path, file, checkpoint, 0}, nil
+}
+
+// ResumeOutputFile opens the partial output file at its last checkpoint, so
+// that writing continues after the records of the checkpoint. Output written
+// after the checkpoint is discarded. The file is created as if by
+// CreateOutputFile if there is no checkpoint. An error is returned if the
+// checkpoint was written for a different input or settings.
+func ResumeOutputFile(path string, checkpoint Checkpoint) (*OutputFile, error) {
+	last, err := ReadCheckpoint(CheckpointPath(path))
+	if os.IsNotExist(err) {
+		return CreateOutputFile(path, checkpoint)
+	} else if err != nil {
+		return nil, err
+	}
+	if last.Input != checkpoint.Input || last.Settings != checkpoint.Settings {
+		return nil, fmt.Errorf(
+			"checkpoint '%s' is for input '%s' with settings '%s', "+
+				"not '%s' with settings '%s'",
+			CheckpointPath(path),
+			last.Input,
+			last.Settings,
+			checkpoint.Input,
+			checkpoint.Settings)
+	}
+	if last.Records == 0 {
+		return CreateOutputFile(path, checkpoint)
+	}
+
+	file, err := os.OpenFile(PartialPath(path), os.O_RDWR, 0)
+	if err != nil {
+		return nil, err
+	}
+	info, err := file.Stat()
+	if err == nil && info.Size() < last.Offset {
+		err = fmt.Errorf("partial output '%s' has %d bytes but the checkpoint "+
+			"is at %d bytes", PartialPath(path), info.Size(), last.Offset)
+	}
+	if err == nil {
+		err = file.Truncate(last.Offset)
+	}
+	if err == nil {
+		_, err = file.Seek(last.Offset, io.SeekStart)
+	}
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return &OutputFile{path, file, *last, last.Records}, nil
+}
+
+// Records returns the number of records written before the file was opened,
+// which are to be skipped in the input.
+func (f *OutputFile) Records() uint64 {
+	return f.resumed
+}
+
+// Write writes to the partial output file.
+func (f *OutputFile) Write(p []byte) (int, error) {
+	n, err := f.file.Write(p)
+	f.checkpoint.Offset += int64(n)
+	return n, err
+}
+
+// Checkpoint records that the given number of records have been written
+// since the file was opened. Any buffered output of the records must have been
+// written to the file first.
+func (f *OutputFile) Checkpoint(records uint64) error {
+	if err := f.file.Sync(); err != nil {
+		return err
+	}
+	f.checkpoint.Records = f.resumed + records
+	return WriteCheckpoint(CheckpointPath(f.path), &f.checkpoint)
+}
+
+// Commit closes the file and renames it to its final path, replacing any
+// previous output, then removes the checkpoint.
+func (f *OutputFile) Commit() error {
+	if err := f.file.Sync(); err != nil {
+		f.file.Close()
+		return err
+	}
+	if err := f.file.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(PartialPath(f.path), f.path); err != nil {
+		return err
+	}
+	if err := os.Remove(CheckpointPath(f.path)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// Close closes the file without committing it, leaving the partial output
+// and checkpoint so processing can be resumed.
+func (f *OutputFile) Close() error {
+	return f.file.Close()
+}
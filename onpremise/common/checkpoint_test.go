@@ -0,0 +1,183 @@
+/* *********************************************************************
+ * This Original Work is copyright of 51 Degrees Mobile Experts Limited.
+ * Copyright 2019 51 Degrees Mobile Experts Limited, 5 Charlotte Close,
+ * Caversham, Reading, Berkshire, United Kingdom RG4 7BY.
+ *
+ * This Original Work is licensed under the European Union Public Licence (EUPL)
+ * v.1.2 and is subject to its terms as set out below.
+ *
+ * If a copy of the EUPL was not distributed with this file, You can obtain
+ * one at https://opensource.org/licenses/EUPL-1.2.
+ *
+ * The 'Compatible Licences' set out in the Appendix to the EUPL (as may be
+ * amended by the European Commission) shall be deemed incompatible for
+ * the purposes of the Work and the provisions of the compatibility
+ * clause in Article 5 of the EUPL shall not apply.
+ *
+ * If using the Work as, or as part of, a network application, by
+ * including the attribution notice(s) required under Article 5 of the EUPL
+ * in the end user terms of the application under an appropriate heading,
+ * such notice(s) shall fulfill the requirements of that article.
+ * ********************************************************************* */
+
+package common
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Records written by the checkpoint tests
+func checkpointRecords() []map[string]string {
+	var records []map[string]string
+	for i := 0; i < 10; i++ {
+		records = append(records, map[string]string{
+			"header.user-agent": fmt.Sprintf("agent %d", i),
+			"device.deviceid":   fmt.Sprintf("%d-0-0", i),
+		})
+	}
+	return records
+}
+
+// writeRecords writes records to the output file with a checkpoint after
+// each, returning the writer without closing it.
+func writeRecords(
+	t *testing.T,
+	f *OutputFile,
+	w RecordWriter,
+	records []map[string]string) {
+	for i, record := range records {
+		if err := w.Write(record); err != nil {
+			t.Fatalf("Failed to write record: %v", err)
+		}
+		if err := w.Flush(); err != nil {
+			t.Fatalf("Failed to flush records: %v", err)
+		}
+		if err := f.Checkpoint(uint64(i + 1)); err != nil {
+			t.Fatalf("Failed to write checkpoint: %v", err)
+		}
+	}
+}
+
+// Test if resuming from a checkpoint produces the same output as writing
+// all the records at once.
+func TestOutputFileResume(t *testing.T) {
+	records := checkpointRecords()
+	columns := []string{"header.user-agent", "device.deviceid"}
+	const interrupted = 4
+	for _, format := range []EvidenceFormat{FormatYAML, FormatJSONLines, FormatCSV} {
+		var expected strings.Builder
+		w, _ := NewRecordWriter(&expected, format, columns)
+		for _, record := range records {
+			w.Write(record)
+		}
+		w.Close()
+
+		path := filepath.Join(t.TempDir(), "output")
+		checkpoint := Checkpoint{Input: "input", Settings: format.String()}
+		f, err := CreateOutputFile(path, checkpoint)
+		if err != nil {
+			t.Fatalf("Failed to create output: %v", err)
+		}
+		w, err = NewRecordWriter(f, format, columns)
+		if err != nil {
+			t.Fatalf("Failed to create %s writer: %v", format, err)
+		}
+		writeRecords(t, f, w, records[:interrupted])
+		// Output after the last checkpoint must be discarded
+		f.Write([]byte("incomplete"))
+		f.Close()
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Fatalf("Expected no output before commit but got %v", err)
+		}
+
+		f, err = ResumeOutputFile(path, checkpoint)
+		if err != nil {
+			t.Fatalf("Failed to resume output: %v", err)
+		}
+		if f.Records() != interrupted {
+			t.Fatalf("Expected to resume after %d records but got %d",
+				interrupted, f.Records())
+		}
+		w, err = AppendRecordWriter(f, format, columns)
+		if err != nil {
+			t.Fatalf("Failed to create %s writer: %v", format, err)
+		}
+		writeRecords(t, f, w, records[interrupted:])
+		if err := w.Close(); err != nil {
+			t.Fatalf("Failed to close %s writer: %v", format, err)
+		}
+		if err := f.Commit(); err != nil {
+			t.Fatalf("Failed to commit output: %v", err)
+		}
+
+		actual, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatalf("Failed to read output: %v", err)
+		}
+		if string(actual) != expected.String() {
+			t.Errorf("Expected resumed %s output:\n%s\nbut got:\n%s",
+				format, expected.String(), actual)
+		}
+		for _, leftover := range []string{PartialPath(path), CheckpointPath(path)} {
+			if _, err := os.Stat(leftover); !os.IsNotExist(err) {
+				t.Errorf("Expected '%s' to be removed but got %v", leftover, err)
+			}
+		}
+	}
+}
+
+// Test if resuming without a checkpoint starts again, and resuming with
+// different settings fails.
+func TestOutputFileResumeSettings(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "output")
+	checkpoint := Checkpoint{Input: "input", Settings: "yaml"}
+	f, err := ResumeOutputFile(path, checkpoint)
+	if err != nil {
+		t.Fatalf("Failed to resume output without a checkpoint: %v", err)
+	}
+	if f.Records() != 0 {
+		t.Errorf("Expected no records without a checkpoint but got %d", f.Records())
+	}
+	f.Write([]byte("record\n"))
+	if err := f.Checkpoint(1); err != nil {
+		t.Fatalf("Failed to write checkpoint: %v", err)
+	}
+	f.Close()
+
+	if _, err := ResumeOutputFile(path, Checkpoint{Input: "input", Settings: "csv"}); err == nil {
+		t.Errorf("Expected an error for different settings")
+	}
+	if _, err := ResumeOutputFile(path, Checkpoint{Input: "other", Settings: "yaml"}); err == nil {
+		t.Errorf("Expected an error for a different input")
+	}
+	last, err := ReadCheckpoint(CheckpointPath(path))
+	if err != nil {
+		t.Fatalf("Failed to read checkpoint: %v", err)
+	}
+	if last.Records != 1 || last.Offset != int64(len("record\n")) {
+		t.Errorf("Expected 1 record at offset 7 but got %d at %d",
+			last.Records, last.Offset)
+	}
+}
+
+// Test if records are skipped, and skipping past the end fails.
+func TestSkipEvidence(t *testing.T) {
+	src, err := NewEvidenceSource(strings.NewReader("a\nb\nc\n"), FormatUserAgents)
+	if err != nil {
+		t.Fatalf("Failed to create source: %v", err)
+	}
+	if err := SkipEvidence(src, 2); err != nil {
+		t.Fatalf("Failed to skip records: %v", err)
+	}
+	evidence, err := src.Next()
+	if err != nil || len(evidence) != 1 || evidence[0].Value != "c" {
+		t.Errorf("Expected the third record but got %v, %v", evidence, err)
+	}
+	if err := SkipEvidence(src, 1); err == nil {
+		t.Errorf("Expected an error skipping past the end")
+	}
+}
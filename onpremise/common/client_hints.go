@@ -0,0 +1,418 @@
+/* *********************************************************************
+ * This Original Work is copyright of 51 Degrees Mobile Experts Limited.
+ * Copyright 2019 51 Degrees Mobile Experts Limited, 5 Charlotte Close,
+ * Caversham, Reading, Berkshire, United Kingdom RG4 7BY.
+ *
+ * This Original Work is licensed under the European Union Public Licence (EUPL)
+ * v.1.2 and is subject to its terms as set out below.
+ *
+ * If a copy of the EUPL was not distributed with this file, You can obtain
+ * one at https://opensource.org/licenses/EUPL-1.2.
+ *
+ * The 'Compatible Licences' set out in the Appendix to the EUPL (as may be
+ * amended by the European Commission) shall be deemed incompatible for
+ * the purposes of the Work and the provisions of the compatibility
+ * clause in Article 5 of the EUPL shall not apply.
+ *
+ * If using the Work as, or as part of, a network application, by
+ * including the attribution notice(s) required under Article 5 of the EUPL
+ * in the end user terms of the application under an appropriate heading,
+ * such notice(s) shall fulfill the requirements of that article.
+ * ********************************************************************* */
+
+package common
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/51Degrees/device-detection-go/v4/dd"
+	"github.com/51Degrees/device-detection-go/v4/onpremise"
+)
+
+// Structured header types of client hints values
+type hintType int
+
+const (
+	// A string, e.g. `"Windows"`
+	hintString hintType = iota
+	// A boolean, '?0' or '?1'
+	hintBoolean
+	// A list of brands and versions, e.g. `"Chromium";v="124"`
+	hintBrandList
+	// A list of strings, e.g. `"Desktop", "XR"`
+	hintStringList
+)
+
+// Types of the client hints headers normalised by NormaliseClientHint, by
+// lowercase header name
+var clientHintTypes = map[string]hintType{
+	"sec-ch-ua":                   hintBrandList,
+	"sec-ch-ua-arch":              hintString,
+	"sec-ch-ua-bitness":           hintString,
+	"sec-ch-ua-form-factors":      hintStringList,
+	"sec-ch-ua-full-version":      hintString,
+	"sec-ch-ua-full-version-list": hintBrandList,
+	"sec-ch-ua-mobile":            hintBoolean,
+	"sec-ch-ua-model":             hintString,
+	"sec-ch-ua-platform":          hintString,
+	"sec-ch-ua-platform-version":  hintString,
+	"sec-ch-ua-wow64":             hintBoolean,
+}
+
+// Brands made up by browsers so that servers do not depend on the list of
+// brands, e.g. "Not A;Brand", "Not-A.Brand" or "Not)A;Brand". Chromium
+// changes the punctuation and position of the brand between versions.
+var greaseBrand = regexp.MustCompile(`(?i)^\s*Not[^a-z0-9]*A[^a-z0-9]*Brand\s*$`)
+
+// Brand is an entry of the Sec-CH-UA or Sec-CH-UA-Full-Version-List header.
+// It is encoded in JSON in the same way as by navigator.userAgentData.
+type Brand struct {
+	Name    string `json:"brand"`
+	Version string `json:"version"`
+}
+
+// IsGrease checks if the brand is made up by the browser rather than
+// identifying it. GREASE brands change between browser versions.
+func (b Brand) IsGrease() bool {
+	return greaseBrand.MatchString(b.Name)
+}
+
+// ParseBrandList parses the value of the Sec-CH-UA or
+// Sec-CH-UA-Full-Version-List header, which is a structured header list
+// (RFC 8941) of brand strings with the version in the 'v' parameter, e.g.
+// `"Chromium";v="124", "Not-A.Brand";v="99"`. Other parameters are ignored.
+func ParseBrandList(value string) ([]Brand, error) {
+	p := &sfParser{s: value}
+	p.skipSP()
+	var brands []Brand
+	for !p.done() {
+		name, err := p.parseString()
+		if err != nil {
+			return nil, err
+		}
+		b := Brand{Name: name}
+		for p.peek() == ';' {
+			p.i++
+			p.skipSP()
+			key, err := p.parseKey()
+			if err != nil {
+				return nil, err
+			}
+			if p.peek() != '=' {
+				// A parameter without a value is boolean true
+				continue
+			}
+			p.i++
+			if key == "v" {
+				if b.Version, err = p.parseString(); err != nil {
+					return nil, err
+				}
+			} else if _, err := p.parseBareItem(); err != nil {
+				return nil, err
+			}
+		}
+		brands = append(brands, b)
+		if err := p.nextMember(); err != nil {
+			return nil, err
+		}
+	}
+	return brands, nil
+}
+
+// FormatBrandList serializes brands in the canonical format of the Sec-CH-UA
+// header, e.g. `"Chromium";v="124", "Google Chrome";v="124"`.
+func FormatBrandList(brands []Brand) string {
+	members := make([]string, len(brands))
+	for i, b := range brands {
+		members[i] = FormatStringHint(b.Name) + ";v=" + FormatStringHint(b.Version)
+	}
+	return strings.Join(members, ", ")
+}
+
+// NormaliseBrandList removes GREASE brands from a Sec-CH-UA or
+// Sec-CH-UA-Full-Version-List value, sorts the brands by name and serializes
+// them canonically, so that the value is the same for a browser version
+// however the brands are greased.
+func NormaliseBrandList(value string) (string, error) {
+	brands, err := ParseBrandList(value)
+	if err != nil {
+		return "", err
+	}
+	filtered := brands[:0]
+	for _, b := range brands {
+		if !b.IsGrease() {
+			filtered = append(filtered, b)
+		}
+	}
+	sort.SliceStable(filtered, func(i, j int) bool {
+		return filtered[i].Name < filtered[j].Name
+	})
+	return FormatBrandList(filtered), nil
+}
+
+// NormaliseClientHint returns the canonical value of a client hints header:
+// brand lists are normalised by NormaliseBrandList, booleans such as
+// Sec-CH-UA-Mobile are '?0' or '?1', and strings such as Sec-CH-UA-Platform
+// and the strings of Sec-CH-UA-Form-Factors are quoted without surrounding
+// whitespace. Values of other headers, including Sec-CH-UA-* headers which
+// are not known, are returned unchanged.
+func NormaliseClientHint(header, value string) (string, error) {
+	t, ok := clientHintTypes[strings.ToLower(header)]
+	if !ok {
+		return value, nil
+	}
+	var item string
+	var err error
+	switch t {
+	case hintBrandList:
+		return NormaliseBrandList(value)
+	case hintBoolean:
+		item, err = parseItem(value, (*sfParser).parseBoolean)
+	case hintStringList:
+		item, err = normaliseStringList(value)
+	default:
+		item, err = ParseStringHint(value)
+		item = FormatStringHint(item)
+	}
+	if err != nil {
+		return "", fmt.Errorf("invalid %s value: %w", header, err)
+	}
+	return item, nil
+}
+
+// normaliseStringList serializes a structured header list of strings
+// canonically, keeping the order of the strings.
+func normaliseStringList(value string) (string, error) {
+	p := &sfParser{s: value}
+	p.skipSP()
+	var members []string
+	for !p.done() {
+		s, err := p.parseString()
+		if err != nil {
+			return "", err
+		}
+		if err := p.skipParameters(); err != nil {
+			return "", err
+		}
+		members = append(members, FormatStringHint(s))
+		if err := p.nextMember(); err != nil {
+			return "", err
+		}
+	}
+	return strings.Join(members, ", "), nil
+}
+
+// ParseStringHint parses the value of a client hints header which is a
+// structured header string, such as Sec-CH-UA-Platform, e.g. "Windows" for
+// `"Windows"`. Parameters are ignored.
+func ParseStringHint(value string) (string, error) {
+	return parseItem(value, (*sfParser).parseString)
+}
+
+// FormatStringHint serializes a string as the value of a client hints header
+// such as Sec-CH-UA-Platform, e.g. `"Windows"` for "Windows".
+func FormatStringHint(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	return `"` + strings.ReplaceAll(s, `"`, `\"`) + `"`
+}
+
+// NormaliseEvidence returns a copy of the evidence with the values of client
+// hints headers and query parameters normalised by NormaliseClientHint.
+// Values which cannot be parsed are left unchanged.
+func NormaliseEvidence(evidence []onpremise.Evidence) []onpremise.Evidence {
+	normalised := make([]onpremise.Evidence, len(evidence))
+	for i, e := range evidence {
+		normalised[i] = e
+		if e.Prefix != dd.HttpHeaderString && e.Prefix != dd.HttpEvidenceQuery {
+			continue
+		}
+		if value, err := NormaliseClientHint(e.Key, e.Value); err == nil {
+			normalised[i].Value = value
+		}
+	}
+	return normalised
+}
+
+// CanonicalEvidence serializes evidence canonically for use in logs or as a
+// cache key: the evidence is normalised by NormaliseEvidence and written as
+// 'prefix.key: value' lines sorted by key, with keys in lowercase.
+func CanonicalEvidence(evidence []onpremise.Evidence) string {
+	lines := make([]string, 0, len(evidence))
+	for _, e := range NormaliseEvidence(evidence) {
+		key := EvidenceKeyString(dd.EvidenceKey{Prefix: e.Prefix, Key: e.Key})
+		lines = append(lines, strings.ToLower(key)+": "+e.Value)
+	}
+	sort.Strings(lines)
+	return strings.Join(lines, "\n")
+}
+
+// sfParser parses the parts of structured header values (RFC 8941) used by
+// client hints.
+type sfParser struct {
+	s string
+	i int
+}
+
+func (p *sfParser) done() bool {
+	return p.i >= len(p.s)
+}
+
+// peek returns the next character, or 0 at the end.
+func (p *sfParser) peek() byte {
+	if p.done() {
+		return 0
+	}
+	return p.s[p.i]
+}
+
+func (p *sfParser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("invalid structured header '%s' at %d: %s",
+		p.s, p.i, fmt.Sprintf(format, args...))
+}
+
+// skipSP skips spaces.
+func (p *sfParser) skipSP() {
+	for p.peek() == ' ' {
+		p.i++
+	}
+}
+
+// skipOWS skips optional whitespace between list members.
+func (p *sfParser) skipOWS() {
+	for c := p.peek(); c == ' ' || c == '\t'; c = p.peek() {
+		p.i++
+	}
+}
+
+// nextMember moves past the separator after a list member, if any.
+func (p *sfParser) nextMember() error {
+	p.skipOWS()
+	if p.done() {
+		return nil
+	}
+	if p.peek() != ',' {
+		return p.errorf("expected ','")
+	}
+	p.i++
+	p.skipOWS()
+	if p.done() {
+		return p.errorf("trailing ','")
+	}
+	return nil
+}
+
+// parseItem parses a structured header item of the whole value with parse.
+// Parameters are not used by any of the hints so are skipped.
+func parseItem(
+	value string,
+	parse func(p *sfParser) (string, error)) (string, error) {
+	p := &sfParser{s: value}
+	p.skipSP()
+	item, err := parse(p)
+	if err != nil {
+		return "", err
+	}
+	if err := p.skipParameters(); err != nil {
+		return "", err
+	}
+	p.skipSP()
+	if !p.done() {
+		return "", p.errorf("unexpected '%c'", p.peek())
+	}
+	return item, nil
+}
+
+// skipParameters moves past the parameters of an item, if any.
+func (p *sfParser) skipParameters() error {
+	for p.peek() == ';' {
+		p.i++
+		p.skipSP()
+		if _, err := p.parseKey(); err != nil {
+			return err
+		}
+		if p.peek() == '=' {
+			p.i++
+			if _, err := p.parseBareItem(); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// parseString parses a quoted string.
+func (p *sfParser) parseString() (string, error) {
+	if p.peek() != '"' {
+		return "", p.errorf("expected a string")
+	}
+	p.i++
+	var b strings.Builder
+	for !p.done() {
+		c := p.s[p.i]
+		p.i++
+		switch {
+		case c == '\\':
+			if next := p.peek(); next == '"' || next == '\\' {
+				b.WriteByte(next)
+				p.i++
+			} else {
+				return "", p.errorf("invalid escape")
+			}
+		case c == '"':
+			return b.String(), nil
+		case c < 0x20 || c > 0x7e:
+			return "", p.errorf("invalid character in string")
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return "", p.errorf("unterminated string")
+}
+
+// parseBoolean parses a boolean, returning '?0' or '?1'.
+func (p *sfParser) parseBoolean() (string, error) {
+	if p.peek() != '?' || p.i+1 >= len(p.s) ||
+		(p.s[p.i+1] != '0' && p.s[p.i+1] != '1') {
+		return "", p.errorf("expected a boolean")
+	}
+	p.i += 2
+	return p.s[p.i-2 : p.i], nil
+}
+
+// parseKey parses a parameter key.
+func (p *sfParser) parseKey() (string, error) {
+	start := p.i
+	if c := p.peek(); !(c >= 'a' && c <= 'z') && c != '*' {
+		return "", p.errorf("expected a key")
+	}
+	for c := p.peek(); (c >= 'a' && c <= 'z') || (c >= '0' && c <= '9') ||
+		c == '_' || c == '-' || c == '.' || c == '*'; c = p.peek() {
+		p.i++
+	}
+	return p.s[start:p.i], nil
+}
+
+// parseBareItem parses a string, boolean, token or number, returning its
+// serialized form.
+func (p *sfParser) parseBareItem() (string, error) {
+	switch c := p.peek(); {
+	case c == '"':
+		s, err := p.parseString()
+		return FormatStringHint(s), err
+	case c == '?':
+		return p.parseBoolean()
+	case c == '-' || (c >= '0' && c <= '9') || (c >= 'a' && c <= 'z') ||
+		(c >= 'A' && c <= 'Z') || c == '*':
+		// Tokens and numbers run until a delimiter
+		start := p.i
+		for c := p.peek(); c > 0x20 && c < 0x7f &&
+			!strings.ContainsRune(`",;()<>=?@[\]{}`, rune(c)); c = p.peek() {
+			p.i++
+		}
+		return p.s[start:p.i], nil
+	}
+	return "", p.errorf("expected an item")
+}
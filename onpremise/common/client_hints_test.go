@@ -0,0 +1,144 @@
+/* *********************************************************************
+ * This Original Work is copyright of 51 Degrees Mobile Experts Limited.
+ * Copyright 2019 51 Degrees Mobile Experts Limited, 5 Charlotte Close,
+ * Caversham, Reading, Berkshire, United Kingdom RG4 7BY.
+ *
+ * This Original Work is licensed under the European Union Public Licence (EUPL)
+ * v.1.2 and is subject to its terms as set out below.
+ *
+ * If a copy of the EUPL was not distributed with this file, You can obtain
+ * one at https://opensource.org/licenses/EUPL-1.2.
+ *
+ * The 'Compatible Licences' set out in the Appendix to the EUPL (as may be
+ * amended by the European Commission) shall be deemed incompatible for
+ * the purposes of the Work and the provisions of the compatibility
+ * clause in Article 5 of the EUPL shall not apply.
+ *
+ * If using the Work as, or as part of, a network application, by
+ * including the attribution notice(s) required under Article 5 of the EUPL
+ * in the end user terms of the application under an appropriate heading,
+ * such notice(s) shall fulfill the requirements of that article.
+ * ********************************************************************* */
+
+package common
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/51Degrees/device-detection-go/v4/dd"
+	"github.com/51Degrees/device-detection-go/v4/onpremise"
+)
+
+// Test if brand lists are parsed, including escapes and other parameters.
+func TestParseBrandList(t *testing.T) {
+	brands, err := ParseBrandList(
+		`"Chromium";v="124",  "Not-A.Brand";v="99";x=1,"A \"B\\";v="2";b`)
+	expected := []Brand{{"Chromium", "124"}, {"Not-A.Brand", "99"}, {`A "B\`, "2"}}
+	if err != nil || !reflect.DeepEqual(brands, expected) {
+		t.Errorf("Expected %v but got %v, %v", expected, brands, err)
+	}
+	for _, value := range []string{
+		`Chromium;v="124"`,
+		`"Chromium";v="124",`,
+		`"Chromium" "Edge"`,
+		`"Chromium;v="124"`,
+		`"Chromium";V="124"`,
+		`"Chromium";v=124`,
+	} {
+		if _, err := ParseBrandList(value); err == nil {
+			t.Errorf("Expected an error for '%s'", value)
+		}
+	}
+}
+
+// Test if GREASE brands of different browser versions are recognised.
+func TestBrandIsGrease(t *testing.T) {
+	for _, name := range []string{
+		" Not A;Brand", "Not A(Brand", "Not-A.Brand", "Not)A;Brand",
+		"Not_A Brand", "Not/A)Brand", "Not=A?Brand", "Not.A/Brand",
+	} {
+		if !(Brand{name, "99"}).IsGrease() {
+			t.Errorf("Expected '%s' to be a GREASE brand", name)
+		}
+	}
+	for _, name := range []string{"Chromium", "Google Chrome", "Microsoft Edge", "Brand"} {
+		if (Brand{name, "124"}).IsGrease() {
+			t.Errorf("Expected '%s' not to be a GREASE brand", name)
+		}
+	}
+}
+
+// Test if values with different GREASE brands and order are normalised to
+// the same value.
+func TestNormaliseBrandList(t *testing.T) {
+	const expected = `"Chromium";v="124", "Google Chrome";v="124"`
+	for _, value := range []string{
+		`"Chromium";v="124", "Google Chrome";v="124", "Not-A.Brand";v="99"`,
+		`"Not/A)Brand";v="8",   "Google Chrome";v="124","Chromium";v="124"`,
+		`"Google Chrome";v="124", "Chromium";v="124"`,
+	} {
+		if actual, err := NormaliseBrandList(value); err != nil || actual != expected {
+			t.Errorf("Expected '%s' for '%s' but got '%s', %v", expected, value, actual, err)
+		}
+	}
+}
+
+// Test if each type of client hint is normalised.
+func TestNormaliseClientHint(t *testing.T) {
+	testData := []struct {
+		header   string
+		value    string
+		expected string
+	}{
+		{"sec-ch-ua-full-version-list", `"Not.A/Brand";v="8.0.0.0", "Chromium";v="114.0.5735.199"`,
+			`"Chromium";v="114.0.5735.199"`},
+		{"Sec-CH-UA-Mobile", " ?1", "?1"},
+		{"Sec-CH-UA-Platform", ` "Windows" `, `"Windows"`},
+		{"Sec-CH-UA-Model", `""`, `""`},
+		{"Sec-CH-UA-WoW64", "?0 ", "?0"},
+		{"Sec-CH-UA-Form-Factors", ` "Desktop","XR";x=1`, `"Desktop", "XR"`},
+		{"Sec-CH-UA-Unknown", ` ?1 `, ` ?1 `},
+		{"User-Agent", ` Mozilla/5.0 `, ` Mozilla/5.0 `},
+	}
+	for _, data := range testData {
+		actual, err := NormaliseClientHint(data.header, data.value)
+		if err != nil || actual != data.expected {
+			t.Errorf("Expected '%s' for %s '%s' but got '%s', %v",
+				data.expected, data.header, data.value, actual, err)
+		}
+	}
+	for _, data := range []struct{ header, value string }{
+		{"Sec-CH-UA-Mobile", "1"},
+		{"Sec-CH-UA-Platform", "Windows"},
+		{"Sec-CH-UA-Platform", `"Windows" x`},
+		{"Sec-CH-UA-WoW64", `"?0"`},
+		{"Sec-CH-UA-Form-Factors", `"Desktop",`},
+	} {
+		if _, err := NormaliseClientHint(data.header, data.value); err == nil {
+			t.Errorf("Expected an error for %s '%s'", data.header, data.value)
+		}
+	}
+}
+
+// Test if evidence is serialized the same however the browser greases its
+// brands.
+func TestCanonicalEvidence(t *testing.T) {
+	expected := CanonicalEvidence(ExampleEvidenceDesktop)
+	rotated := make([]onpremise.Evidence, len(ExampleEvidenceDesktop))
+	for i, e := range ExampleEvidenceDesktop {
+		if e.Key == "Sec-Ch-Ua" {
+			e.Value = `"Google Chrome";v="124", "Not:A-Brand";v="8", "Chromium";v="124"`
+		}
+		// Reverse the order of the evidence
+		rotated[len(rotated)-1-i] = e
+	}
+	if actual := CanonicalEvidence(rotated); actual != expected {
+		t.Errorf("Expected:\n%s\nbut got:\n%s", expected, actual)
+	}
+
+	cookie := []onpremise.Evidence{{Prefix: dd.HttpEvidenceCookie, Key: "Sec-CH-UA-Mobile", Value: "1"}}
+	if actual := CanonicalEvidence(cookie); actual != "cookie.sec-ch-ua-mobile: 1" {
+		t.Errorf("Expected cookie evidence to be unchanged but got '%s'", actual)
+	}
+}
@@ -0,0 +1,171 @@
+/* *********************************************************************
+ * This Original Work is copyright of 51 Degrees Mobile Experts Limited.
+ * Copyright 2019 51 Degrees Mobile Experts Limited, 5 Charlotte Close,
+ * Caversham, Reading, Berkshire, United Kingdom RG4 7BY.
+ *
+ * This Original Work is licensed under the European Union Public Licence (EUPL)
+ * v.1.2 and is subject to its terms as set out below.
+ *
+ * If a copy of the EUPL was not distributed with this file, You can obtain
+ * one at https://opensource.org/licenses/EUPL-1.2.
+ *
+ * The 'Compatible Licences' set out in the Appendix to the EUPL (as may be
+ * amended by the European Commission) shall be deemed incompatible for
+ * the purposes of the Work and the provisions of the compatibility
+ * clause in Article 5 of the EUPL shall not apply.
+ *
+ * If using the Work as, or as part of, a network application, by
+ * including the attribution notice(s) required under Article 5 of the EUPL
+ * in the end user terms of the application under an appropriate heading,
+ * such notice(s) shall fulfill the requirements of that article.
+ * ********************************************************************* */
+
+package common
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// Layout of the packed Hash V4.1 data set header, see
+// fiftyoneDegreesDataSetHashHeader in the native library.
+const (
+	headerVersionOffset    = 0
+	headerNameOffset       = 58
+	headerFormatOffset     = 62
+	headerPublishedOffset  = 66
+	headerNextUpdateOffset = 70
+	headerStringsOffset    = 74
+	headerSize             = 74 + 9*12
+)
+
+// Maximum length of a string read from the strings collection
+const maxHeaderStringSize = 1024
+
+// DataFileHeader is the information stored in the header of a Hash data file.
+type DataFileHeader struct {
+	// Version of the data file format, e.g. "4.1.0.0"
+	Version string
+	// Name of the data file, e.g. "Lite"
+	Name string
+	// Name of the data file format, e.g. "HashV41"
+	Format string
+	// Date the data file was published
+	Published time.Time
+	// Date the next data file will be available
+	NextUpdate time.Time
+}
+
+// ReadDataFileHeader reads the header of a Hash V4.1 data file.
+func ReadDataFileHeader(path string) (*DataFileHeader, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, NewFileNotFoundError(path, err)
+	}
+	defer f.Close()
+	return readDataFileHeader(f)
+}
+
+func readDataFileHeader(r io.ReaderAt) (*DataFileHeader, error) {
+	buf := make([]byte, headerSize)
+	if _, err := r.ReadAt(buf, 0); err != nil {
+		return nil, fmt.Errorf("failed to read data file header: %w", err)
+	}
+	le := binary.LittleEndian
+
+	var version [4]int32
+	for i := range version {
+		version[i] = int32(le.Uint32(buf[headerVersionOffset+i*4:]))
+	}
+	if version[0] != 4 || version[1] != 1 {
+		return nil, fmt.Errorf(
+			"data file version %d.%d is not supported, expected 4.1",
+			version[0], version[1])
+	}
+
+	header := &DataFileHeader{
+		Version: fmt.Sprintf("%d.%d.%d.%d",
+			version[0], version[1], version[2], version[3]),
+		Published:  readHeaderDate(buf[headerPublishedOffset:]),
+		NextUpdate: readHeaderDate(buf[headerNextUpdateOffset:]),
+	}
+
+	// Strings are stored as a 16 bit size followed by a null terminated value
+	stringsStart := int64(le.Uint32(buf[headerStringsOffset:]))
+	readString := func(offset int64) (string, error) {
+		var size [2]byte
+		if _, err := r.ReadAt(size[:], stringsStart+offset); err != nil {
+			return "", err
+		}
+		n := int(int16(le.Uint16(size[:])))
+		if n <= 0 || n > maxHeaderStringSize {
+			return "", fmt.Errorf("invalid string size %d", n)
+		}
+		value := make([]byte, n)
+		if _, err := r.ReadAt(value, stringsStart+offset+2); err != nil {
+			return "", err
+		}
+		if value[n-1] == 0 {
+			value = value[:n-1]
+		}
+		return string(value), nil
+	}
+	var err error
+	if header.Name, err = readString(int64(le.Uint32(buf[headerNameOffset:]))); err != nil {
+		return nil, fmt.Errorf("failed to read data file name: %w", err)
+	}
+	if header.Format, err = readString(int64(le.Uint32(buf[headerFormatOffset:]))); err != nil {
+		return nil, fmt.Errorf("failed to read data file format: %w", err)
+	}
+	return header, nil
+}
+
+// readHeaderDate reads a packed date of a 16 bit year, month and day.
+func readHeaderDate(b []byte) time.Time {
+	year := int(int16(binary.LittleEndian.Uint16(b)))
+	return time.Date(year, time.Month(b[2]), int(b[3]), 0, 0, 0, 0, time.UTC)
+}
+
+// WatchDataFile calls reload each time the modification time of the data
+// file at path changes, checking every interval, so that a resource manager
+// can be reloaded when the data file is replaced. Call the returned function
+// to stop watching.
+func WatchDataFile(
+	path string,
+	interval time.Duration,
+	reload func()) (stop func()) {
+	modified := modTime(path)
+	ticker := time.NewTicker(interval)
+	done := make(chan struct{})
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				// The file may be missing while it is being replaced
+				if m := modTime(path); !m.IsZero() && !m.Equal(modified) {
+					modified = m
+					reload()
+				}
+			}
+		}
+	}()
+	var once sync.Once
+	return func() { once.Do(func() { close(done) }) }
+}
+
+// modTime returns the modification time of the file at path, or the zero
+// time if it cannot be read.
+func modTime(path string) time.Time {
+	info, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}
+	}
+	return info.ModTime()
+}
@@ -0,0 +1,124 @@
+/* *********************************************************************
+ * This Original Work is copyright of 51 Degrees Mobile Experts Limited.
+ * Copyright 2019 51 Degrees Mobile Experts Limited, 5 Charlotte Close,
+ * Caversham, Reading, Berkshire, United Kingdom RG4 7BY.
+ *
+ * This Original Work is licensed under the European Union Public Licence (EUPL)
+ * v.1.2 and is subject to its terms as set out below.
+ *
+ * If a copy of the EUPL was not distributed with this file, You can obtain
+ * one at https://opensource.org/licenses/EUPL-1.2.
+ *
+ * The 'Compatible Licences' set out in the Appendix to the EUPL (as may be
+ * amended by the European Commission) shall be deemed incompatible for
+ * the purposes of the Work and the provisions of the compatibility
+ * clause in Article 5 of the EUPL shall not apply.
+ *
+ * If using the Work as, or as part of, a network application, by
+ * including the attribution notice(s) required under Article 5 of the EUPL
+ * in the end user terms of the application under an appropriate heading,
+ * such notice(s) shall fulfill the requirements of that article.
+ * ********************************************************************* */
+
+package common
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// newTestHeader returns the bytes of a data file with the given version,
+// name and format, published on 2024-05-17 with the next update on
+// 2024-05-24.
+func newTestHeader(major, minor int32, name, format string) []byte {
+	le := binary.LittleEndian
+	buf := make([]byte, headerSize)
+	le.PutUint32(buf[headerVersionOffset:], uint32(major))
+	le.PutUint32(buf[headerVersionOffset+4:], uint32(minor))
+	le.PutUint16(buf[headerPublishedOffset:], 2024)
+	buf[headerPublishedOffset+2], buf[headerPublishedOffset+3] = 5, 17
+	le.PutUint16(buf[headerNextUpdateOffset:], 2024)
+	buf[headerNextUpdateOffset+2], buf[headerNextUpdateOffset+3] = 5, 24
+	le.PutUint32(buf[headerStringsOffset:], uint32(len(buf)))
+
+	var strs []byte
+	for i, value := range []string{name, format} {
+		le.PutUint32(buf[headerNameOffset+i*4:], uint32(len(strs)))
+		size := make([]byte, 2)
+		le.PutUint16(size, uint16(len(value)+1))
+		strs = append(strs, size...)
+		strs = append(strs, value...)
+		strs = append(strs, 0)
+	}
+	return append(buf, strs...)
+}
+
+// Test if the header of a data file is read.
+func TestReadDataFileHeader(t *testing.T) {
+	data := newTestHeader(4, 1, "Lite", "HashV41")
+	header, err := readDataFileHeader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("Failed to read header. %v", err)
+	}
+	if header.Version != "4.1.0.0" {
+		t.Errorf("Expected version '4.1.0.0' but got '%s'", header.Version)
+	}
+	if header.Name != "Lite" || header.Format != "HashV41" {
+		t.Errorf("Expected 'Lite' and 'HashV41' but got '%s' and '%s'",
+			header.Name, header.Format)
+	}
+	published := time.Date(2024, 5, 17, 0, 0, 0, 0, time.UTC)
+	if !header.Published.Equal(published) {
+		t.Errorf("Expected published %v but got %v", published, header.Published)
+	}
+	nextUpdate := time.Date(2024, 5, 24, 0, 0, 0, 0, time.UTC)
+	if !header.NextUpdate.Equal(nextUpdate) {
+		t.Errorf("Expected next update %v but got %v", nextUpdate, header.NextUpdate)
+	}
+}
+
+// Test if unsupported or truncated data files are rejected.
+func TestReadDataFileHeaderInvalid(t *testing.T) {
+	testData := map[string][]byte{
+		"version":   newTestHeader(3, 2, "Lite", "HashV41"),
+		"truncated": newTestHeader(4, 1, "Lite", "HashV41")[:headerSize/2],
+		"strings":   newTestHeader(4, 1, "Lite", "HashV41")[:headerSize+4],
+	}
+	for name, data := range testData {
+		if _, err := readDataFileHeader(bytes.NewReader(data)); err == nil {
+			t.Errorf("Expected an error for the %s data file", name)
+		}
+	}
+}
+
+// Test if a data file is reloaded when it changes, but not otherwise.
+func TestWatchDataFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "51Degrees-LiteV4.1.hash")
+	if err := os.WriteFile(path, newTestHeader(4, 1, "Lite", "HashV41"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	reloads := make(chan struct{}, 1)
+	stop := WatchDataFile(path, 10*time.Millisecond, func() {
+		reloads <- struct{}{}
+	})
+	defer stop()
+
+	select {
+	case <-reloads:
+		t.Fatal("Expected no reload before the data file changed")
+	case <-time.After(50 * time.Millisecond):
+	}
+	modified := time.Now().Add(time.Minute)
+	if err := os.Chtimes(path, modified, modified); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-reloads:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected a reload after the data file changed")
+	}
+}
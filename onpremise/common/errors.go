@@ -0,0 +1,128 @@
+/* *********************************************************************
+ * This Original Work is copyright of 51 Degrees Mobile Experts Limited.
+ * Copyright 2019 51 Degrees Mobile Experts Limited, 5 Charlotte Close,
+ * Caversham, Reading, Berkshire, United Kingdom RG4 7BY.
+ *
+ * This Original Work is licensed under the European Union Public Licence (EUPL)
+ * v.1.2 and is subject to its terms as set out below.
+ *
+ * If a copy of the EUPL was not distributed with this file, You can obtain
+ * one at https://opensource.org/licenses/EUPL-1.2.
+ *
+ * The 'Compatible Licences' set out in the Appendix to the EUPL (as may be
+ * amended by the European Commission) shall be deemed incompatible for
+ * the purposes of the Work and the provisions of the compatibility
+ * clause in Article 5 of the EUPL shall not apply.
+ *
+ * If using the Work as, or as part of, a network application, by
+ * including the attribution notice(s) required under Article 5 of the EUPL
+ * in the end user terms of the application under an appropriate heading,
+ * such notice(s) shall fulfill the requirements of that article.
+ * ********************************************************************* */
+
+package common
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"strings"
+)
+
+// FileNotFoundError is returned when none of the files looked for exist.
+// It matches fs.ErrNotExist when used with errors.Is.
+type FileNotFoundError struct {
+	Dir   string
+	Names []string
+}
+
+func (e *FileNotFoundError) Error() string {
+	return fmt.Sprintf("could not find any file that matches any of \"%s\" at path \"%s\"",
+		strings.Join(e.Names, ", "), e.Dir)
+}
+
+func (e *FileNotFoundError) Unwrap() error {
+	return fs.ErrNotExist
+}
+
+// NewFileNotFoundError returns a FileNotFoundError if err indicates that the
+// file at path does not exist, otherwise err is returned unchanged.
+func NewFileNotFoundError(path string, err error) error {
+	if errors.Is(err, fs.ErrNotExist) {
+		dir, file := filepath.Split(path)
+		return &FileNotFoundError{Dir: dir, Names: []string{file}}
+	}
+	return err
+}
+
+// DecodeError is returned when an evidence record cannot be read. Record is
+// the 1-based number of the record within the file. If the cause is a
+// MalformedKeyError or UnknownPrefixError the source can continue to be read
+// to skip the record.
+type DecodeError struct {
+	Path   string
+	Record int
+	Err    error
+}
+
+func (e *DecodeError) Error() string {
+	if e.Path == "" {
+		return fmt.Sprintf("failed to decode record %d: %v", e.Record, e.Err)
+	}
+	return fmt.Sprintf("failed to decode record %d of \"%s\": %v",
+		e.Record, e.Path, e.Err)
+}
+
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
+
+// MalformedKeyError is returned when an evidence key is not in the
+// 'prefix.key' format, i.e. it does not contain a '.' after the prefix.
+// Record is the 1-based number of the record containing the key when it was
+// read by an evidence source, otherwise 0.
+type MalformedKeyError struct {
+	Key    string
+	Record int
+}
+
+func (e *MalformedKeyError) Error() string {
+	return fmt.Sprintf("evidence key '%s'%s must be in the 'prefix.key' format",
+		e.Key, recordPosition(e.Record))
+}
+
+// UnknownPrefixError is returned in strict mode when an evidence key has a
+// prefix which is not understood by the native library. Record is the
+// 1-based number of the record containing the key when it was read by an
+// evidence source, otherwise 0.
+type UnknownPrefixError struct {
+	Key    string
+	Prefix string
+	Record int
+}
+
+func (e *UnknownPrefixError) Error() string {
+	return fmt.Sprintf("evidence key '%s'%s has unknown prefix '%s'",
+		e.Key, recordPosition(e.Record), e.Prefix)
+}
+
+// recordPosition describes the record of an evidence key, if known.
+func recordPosition(record int) string {
+	if record == 0 {
+		return ""
+	}
+	return fmt.Sprintf(" in record %d", record)
+}
+
+// setKeyErrorRecord sets the record of an evidence key error.
+func setKeyErrorRecord(err error, record int) {
+	var malformed *MalformedKeyError
+	if errors.As(err, &malformed) {
+		malformed.Record = record
+	}
+	var unknown *UnknownPrefixError
+	if errors.As(err, &unknown) {
+		unknown.Record = record
+	}
+}
@@ -0,0 +1,135 @@
+/* *********************************************************************
+ * This Original Work is copyright of 51 Degrees Mobile Experts Limited.
+ * Copyright 2019 51 Degrees Mobile Experts Limited, 5 Charlotte Close,
+ * Caversham, Reading, Berkshire, United Kingdom RG4 7BY.
+ *
+ * This Original Work is licensed under the European Union Public Licence (EUPL)
+ * v.1.2 and is subject to its terms as set out below.
+ *
+ * If a copy of the EUPL was not distributed with this file, You can obtain
+ * one at https://opensource.org/licenses/EUPL-1.2.
+ *
+ * The 'Compatible Licences' set out in the Appendix to the EUPL (as may be
+ * amended by the European Commission) shall be deemed incompatible for
+ * the purposes of the Work and the provisions of the compatibility
+ * clause in Article 5 of the EUPL shall not apply.
+ *
+ * If using the Work as, or as part of, a network application, by
+ * including the attribution notice(s) required under Article 5 of the EUPL
+ * in the end user terms of the application under an appropriate heading,
+ * such notice(s) shall fulfill the requirements of that article.
+ * ********************************************************************* */
+
+package common
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/51Degrees/device-detection-go/v4/dd"
+	"github.com/51Degrees/device-detection-go/v4/onpremise"
+)
+
+// KeyMode controls how evidence keys which cannot be parsed are handled.
+type KeyMode int
+
+// Supported key modes
+const (
+	// Reject the evidence if any key is malformed or has an unknown prefix
+	KeysStrict KeyMode = iota
+	// Skip keys which are malformed or have an unknown prefix and record them
+	// in the report
+	KeysTolerant
+)
+
+// Evidence prefixes understood by the native library
+var evidencePrefixes = map[string]dd.EvidencePrefix{
+	"header": dd.HttpHeaderString,
+	"query":  dd.HttpEvidenceQuery,
+	"cookie": dd.HttpEvidenceCookie,
+	// Server values such as the client IP
+	"server": dd.HttpEvidenceServer,
+	// IP addresses in headers such as X-Forwarded-For
+	"ip": dd.HttpIpAddresses,
+}
+
+// SkippedKey is an evidence key which was skipped in tolerant mode and the
+// reason it was skipped.
+type SkippedKey struct {
+	Key string
+	Err error
+}
+
+// ParseReport records the evidence keys skipped in tolerant mode.
+type ParseReport struct {
+	Skipped []SkippedKey
+}
+
+// ParseEvidenceKey splits an evidence key in the 'prefix.key' format into its
+// prefix and key. Prefixes are case insensitive. A MalformedKeyError is
+// returned if there is no prefix and an UnknownPrefixError if the prefix is
+// not supported.
+func ParseEvidenceKey(k string) (dd.EvidencePrefix, string, error) {
+	prefixStr, key, found := strings.Cut(k, ".")
+	if !found || prefixStr == "" || key == "" {
+		return 0, "", &MalformedKeyError{Key: k}
+	}
+	prefix, ok := evidencePrefixes[strings.ToLower(prefixStr)]
+	if !ok {
+		return 0, "", &UnknownPrefixError{Key: k, Prefix: prefixStr}
+	}
+	return prefix, key, nil
+}
+
+// EvidenceKeyString returns an evidence key in the 'prefix.key' format.
+func EvidenceKeyString(key dd.EvidenceKey) string {
+	for name, prefix := range evidencePrefixes {
+		if prefix == key.Prefix {
+			return name + "." + key.Key
+		}
+	}
+	return "header." + key.Key
+}
+
+// ParseEvidence converts evidence values keyed by 'prefix.key', as used in the
+// Evidence Records file, to evidence in strict mode.
+func ParseEvidence(values map[string]string) ([]onpremise.Evidence, error) {
+	return ParseEvidenceMode(values, KeysStrict, nil)
+}
+
+// ParseEvidenceMode converts evidence values keyed by 'prefix.key' to
+// evidence. Keys are processed in sorted order so that the evidence and any
+// error are the same for the same values. In strict mode the first key which
+// cannot be parsed is returned as an error. In tolerant mode such keys are
+// skipped and added to the report if one is provided.
+func ParseEvidenceMode(
+	values map[string]string,
+	mode KeyMode,
+	report *ParseReport) ([]onpremise.Evidence, error) {
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	evidence := make([]onpremise.Evidence, 0, len(values))
+	for _, k := range keys {
+		prefix, key, err := ParseEvidenceKey(k)
+		if err != nil {
+			if mode == KeysStrict {
+				return nil, err
+			}
+			if report != nil {
+				report.Skipped = append(report.Skipped, SkippedKey{k, err})
+			}
+			continue
+		}
+		evidence = append(evidence,
+			onpremise.Evidence{
+				Prefix: prefix,
+				Key:    key,
+				Value:  values[k],
+			})
+	}
+	return evidence, nil
+}
@@ -0,0 +1,106 @@
+/* *********************************************************************
+ * This Original Work is copyright of 51 Degrees Mobile Experts Limited.
+ * Copyright 2019 51 Degrees Mobile Experts Limited, 5 Charlotte Close,
+ * Caversham, Reading, Berkshire, United Kingdom RG4 7BY.
+ *
+ * This Original Work is licensed under the European Union Public Licence (EUPL)
+ * v.1.2 and is subject to its terms as set out below.
+ *
+ * If a copy of the EUPL was not distributed with this file, You can obtain
+ * one at https://opensource.org/licenses/EUPL-1.2.
+ *
+ * The 'Compatible Licences' set out in the Appendix to the EUPL (as may be
+ * amended by the European Commission) shall be deemed incompatible for
+ * the purposes of the Work and the provisions of the compatibility
+ * clause in Article 5 of the EUPL shall not apply.
+ *
+ * If using the Work as, or as part of, a network application, by
+ * including the attribution notice(s) required under Article 5 of the EUPL
+ * in the end user terms of the application under an appropriate heading,
+ * such notice(s) shall fulfill the requirements of that article.
+ * ********************************************************************* */
+
+package common
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/51Degrees/device-detection-go/v4/dd"
+)
+
+// Test if all prefixes understood by the native library are parsed.
+func TestParseEvidenceKey(t *testing.T) {
+	testData := []struct {
+		key    string
+		prefix dd.EvidencePrefix
+		name   string
+	}{
+		{"header.User-Agent", dd.HttpHeaderString, "User-Agent"},
+		{"query.sec-ch-ua", dd.HttpEvidenceQuery, "sec-ch-ua"},
+		{"cookie.51D_ScreenPixelsWidth", dd.HttpEvidenceCookie, "51D_ScreenPixelsWidth"},
+		{"server.client-ip", dd.HttpEvidenceServer, "client-ip"},
+		{"ip.X-Forwarded-For", dd.HttpIpAddresses, "X-Forwarded-For"},
+		{"Header.user-agent", dd.HttpHeaderString, "user-agent"},
+		{"header.x.y", dd.HttpHeaderString, "x.y"},
+	}
+
+	for _, data := range testData {
+		prefix, name, err := ParseEvidenceKey(data.key)
+		if err != nil {
+			t.Errorf("Failed to parse '%s': %v", data.key, err)
+			continue
+		}
+		if prefix != data.prefix || name != data.name {
+			t.Errorf("Expected '%s' to parse to %d '%s' but got %d '%s'",
+				data.key, data.prefix, data.name, prefix, name)
+		}
+	}
+}
+
+// Test if keys which cannot be parsed are reported with the right error.
+func TestParseEvidenceKeyError(t *testing.T) {
+	var keyErr *MalformedKeyError
+	for _, key := range []string{"user-agent", ".user-agent", "header."} {
+		if _, _, err := ParseEvidenceKey(key); !errors.As(err, &keyErr) {
+			t.Errorf("Expected malformed key error for '%s' but got: %v", key, err)
+		}
+	}
+
+	var prefixErr *UnknownPrefixError
+	_, _, err := ParseEvidenceKey("body.user-agent")
+	if !errors.As(err, &prefixErr) || prefixErr.Prefix != "body" {
+		t.Errorf("Expected unknown prefix error but got: %v", err)
+	}
+}
+
+// Test if strict mode rejects the evidence and tolerant mode skips the keys.
+func TestParseEvidenceMode(t *testing.T) {
+	values := map[string]string{
+		"header.user-agent": testUA,
+		"query.sec-ch-ua":   "test",
+		"body.user-agent":   "test",
+		"user-agent":        "test",
+	}
+
+	if _, err := ParseEvidenceMode(values, KeysStrict, nil); err == nil {
+		t.Errorf("Expected strict mode to reject the evidence")
+	}
+
+	var report ParseReport
+	evidence, err := ParseEvidenceMode(values, KeysTolerant, &report)
+	if err != nil {
+		t.Fatalf("Expected tolerant mode to accept the evidence but got: %v", err)
+	}
+	if len(evidence) != 2 {
+		t.Errorf("Expected 2 evidence but got %d", len(evidence))
+	}
+	if evidence[0].Key != "user-agent" || evidence[1].Key != "sec-ch-ua" {
+		t.Errorf("Expected evidence in key order but got %v", evidence)
+	}
+	if len(report.Skipped) != 2 ||
+		report.Skipped[0].Key != "body.user-agent" ||
+		report.Skipped[1].Key != "user-agent" {
+		t.Errorf("Expected 2 skipped keys but got %v", report.Skipped)
+	}
+}
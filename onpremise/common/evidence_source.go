@@ -0,0 +1,466 @@
+/* *********************************************************************
+ * This Original Work is copyright of 51 Degrees Mobile Experts Limited.
+ * Copyright 2019 51 Degrees Mobile Experts Limited, 5 Charlotte Close,
+ * Caversham, Reading, Berkshire, United Kingdom RG4 7BY.
+ *
+ * This Original Work is licensed under the European Union Public Licence (EUPL)
+ * v.1.2 and is subject to its terms as set out below.
+ *
+ * If a copy of the EUPL was not distributed with this file, You can obtain
+ * one at https://opensource.org/licenses/EUPL-1.2.
+ *
+ * The 'Compatible Licences' set out in the Appendix to the EUPL (as may be
+ * amended by the European Commission) shall be deemed incompatible for
+ * the purposes of the Work and the provisions of the compatibility
+ * clause in Article 5 of the EUPL shall not apply.
+ *
+ * If using the Work as, or as part of, a network application, by
+ * including the attribution notice(s) required under Article 5 of the EUPL
+ * in the end user terms of the application under an appropriate heading,
+ * such notice(s) shall fulfill the requirements of that article.
+ * ********************************************************************* */
+
+package common
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/51Degrees/device-detection-go/v4/dd"
+	"github.com/51Degrees/device-detection-go/v4/onpremise"
+	"gopkg.in/yaml.v3"
+)
+
+// EvidenceFormat identifies the layout of an evidence file.
+type EvidenceFormat int
+
+// Supported evidence file formats
+const (
+	// Detect the format from the file extension and content
+	FormatAuto EvidenceFormat = iota
+	// Multi-document YAML where each document maps 'prefix.key' to a value,
+	// as used by "20000 Evidence Records.yml"
+	FormatYAML
+	// CSV with a header row of 'prefix.key' column names
+	FormatCSV
+	// One JSON object per line mapping 'prefix.key' to a value
+	FormatJSONLines
+	// One User-Agent per line, as used by "20000 User Agents.csv"
+	FormatUserAgents
+)
+
+// String returns the name of the format.
+func (f EvidenceFormat) String() string {
+	switch f {
+	case FormatAuto:
+		return "auto"
+	case FormatYAML:
+		return "yaml"
+	case FormatCSV:
+		return "csv"
+	case FormatJSONLines:
+		return "jsonl"
+	case FormatUserAgents:
+		return "user-agents"
+	}
+	return fmt.Sprintf("EvidenceFormat(%d)", int(f))
+}
+
+// ParseEvidenceFormat returns the format with the name returned by String,
+// ignoring case.
+func ParseEvidenceFormat(name string) (EvidenceFormat, error) {
+	for f := FormatAuto; f <= FormatUserAgents; f++ {
+		if strings.EqualFold(name, f.String()) {
+			return f, nil
+		}
+	}
+	return FormatAuto, fmt.Errorf("unknown evidence format '%s'", name)
+}
+
+// Maximum size of a single line in the line based formats
+const maxLineSize = 1024 * 1024
+
+// Number of bytes inspected when detecting the format from content
+const sniffSize = 4096
+
+// EvidenceSource streams evidence records from an underlying reader. Next
+// returns io.EOF once all records have been read. A record which cannot be
+// read is reported as a DecodeError.
+type EvidenceSource interface {
+	Next() ([]onpremise.Evidence, error)
+	Close() error
+}
+
+// OpenEvidenceSource opens an evidence file and detects its format from the
+// file extension and content.
+func OpenEvidenceSource(path string) (EvidenceSource, error) {
+	return OpenEvidenceSourceFormat(path, FormatAuto)
+}
+
+// OpenEvidenceSourceFormat opens an evidence file of the given format. If the
+// format is FormatAuto it is detected from the file extension and content.
+func OpenEvidenceSourceFormat(
+	path string,
+	format EvidenceFormat) (EvidenceSource, error) {
+	return OpenEvidenceSourceMode(path, format, KeysStrict, nil)
+}
+
+// OpenEvidenceSourceMode is OpenEvidenceSourceFormat with the evidence keys of
+// each record parsed in the given mode, see ParseEvidenceMode. In tolerant
+// mode the skipped keys are added to the report if one is provided, with the
+// record in their errors.
+func OpenEvidenceSourceMode(
+	path string,
+	format EvidenceFormat,
+	mode KeyMode,
+	report *ParseReport) (EvidenceSource, error) {
+	file, err := os.OpenFile(path, os.O_RDONLY, 0444)
+	if err != nil {
+		return nil, NewFileNotFoundError(path, err)
+	}
+
+	r := bufio.NewReader(file)
+	if format == FormatAuto {
+		peek, _ := r.Peek(sniffSize)
+		format = DetectEvidenceFormat(path, peek)
+	}
+
+	base := sourceBase{closer: file, path: path, mode: mode, report: report}
+	src, err := newEvidenceSource(r, format, base)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return src, nil
+}
+
+// NewEvidenceSource creates an evidence source reading records of the given
+// format from r. If the format is FormatAuto it is detected from the content.
+// Closing the source does not close r.
+func NewEvidenceSource(
+	r io.Reader,
+	format EvidenceFormat) (EvidenceSource, error) {
+	return NewEvidenceSourceMode(r, format, KeysStrict, nil)
+}
+
+// NewEvidenceSourceMode is NewEvidenceSource with the evidence keys of each
+// record parsed in the given mode, see OpenEvidenceSourceMode.
+func NewEvidenceSourceMode(
+	r io.Reader,
+	format EvidenceFormat,
+	mode KeyMode,
+	report *ParseReport) (EvidenceSource, error) {
+	br := bufio.NewReader(r)
+	if format == FormatAuto {
+		peek, _ := br.Peek(sniffSize)
+		format = DetectEvidenceFormat("", peek)
+	}
+	return newEvidenceSource(br, format, sourceBase{mode: mode, report: report})
+}
+
+func newEvidenceSource(
+	r io.Reader,
+	format EvidenceFormat,
+	base sourceBase) (EvidenceSource, error) {
+	switch format {
+	case FormatYAML:
+		return &yamlEvidenceSource{yaml.NewDecoder(r), base}, nil
+	case FormatCSV:
+		return newCSVEvidenceSource(r, base)
+	case FormatJSONLines:
+		return &jsonLinesEvidenceSource{newLineScanner(r), base}, nil
+	case FormatUserAgents:
+		return &userAgentEvidenceSource{newLineScanner(r), base}, nil
+	}
+	return nil, fmt.Errorf("unsupported evidence format %s", format)
+}
+
+// DetectEvidenceFormat determines the format of an evidence file from its
+// path and the first bytes of its content. The path may be empty if only the
+// content is known.
+func DetectEvidenceFormat(path string, peek []byte) EvidenceFormat {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yml", ".yaml":
+		return FormatYAML
+	case ".jsonl", ".ndjson":
+		return FormatJSONLines
+	case ".csv":
+		// The User-Agents file is also a .csv, so check whether the first
+		// line is a header of evidence keys.
+		if isEvidenceHeader(firstLine(peek)) {
+			return FormatCSV
+		}
+		return FormatUserAgents
+	}
+
+	// Fall back to inspecting the content
+	line := strings.TrimSpace(firstLine(bytes.TrimLeft(peek, " \t\r\n")))
+	switch {
+	case strings.HasPrefix(line, "{"):
+		return FormatJSONLines
+	case line == "---" || isYAMLEvidenceEntry(line):
+		return FormatYAML
+	case isEvidenceHeader(line):
+		return FormatCSV
+	}
+	return FormatUserAgents
+}
+
+// firstLine returns the first line of the content without the line ending.
+func firstLine(content []byte) string {
+	if i := bytes.IndexByte(content, '\n'); i >= 0 {
+		content = content[:i]
+	}
+	return strings.TrimSuffix(string(content), "\r")
+}
+
+// isEvidenceKey checks if a string is in the 'prefix.key' format used by the
+// evidence files.
+func isEvidenceKey(key string) bool {
+	_, _, err := ParseEvidenceKey(key)
+	return err == nil
+}
+
+// isEvidenceHeader checks if a CSV line only contains evidence keys.
+func isEvidenceHeader(line string) bool {
+	if line == "" {
+		return false
+	}
+	for _, column := range strings.Split(line, ",") {
+		if !isEvidenceKey(strings.Trim(strings.TrimSpace(column), "\"")) {
+			return false
+		}
+	}
+	return true
+}
+
+// isYAMLEvidenceEntry checks if a line is a 'prefix.key: value' YAML entry.
+func isYAMLEvidenceEntry(line string) bool {
+	key, _, found := strings.Cut(line, ":")
+	return found && isEvidenceKey(strings.TrimSpace(key))
+}
+
+// newLineScanner creates a scanner which allows long lines.
+func newLineScanner(r io.Reader) *bufio.Scanner {
+	s := bufio.NewScanner(r)
+	s.Buffer(make([]byte, 0, 64*1024), maxLineSize)
+	return s
+}
+
+// State shared by all evidence sources
+type sourceBase struct {
+	// Underlying file, if any
+	closer io.Closer
+	// Path of the underlying file, if any
+	path string
+	// Number of records read so far
+	record int
+	// How evidence keys which cannot be parsed are handled
+	mode KeyMode
+	// Report of the keys skipped in tolerant mode, if any
+	report *ParseReport
+}
+
+// Close closes the underlying file if there is one.
+func (s *sourceBase) Close() error {
+	if s.closer == nil {
+		return nil
+	}
+	return s.closer.Close()
+}
+
+// decodeError returns a DecodeError for the current record.
+func (s *sourceBase) decodeError(err error) error {
+	return &DecodeError{Path: s.path, Record: s.record, Err: err}
+}
+
+// parse moves on to the next record and converts its values to evidence.
+// Evidence key errors are positioned at the record.
+func (s *sourceBase) parse(values map[string]string) ([]onpremise.Evidence, error) {
+	s.record++
+	var report ParseReport
+	evidence, err := ParseEvidenceMode(values, s.mode, &report)
+	if err != nil {
+		setKeyErrorRecord(err, s.record)
+		return nil, s.decodeError(err)
+	}
+	if s.report != nil {
+		for _, skipped := range report.Skipped {
+			setKeyErrorRecord(skipped.Err, s.record)
+			s.report.Skipped = append(s.report.Skipped, skipped)
+		}
+	}
+	return evidence, nil
+}
+
+// Reads multi-document YAML evidence records
+type yamlEvidenceSource struct {
+	dec *yaml.Decoder
+	sourceBase
+}
+
+func (s *yamlEvidenceSource) Next() ([]onpremise.Evidence, error) {
+	for {
+		var doc map[string]string
+		if err := s.dec.Decode(&doc); err == io.EOF {
+			return nil, err
+		} else if err != nil {
+			s.record++
+			return nil, s.decodeError(err)
+		}
+		// Skip empty documents such as the one before a trailing '...'
+		if len(doc) > 0 {
+			return s.parse(doc)
+		}
+	}
+}
+
+// Reads CSV evidence records with a header row of evidence keys
+type csvEvidenceSource struct {
+	reader *csv.Reader
+	keys   []string
+	sourceBase
+}
+
+func newCSVEvidenceSource(
+	r io.Reader,
+	base sourceBase) (*csvEvidenceSource, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	keys, err := reader.Read()
+	if err == io.EOF {
+		return nil, fmt.Errorf("CSV evidence has no header row")
+	} else if err != nil {
+		return nil, err
+	}
+	for i := range keys {
+		keys[i] = strings.TrimSpace(keys[i])
+	}
+	return &csvEvidenceSource{reader, keys, base}, nil
+}
+
+func (s *csvEvidenceSource) Next() ([]onpremise.Evidence, error) {
+	record, err := s.reader.Read()
+	if err == io.EOF {
+		return nil, err
+	} else if err != nil {
+		s.record++
+		return nil, s.decodeError(err)
+	}
+	doc := make(map[string]string, len(s.keys))
+	for i, value := range record {
+		// Empty columns carry no evidence
+		if i < len(s.keys) && value != "" {
+			doc[s.keys[i]] = value
+		}
+	}
+	return s.parse(doc)
+}
+
+// Reads evidence records stored as one JSON object per line
+type jsonLinesEvidenceSource struct {
+	scanner *bufio.Scanner
+	sourceBase
+}
+
+func (s *jsonLinesEvidenceSource) Next() ([]onpremise.Evidence, error) {
+	for s.scanner.Scan() {
+		line := bytes.TrimSpace(s.scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		var doc map[string]string
+		if err := json.Unmarshal(line, &doc); err != nil {
+			s.record++
+			return nil, s.decodeError(err)
+		}
+		return s.parse(doc)
+	}
+	if err := s.scanner.Err(); err != nil {
+		s.record++
+		return nil, s.decodeError(err)
+	}
+	return nil, io.EOF
+}
+
+// Reads one User-Agent per line
+type userAgentEvidenceSource struct {
+	scanner *bufio.Scanner
+	sourceBase
+}
+
+func (s *userAgentEvidenceSource) Next() ([]onpremise.Evidence, error) {
+	for s.scanner.Scan() {
+		ua := strings.TrimSpace(s.scanner.Text())
+		if ua == "" {
+			continue
+		}
+		s.record++
+		return []onpremise.Evidence{
+			{Prefix: dd.HttpHeaderString, Key: "User-Agent", Value: ua},
+		}, nil
+	}
+	if err := s.scanner.Err(); err != nil {
+		s.record++
+		return nil, s.decodeError(err)
+	}
+	return nil, io.EOF
+}
+
+// ForEachEvidence calls fn for each record in the source until the source is
+// exhausted or fn returns an error.
+func ForEachEvidence(
+	src EvidenceSource,
+	fn func(evidence []onpremise.Evidence) error) error {
+	for {
+		evidence, err := src.Next()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if err := fn(evidence); err != nil {
+			return err
+		}
+	}
+}
+
+// ReadAllEvidence reads all evidence records from a file so that they can be
+// reused for multiple iterations.
+func ReadAllEvidence(path string) ([][]onpremise.Evidence, error) {
+	src, err := OpenEvidenceSource(path)
+	if err != nil {
+		return nil, err
+	}
+	defer src.Close()
+
+	var res [][]onpremise.Evidence
+	err = ForEachEvidence(src, func(evidence []onpremise.Evidence) error {
+		res = append(res, evidence)
+		return nil
+	})
+	return res, err
+}
+
+// CountEvidence counts the number of evidence records in a file.
+func CountEvidence(path string) (uint64, error) {
+	src, err := OpenEvidenceSource(path)
+	if err != nil {
+		return 0, err
+	}
+	defer src.Close()
+
+	var count uint64
+	err = ForEachEvidence(src, func(evidence []onpremise.Evidence) error {
+		count++
+		return nil
+	})
+	return count, err
+}
@@ -0,0 +1,267 @@
+/* *********************************************************************
+ * This Original Work is copyright of 51 Degrees Mobile Experts Limited.
+ * Copyright 2019 51 Degrees Mobile Experts Limited, 5 Charlotte Close,
+ * Caversham, Reading, Berkshire, United Kingdom RG4 7BY.
+ *
+ * This Original Work is licensed under the European Union Public Licence (EUPL)
+ * v.1.2 and is subject to its terms as set out below.
+ *
+ * If a copy of the EUPL was not distributed with this file, You can obtain
+ * one at https://opensource.org/licenses/EUPL-1.2.
+ *
+ * The 'Compatible Licences' set out in the Appendix to the EUPL (as may be
+ * amended by the European Commission) shall be deemed incompatible for
+ * the purposes of the Work and the provisions of the compatibility
+ * clause in Article 5 of the EUPL shall not apply.
+ *
+ * If using the Work as, or as part of, a network application, by
+ * including the attribution notice(s) required under Article 5 of the EUPL
+ * in the end user terms of the application under an appropriate heading,
+ * such notice(s) shall fulfill the requirements of that article.
+ * ********************************************************************* */
+
+package common
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/51Degrees/device-detection-go/v4/dd"
+	"github.com/51Degrees/device-detection-go/v4/onpremise"
+)
+
+const testUA = "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/124.0.0.0 Safari/537.36"
+
+// Test if the format is detected from the file extension and content.
+func TestDetectEvidenceFormat(t *testing.T) {
+	testData := []struct {
+		path     string
+		content  string
+		expected EvidenceFormat
+	}{
+		{"20000 Evidence Records.yml", "", FormatYAML},
+		{"records.yaml", "", FormatYAML},
+		{"records.jsonl", "", FormatJSONLines},
+		{"20000 User Agents.csv", testUA + "\n", FormatUserAgents},
+		{"records.csv", "header.user-agent,query.sec-ch-ua\n", FormatCSV},
+		{"", "---\nheader.user-agent: test\n", FormatYAML},
+		{"", "header.user-agent: test\n", FormatYAML},
+		{"", "{\"header.user-agent\":\"test\"}\n", FormatJSONLines},
+		{"", "header.user-agent,header.sec-ch-ua\n", FormatCSV},
+		{"", testUA + "\n", FormatUserAgents},
+	}
+
+	for _, data := range testData {
+		format := DetectEvidenceFormat(data.path, []byte(data.content))
+		if format != data.expected {
+			t.Errorf("Expected format '%s' for '%s' but got '%s'",
+				data.expected, data.path, format)
+		}
+	}
+}
+
+// Test if each format yields the same evidence records.
+func TestEvidenceSource(t *testing.T) {
+	testData := []struct {
+		name    string
+		content string
+	}{
+		{
+			"yaml",
+			"---\n" +
+				"header.user-agent: '" + testUA + "'\n" +
+				"query.sec-ch-ua-mobile: '?0'\n" +
+				"---\n" +
+				"header.user-agent: curl/7.80.0\n" +
+				"...\n",
+		},
+		{
+			"csv",
+			"header.user-agent,query.sec-ch-ua-mobile\n" +
+				"\"" + testUA + "\",?0\n" +
+				"curl/7.80.0,\n",
+		},
+		{
+			"jsonl",
+			"{\"header.user-agent\":\"" + testUA + "\",\"query.sec-ch-ua-mobile\":\"?0\"}\n" +
+				"\n" +
+				"{\"header.user-agent\":\"curl/7.80.0\"}\n",
+		},
+	}
+
+	for _, data := range testData {
+		src, err := NewEvidenceSource(strings.NewReader(data.content), FormatAuto)
+		if err != nil {
+			t.Fatalf("Failed to create '%s' source: %v", data.name, err)
+		}
+		var records [][]onpremise.Evidence
+		err = ForEachEvidence(src, func(evidence []onpremise.Evidence) error {
+			records = append(records, evidence)
+			return nil
+		})
+		src.Close()
+		if err != nil {
+			t.Fatalf("Failed to read '%s' source: %v", data.name, err)
+		}
+
+		if len(records) != 2 {
+			t.Fatalf("Expected 2 records from '%s' but got %d",
+				data.name, len(records))
+		}
+		if !containsEvidence(records[0], dd.HttpHeaderString, "user-agent", testUA) {
+			t.Errorf("Expected User-Agent evidence in first '%s' record", data.name)
+		}
+		if !containsEvidence(records[0], dd.HttpEvidenceQuery, "sec-ch-ua-mobile", "?0") {
+			t.Errorf("Expected query evidence in first '%s' record", data.name)
+		}
+		if containsEvidence(records[1], dd.HttpEvidenceQuery, "sec-ch-ua-mobile", "") {
+			t.Errorf("Unexpected query evidence in second '%s' record", data.name)
+		}
+	}
+}
+
+// Test if a User-Agents file yields one header evidence per line.
+func TestUserAgentEvidenceSource(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "user-agents.csv")
+	content := testUA + "\r\n\r\ncurl/7.80.0\n"
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write test file: %v", err)
+	}
+
+	records, err := ReadAllEvidence(path)
+	if err != nil {
+		t.Fatalf("Failed to read evidence: %v", err)
+	}
+	if len(records) != 2 {
+		t.Fatalf("Expected 2 records but got %d", len(records))
+	}
+	if !containsEvidence(records[1], dd.HttpHeaderString, "User-Agent", "curl/7.80.0") {
+		t.Errorf("Expected User-Agent evidence but got %v", records[1])
+	}
+
+	count, err := CountEvidence(path)
+	if err != nil || count != 2 {
+		t.Errorf("Expected count 2 but got %d (%v)", count, err)
+	}
+}
+
+// Test if a decode error is returned rather than terminating.
+func TestEvidenceSourceDecodeError(t *testing.T) {
+	src, err := NewEvidenceSource(
+		strings.NewReader("{\"header.user-agent\":\"test\"}\n{not json}\n"),
+		FormatJSONLines)
+	if err != nil {
+		t.Fatalf("Failed to create source: %v", err)
+	}
+	defer src.Close()
+
+	if _, err := src.Next(); err != nil {
+		t.Fatalf("Expected first record to decode but got: %v", err)
+	}
+	_, err = src.Next()
+	var decodeErr *DecodeError
+	if !errors.As(err, &decodeErr) {
+		t.Fatalf("Expected decode error for second record but got: %v", err)
+	}
+	if decodeErr.Record != 2 {
+		t.Errorf("Expected decode error at record 2 but got %d", decodeErr.Record)
+	}
+}
+
+// Test if a record with a malformed key can be skipped.
+func TestEvidenceSourceMalformedKey(t *testing.T) {
+	src, err := NewEvidenceSource(
+		strings.NewReader("{\"user-agent\":\"test\"}\n{\"header.user-agent\":\"test\"}\n"),
+		FormatJSONLines)
+	if err != nil {
+		t.Fatalf("Failed to create source: %v", err)
+	}
+	defer src.Close()
+
+	_, err = src.Next()
+	var keyErr *MalformedKeyError
+	if !errors.As(err, &keyErr) || keyErr.Key != "user-agent" {
+		t.Fatalf("Expected malformed key error but got: %v", err)
+	}
+	if keyErr.Record != 1 {
+		t.Errorf("Expected malformed key in record 1 but got %d", keyErr.Record)
+	}
+	evidence, err := src.Next()
+	if err != nil {
+		t.Fatalf("Expected second record to decode but got: %v", err)
+	}
+	if !containsEvidence(evidence, dd.HttpHeaderString, "user-agent", "test") {
+		t.Errorf("Expected User-Agent evidence but got %v", evidence)
+	}
+}
+
+// Test if keys which cannot be parsed are skipped in tolerant mode and
+// reported with their record.
+func TestEvidenceSourceTolerant(t *testing.T) {
+	var report ParseReport
+	src, err := NewEvidenceSourceMode(
+		strings.NewReader("{\"header.user-agent\":\"a\"}\n"+
+			"{\"header.user-agent\":\"b\",\"body.user-agent\":\"b\"}\n"),
+		FormatJSONLines,
+		KeysTolerant,
+		&report)
+	if err != nil {
+		t.Fatalf("Failed to create source: %v", err)
+	}
+	defer src.Close()
+
+	for _, ua := range []string{"a", "b"} {
+		evidence, err := src.Next()
+		if err != nil {
+			t.Fatalf("Expected record to decode but got: %v", err)
+		}
+		if !containsEvidence(evidence, dd.HttpHeaderString, "user-agent", ua) {
+			t.Errorf("Expected User-Agent '%s' but got %v", ua, evidence)
+		}
+	}
+	if len(report.Skipped) != 1 || report.Skipped[0].Key != "body.user-agent" {
+		t.Fatalf("Expected 'body.user-agent' to be skipped but got %v",
+			report.Skipped)
+	}
+	var prefixErr *UnknownPrefixError
+	if !errors.As(report.Skipped[0].Err, &prefixErr) || prefixErr.Record != 2 {
+		t.Errorf("Expected unknown prefix in record 2 but got: %v",
+			report.Skipped[0].Err)
+	}
+}
+
+// Test if a missing file is reported as a FileNotFoundError.
+func TestOpenEvidenceSourceNotFound(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "missing.yml")
+	_, err := OpenEvidenceSource(path)
+	var notFoundErr *FileNotFoundError
+	if !errors.As(err, &notFoundErr) {
+		t.Fatalf("Expected file not found error but got: %v", err)
+	}
+	if !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Expected error to match fs.ErrNotExist")
+	}
+	if _, err := CountEvidence(path); !errors.As(err, &notFoundErr) {
+		t.Errorf("Expected file not found error from count but got: %v", err)
+	}
+}
+
+// containsEvidence checks if the evidence contains the key with the prefix.
+// Keys are compared case insensitively and an empty value matches any value.
+func containsEvidence(
+	evidence []onpremise.Evidence,
+	prefix dd.EvidencePrefix,
+	key string,
+	value string) bool {
+	for _, e := range evidence {
+		if e.Prefix == prefix && strings.EqualFold(e.Key, key) &&
+			(value == "" || e.Value == value) {
+			return true
+		}
+	}
+	return false
+}
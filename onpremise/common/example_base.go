@@ -2,7 +2,6 @@ package common
 
 import (
 	"os"
-	"strings"
 
 	"github.com/51Degrees/device-detection-go/v4/dd"
 	"github.com/51Degrees/device-detection-go/v4/onpremise"
@@ -62,25 +61,12 @@ var ExampleEvidenceMediaHub = []onpremise.Evidence{
 	{Prefix: dd.HttpHeaderString, Key: "User-Agent", Value: "Mozilla/5.0 (Linux; U; Android 4.4.2; en-us; A464BG Build/KOT49H) AppleWebKit/537.36 (KHTML, like Gecko) Version/4.0 Mobile Safari/537.36"},
 }
 
+// ConvertToEvidence converts evidence values keyed by 'prefix.key' to
+// evidence, skipping any key which is malformed or has an unknown prefix.
+//
+// Deprecated: use ParseEvidence, which reports such keys as an error.
 func ConvertToEvidence(values map[string]string) []onpremise.Evidence {
-	evidence := make([]onpremise.Evidence, len(values))
-	for k, v := range values {
-		strSplit := strings.SplitN(k, ".", 2)
-		var prefix dd.EvidencePrefix
-		switch strSplit[0] {
-		case "header":
-			prefix = dd.HttpHeaderString
-		case "query":
-			prefix = dd.HttpEvidenceQuery
-		}
-
-		evidence = append(evidence,
-			onpremise.Evidence{
-				Prefix: prefix,
-				Key:    strSplit[1],
-				Value:  v,
-			})
-	}
+	evidence, _ := ParseEvidenceMode(values, KeysTolerant, nil)
 	return evidence
 }
 
@@ -92,3 +78,18 @@ func GetEvidenceUserAgent(evidence []onpremise.Evidence) string {
 	}
 	return ""
 }
+
+// MatchMethodName returns the name of a match method as used in match metrics
+// reports.
+func MatchMethodName(method dd.MatchMethod) string {
+	switch method {
+	case dd.Performance:
+		return "PERFORMANCE"
+	case dd.Combined:
+		return "COMBINED"
+	case dd.Predictive:
+		return "PREDICTIVE"
+	default:
+		return "NONE"
+	}
+}
@@ -0,0 +1,133 @@
+/* *********************************************************************
+ * This Original Work is copyright of 51 Degrees Mobile Experts Limited.
+ * Copyright 2019 51 Degrees Mobile Experts Limited, 5 Charlotte Close,
+ * Caversham, Reading, Berkshire, United Kingdom RG4 7BY.
+ *
+ * This Original Work is licensed under the European Union Public Licence (EUPL)
+ * v.1.2 and is subject to its terms as set out below.
+ *
+ * If a copy of the EUPL was not distributed with this file, You can obtain
+ * one at https://opensource.org/licenses/EUPL-1.2.
+ *
+ * The 'Compatible Licences' set out in the Appendix to the EUPL (as may be
+ * amended by the European Commission) shall be deemed incompatible for
+ * the purposes of the Work and the provisions of the compatibility
+ * clause in Article 5 of the EUPL shall not apply.
+ *
+ * If using the Work as, or as part of, a network application, by
+ * including the attribution notice(s) required under Article 5 of the EUPL
+ * in the end user terms of the application under an appropriate heading,
+ * such notice(s) shall fulfill the requirements of that article.
+ * ********************************************************************* */
+
+package common
+
+import (
+	"math/bits"
+	"time"
+)
+
+// Number of bits of precision kept for each latency. Latencies are recorded
+// with a relative error of less than 1/64, in the same way as an HDR
+// histogram with two significant digits.
+const latencySubBucketBits = 7
+
+// Number of sub buckets in each power of two range after the first
+const latencySubBucketHalf = 1 << (latencySubBucketBits - 1)
+
+// Number of buckets needed to record any latency in nanoseconds
+const latencyBuckets = (64-latencySubBucketBits+1)*latencySubBucketHalf +
+	latencySubBucketHalf
+
+// LatencyHistogram records latencies in log-linear buckets so that
+// percentiles can be reported with a bounded relative error and a fixed
+// amount of memory. It is not safe for concurrent use; record into one
+// histogram per goroutine and Merge them.
+type LatencyHistogram struct {
+	counts [latencyBuckets]uint64
+	count  uint64
+	max    time.Duration
+}
+
+// latencyBucket returns the index of the bucket for a latency in
+// nanoseconds.
+func latencyBucket(v uint64) int {
+	shift := bits.Len64(v) - latencySubBucketBits
+	if shift <= 0 {
+		return int(v)
+	}
+	return shift*latencySubBucketHalf + int(v>>uint(shift))
+}
+
+// latencyBucketMax returns the highest latency in nanoseconds recorded in a
+// bucket.
+func latencyBucketMax(index int) uint64 {
+	if index < 2*latencySubBucketHalf {
+		return uint64(index)
+	}
+	shift := index/latencySubBucketHalf - 1
+	sub := uint64(index - shift*latencySubBucketHalf)
+	return (sub+1)<<uint(shift) - 1
+}
+
+// Record adds a latency to the histogram. Negative latencies are recorded as
+// zero.
+func (h *LatencyHistogram) Record(d time.Duration) {
+	if d < 0 {
+		d = 0
+	}
+	h.counts[latencyBucket(uint64(d))]++
+	h.count++
+	if d > h.max {
+		h.max = d
+	}
+}
+
+// Merge adds all the latencies recorded in another histogram.
+func (h *LatencyHistogram) Merge(other *LatencyHistogram) {
+	for i, c := range other.counts {
+		h.counts[i] += c
+	}
+	h.count += other.count
+	if other.max > h.max {
+		h.max = other.max
+	}
+}
+
+// Count returns the number of latencies recorded.
+func (h *LatencyHistogram) Count() uint64 {
+	return h.count
+}
+
+// Max returns the highest latency recorded.
+func (h *LatencyHistogram) Max() time.Duration {
+	return h.max
+}
+
+// Percentile returns the latency which the percentage, between 0 and 100, of
+// recorded latencies are less than or equal to. Zero is returned if no
+// latencies have been recorded.
+func (h *LatencyHistogram) Percentile(percentage float64) time.Duration {
+	if h.count == 0 {
+		return 0
+	}
+	target := uint64(percentage / 100 * float64(h.count))
+	if float64(target) < percentage/100*float64(h.count) {
+		target++
+	}
+	if target < 1 {
+		target = 1
+	}
+	var total uint64
+	for i, c := range h.counts {
+		total += c
+		if total >= target {
+			v := time.Duration(latencyBucketMax(i))
+			if v > h.max {
+				return h.max
+			}
+			return v
+		}
+	}
+	return h.max
+}
@@ -0,0 +1,87 @@
+/* *********************************************************************
+ * This Original Work is copyright of 51 Degrees Mobile Experts Limited.
+ * Copyright 2019 51 Degrees Mobile Experts Limited, 5 Charlotte Close,
+ * Caversham, Reading, Berkshire, United Kingdom RG4 7BY.
+ *
+ * This Original Work is licensed under the European Union Public Licence (EUPL)
+ * v.1.2 and is subject to its terms as set out below.
+ *
+ * If a copy of the EUPL was not distributed with this file, You can obtain
+ * one at https://opensource.org/licenses/EUPL-1.2.
+ *
+ * The 'Compatible Licences' set out in the Appendix to the EUPL (as may be
+ * amended by the European Commission) shall be deemed incompatible for
+ * the purposes of the Work and the provisions of the compatibility
+ * clause in Article 5 of the EUPL shall not apply.
+ *
+ * If using the Work as, or as part of, a network application, by
+ * including the attribution notice(s) required under Article 5 of the EUPL
+ * in the end user terms of the application under an appropriate heading,
+ * such notice(s) shall fulfill the requirements of that article.
+ * ********************************************************************* */
+
+package common
+
+import (
+	"math/rand"
+	"testing"
+	"time"
+)
+
+// Test if every latency is in a bucket with a bounded relative error.
+func TestLatencyBucket(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 100000; i++ {
+		v := uint64(r.Int63n(int64(time.Hour))) >> uint(r.Intn(40))
+		max := latencyBucketMax(latencyBucket(v))
+		if max < v || float64(max-v) > float64(v)/64 {
+			t.Fatalf("Latency %d is in a bucket with maximum %d", v, max)
+		}
+	}
+}
+
+// Test if percentiles are reported within the relative error.
+func TestLatencyHistogramPercentile(t *testing.T) {
+	var a, b LatencyHistogram
+	for i := 1; i <= 1000; i++ {
+		// Record half the latencies in each histogram to test merging
+		h := &a
+		if i%2 == 0 {
+			h = &b
+		}
+		h.Record(time.Duration(i) * time.Microsecond)
+	}
+	a.Merge(&b)
+
+	if a.Count() != 1000 {
+		t.Errorf("Expected 1000 latencies but got %d", a.Count())
+	}
+	if a.Max() != time.Millisecond {
+		t.Errorf("Expected maximum 1ms but got %v", a.Max())
+	}
+	testData := []struct {
+		percentage float64
+		expected   time.Duration
+	}{
+		{50, 500 * time.Microsecond},
+		{90, 900 * time.Microsecond},
+		{99, 990 * time.Microsecond},
+		{99.9, 999 * time.Microsecond},
+		{100, time.Millisecond},
+	}
+	for _, data := range testData {
+		actual := a.Percentile(data.percentage)
+		if actual < data.expected || actual-data.expected > data.expected/64 {
+			t.Errorf("Expected p%v to be about %v but got %v",
+				data.percentage, data.expected, actual)
+		}
+	}
+}
+
+// Test if an empty histogram reports no latency.
+func TestLatencyHistogramEmpty(t *testing.T) {
+	var h LatencyHistogram
+	if p := h.Percentile(99); p != 0 {
+		t.Errorf("Expected 0 but got %v", p)
+	}
+}
@@ -0,0 +1,71 @@
+/* *********************************************************************
+ * This Original Work is copyright of 51 Degrees Mobile Experts Limited.
+ * Copyright 2019 51 Degrees Mobile Experts Limited, 5 Charlotte Close,
+ * Caversham, Reading, Berkshire, United Kingdom RG4 7BY.
+ *
+ * This Original Work is licensed under the European Union Public Licence (EUPL)
+ * v.1.2 and is subject to its terms as set out below.
+ *
+ * If a copy of the EUPL was not distributed with this file, You can obtain
+ * one at https://opensource.org/licenses/EUPL-1.2.
+ *
+ * The 'Compatible Licences' set out in the Appendix to the EUPL (as may be
+ * amended by the European Commission) shall be deemed incompatible for
+ * the purposes of the Work and the provisions of the compatibility
+ * clause in Article 5 of the EUPL shall not apply.
+ *
+ * If using the Work as, or as part of, a network application, by
+ * including the attribution notice(s) required under Article 5 of the EUPL
+ * in the end user terms of the application under an appropriate heading,
+ * such notice(s) shall fulfill the requirements of that article.
+ * ********************************************************************* */
+
+package common
+
+import (
+	"bufio"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// ProcessMemory is the resident memory of the current process in bytes. It
+// includes memory allocated by the native device detection library, which is
+// not visible in the Go runtime statistics. Values are -1 where they are not
+// available, which is the case on platforms other than Linux.
+type ProcessMemory struct {
+	// Resident memory at the time of reading
+	RSS int64
+	// Highest resident memory since the process started
+	PeakRSS int64
+}
+
+// ReadProcessMemory returns the resident memory of the current process.
+func ReadProcessMemory() ProcessMemory {
+	mem := ProcessMemory{-1, -1}
+	f, err := os.Open("/proc/self/status")
+	if err != nil {
+		return mem
+	}
+	defer f.Close()
+
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		// Lines are in the format "VmRSS:     1234 kB"
+		fields := strings.Fields(s.Text())
+		if len(fields) != 3 || fields[2] != "kB" {
+			continue
+		}
+		kb, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil {
+			continue
+		}
+		switch fields[0] {
+		case "VmRSS:":
+			mem.RSS = kb * 1024
+		case "VmHWM:":
+			mem.PeakRSS = kb * 1024
+		}
+	}
+	return mem
+}
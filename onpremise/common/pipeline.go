@@ -0,0 +1,226 @@
+/* *********************************************************************
+ * This Original Work is copyright of 51 Degrees Mobile Experts Limited.
+ * Copyright 2019 51 Degrees Mobile Experts Limited, 5 Charlotte Close,
+ * Caversham, Reading, Berkshire, United Kingdom RG4 7BY.
+ *
+ * This Original Work is licensed under the European Union Public Licence (EUPL)
+ * v.1.2 and is subject to its terms as set out below.
+ *
+ * If a copy of the EUPL was not distributed with this file, You can obtain
+ * one at https://opensource.org/licenses/EUPL-1.2.
+ *
+ * The 'Compatible Licences' set out in the Appendix to the EUPL (as may be
+ * amended by the European Commission) shall be deemed incompatible for
+ * the purposes of the Work and the provisions of the compatibility
+ * clause in Article 5 of the EUPL shall not apply.
+ *
+ * If using the Work as, or as part of, a network application, by
+ * including the attribution notice(s) required under Article 5 of the EUPL
+ * in the end user terms of the application under an appropriate heading,
+ * such notice(s) shall fulfill the requirements of that article.
+ * ********************************************************************* */
+
+package common
+
+import (
+	"fmt"
+	"io"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/51Degrees/device-detection-go/v4/onpremise"
+)
+
+// PipelineFunc returns the output for an evidence record. It is called
+// concurrently by the pipeline workers.
+type PipelineFunc func(evidence []onpremise.Evidence) (interface{}, error)
+
+// PipelineWriteFunc writes the output of an evidence record. It is called from
+// a single goroutine in the same order as the records were read.
+type PipelineWriteFunc func(output interface{}) error
+
+// PipelineProgress is the progress of a pipeline.
+type PipelineProgress struct {
+	// Number of records written
+	Records uint64
+	// Total number of records, or 0 if not known
+	Total uint64
+	// Time since the pipeline started
+	Elapsed time.Duration
+	// Records written per second since the pipeline started
+	RecordsPerSecond float64
+	// Estimated time until all records are written, or 0 if the total is not
+	// known
+	ETA time.Duration
+}
+
+// PipelineOptions configures ProcessPipeline.
+type PipelineOptions struct {
+	// Number of workers calling the PipelineFunc. Default is the number of
+	// CPUs.
+	Workers int
+	// Maximum number of records read but not yet written. Reading waits once
+	// this is reached, so a slow writer or a slow record limits memory use.
+	// Default, and the value used if it is less than the number of workers,
+	// is 4 times the number of workers.
+	InFlight int
+	// Total number of records used to estimate the time remaining, or 0 if not
+	// known
+	Total uint64
+	// Called with the progress at most once per interval and once at the end,
+	// or never if nil
+	Progress func(PipelineProgress)
+	// Interval between progress reports. Default is one second.
+	ProgressInterval time.Duration
+}
+
+// Record read from the source
+type pipelineJob struct {
+	index    uint64
+	evidence []onpremise.Evidence
+}
+
+// Output of a record
+type pipelineResult struct {
+	index  uint64
+	output interface{}
+	err    error
+}
+
+// ProcessPipeline reads records from the source, passes them to process using
+// a number of workers, and writes the outputs in the order the records were
+// read. The first error stops the pipeline and is returned; an error from
+// process is wrapped with the record number.
+func ProcessPipeline(
+	src EvidenceSource,
+	options PipelineOptions,
+	process PipelineFunc,
+	write PipelineWriteFunc) error {
+	workers := options.Workers
+	if workers < 1 {
+		workers = runtime.NumCPU()
+	}
+	inFlight := options.InFlight
+	if inFlight < workers {
+		inFlight = 4 * workers
+	}
+	interval := options.ProgressInterval
+	if interval <= 0 {
+		interval = time.Second
+	}
+
+	var firstErr error
+	var stopOnce sync.Once
+	done := make(chan struct{})
+	stop := func(err error) {
+		stopOnce.Do(func() {
+			firstErr = err
+			close(done)
+		})
+	}
+
+	// Tokens limit the records in flight and are returned once written
+	tokens := make(chan struct{}, inFlight)
+	jobs := make(chan pipelineJob, workers)
+	results := make(chan pipelineResult, workers)
+
+	// Reader
+	go func() {
+		defer close(jobs)
+		for index := uint64(0); ; index++ {
+			select {
+			case tokens <- struct{}{}:
+			case <-done:
+				return
+			}
+			evidence, err := src.Next()
+			if err == io.EOF {
+				return
+			} else if err != nil {
+				stop(err)
+				return
+			}
+			select {
+			case jobs <- pipelineJob{index, evidence}:
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	// Workers
+	var wg sync.WaitGroup
+	wg.Add(workers)
+	for w := 0; w < workers; w++ {
+		go func() {
+			defer wg.Done()
+			for job := range jobs {
+				output, err := process(job.evidence)
+				results <- pipelineResult{job.index, output, err}
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	// Writer, which drains the results even once stopped so that the workers
+	// can finish
+	start := time.Now()
+	lastProgress := start
+	report := func(now time.Time, written uint64) {
+		p := PipelineProgress{
+			Records: written,
+			Total:   options.Total,
+			Elapsed: now.Sub(start),
+		}
+		if p.Elapsed > 0 {
+			p.RecordsPerSecond = float64(written) / p.Elapsed.Seconds()
+		}
+		if p.Total > written && p.RecordsPerSecond > 0 {
+			p.ETA = time.Duration(
+				float64(p.Total-written) / p.RecordsPerSecond * float64(time.Second))
+		}
+		options.Progress(p)
+	}
+	pending := make(map[uint64]pipelineResult)
+	var next uint64
+	for result := range results {
+		select {
+		case <-done:
+			continue
+		default:
+		}
+		pending[result.index] = result
+		for {
+			r, ok := pending[next]
+			if !ok {
+				break
+			}
+			delete(pending, next)
+			if r.err != nil {
+				stop(fmt.Errorf("record %d: %w", r.index+1, r.err))
+				break
+			}
+			if err := write(r.output); err != nil {
+				stop(err)
+				break
+			}
+			next++
+			<-tokens
+		}
+		if options.Progress != nil {
+			if now := time.Now(); now.Sub(lastProgress) >= interval {
+				lastProgress = now
+				report(now, next)
+			}
+		}
+	}
+
+	if firstErr == nil && options.Progress != nil {
+		report(time.Now(), next)
+	}
+	return firstErr
+}
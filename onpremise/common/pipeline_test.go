@@ -0,0 +1,151 @@
+/* *********************************************************************
+ * This Original Work is copyright of 51 Degrees Mobile Experts Limited.
+ * Copyright 2019 51 Degrees Mobile Experts Limited, 5 Charlotte Close,
+ * Caversham, Reading, Berkshire, United Kingdom RG4 7BY.
+ *
+ * This Original Work is licensed under the European Union Public Licence (EUPL)
+ * v.1.2 and is subject to its terms as set out below.
+ *
+ * If a copy of the EUPL was not distributed with this file, You can obtain
+ * one at https://opensource.org/licenses/EUPL-1.2.
+ *
+ * The 'Compatible Licences' set out in the Appendix to the EUPL (as may be
+ * amended by the European Commission) shall be deemed incompatible for
+ * the purposes of the Work and the provisions of the compatibility
+ * clause in Article 5 of the EUPL shall not apply.
+ *
+ * If using the Work as, or as part of, a network application, by
+ * including the attribution notice(s) required under Article 5 of the EUPL
+ * in the end user terms of the application under an appropriate heading,
+ * such notice(s) shall fulfill the requirements of that article.
+ * ********************************************************************* */
+
+package common
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/51Degrees/device-detection-go/v4/onpremise"
+)
+
+// newTestPipelineSource returns a source of records where the User-Agent of
+// each record is its number.
+func newTestPipelineSource(t *testing.T, records int) EvidenceSource {
+	var b strings.Builder
+	for i := 1; i <= records; i++ {
+		fmt.Fprintf(&b, "{\"header.user-agent\": \"%d\"}\n", i)
+	}
+	src, err := NewEvidenceSource(strings.NewReader(b.String()), FormatJSONLines)
+	if err != nil {
+		t.Fatalf("Failed to create evidence source: %v", err)
+	}
+	return src
+}
+
+// Test if outputs are written in the order records were read, with no more
+// records in flight than the limit.
+func TestProcessPipelineOrder(t *testing.T) {
+	const records = 1000
+	const inFlight = 16
+	var read, written int64
+	var maxInFlight int64
+	var progress []PipelineProgress
+
+	var outputs []string
+	err := ProcessPipeline(
+		newTestPipelineSource(t, records),
+		PipelineOptions{
+			Workers:  8,
+			InFlight: inFlight,
+			Total:    records,
+			Progress: func(p PipelineProgress) {
+				progress = append(progress, p)
+			},
+		},
+		func(evidence []onpremise.Evidence) (interface{}, error) {
+			n := atomic.AddInt64(&read, 1) - atomic.LoadInt64(&written)
+			for {
+				max := atomic.LoadInt64(&maxInFlight)
+				if n <= max || atomic.CompareAndSwapInt64(&maxInFlight, max, n) {
+					break
+				}
+			}
+			// Finish records out of order
+			time.Sleep(time.Duration(rand.Intn(100)) * time.Microsecond)
+			return evidence[0].Value, nil
+		},
+		func(output interface{}) error {
+			atomic.AddInt64(&written, 1)
+			outputs = append(outputs, output.(string))
+			return nil
+		})
+	if err != nil {
+		t.Fatalf("Failed to process pipeline: %v", err)
+	}
+
+	if len(outputs) != records {
+		t.Fatalf("Expected %d outputs but got %d", records, len(outputs))
+	}
+	for i, output := range outputs {
+		if output != fmt.Sprint(i+1) {
+			t.Fatalf("Expected output %d to be '%d' but got '%s'", i, i+1, output)
+		}
+	}
+	if maxInFlight > inFlight {
+		t.Errorf("Expected at most %d records in flight but got %d",
+			inFlight, maxInFlight)
+	}
+	if len(progress) == 0 || progress[len(progress)-1].Records != records {
+		t.Errorf("Expected final progress of %d records but got %v",
+			records, progress)
+	}
+}
+
+// Test if an error stops the pipeline and is reported with the record.
+func TestProcessPipelineError(t *testing.T) {
+	failure := errors.New("failure")
+	var writes int
+	err := ProcessPipeline(
+		newTestPipelineSource(t, 1000),
+		PipelineOptions{Workers: 4},
+		func(evidence []onpremise.Evidence) (interface{}, error) {
+			if evidence[0].Value == "500" {
+				return nil, failure
+			}
+			return nil, nil
+		},
+		func(output interface{}) error {
+			writes++
+			return nil
+		})
+	if !errors.Is(err, failure) || !strings.Contains(err.Error(), "record 500") {
+		t.Errorf("Expected failure of record 500 but got '%v'", err)
+	}
+	if writes != 499 {
+		t.Errorf("Expected 499 records written before the failure but got %d",
+			writes)
+	}
+}
+
+// Test if a write error stops the pipeline.
+func TestProcessPipelineWriteError(t *testing.T) {
+	failure := errors.New("failure")
+	err := ProcessPipeline(
+		newTestPipelineSource(t, 1000),
+		PipelineOptions{Workers: 4},
+		func(evidence []onpremise.Evidence) (interface{}, error) {
+			return nil, nil
+		},
+		func(output interface{}) error {
+			return failure
+		})
+	if !errors.Is(err, failure) {
+		t.Errorf("Expected write failure but got '%v'", err)
+	}
+}
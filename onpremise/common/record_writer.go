@@ -0,0 +1,166 @@
+/* *********************************************************************
+ * This Original Work is copyright of 51 Degrees Mobile Experts Limited.
+ * Copyright 2019 51 Degrees Mobile Experts Limited, 5 Charlotte Close,
+ * Caversham, Reading, Berkshire, United Kingdom RG4 7BY.
+ *
+ * This Original Work is licensed under the European Union Public Licence (EUPL)
+ * v.1.2 and is subject to its terms as set out below.
+ *
+ * If a copy of the EUPL was not distributed with this file, You can obtain
+ * one at https://opensource.org/licenses/EUPL-1.2.
+ *
+ * The 'Compatible Licences' set out in the Appendix to the EUPL (as may be
+ * amended by the European Commission) shall be deemed incompatible for
+ * the purposes of the Work and the provisions of the compatibility
+ * clause in Article 5 of the EUPL shall not apply.
+ *
+ * If using the Work as, or as part of, a network application, by
+ * including the attribution notice(s) required under Article 5 of the EUPL
+ * in the end user terms of the application under an appropriate heading,
+ * such notice(s) shall fulfill the requirements of that article.
+ * ********************************************************************* */
+
+package common
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"gopkg.in/yaml.v3"
+)
+
+// RecordWriter writes records of values keyed by column name, such as the
+// output of offline processing.
+type RecordWriter interface {
+	// Write writes a record.
+	Write(record map[string]string) error
+	// Flush writes any buffered records to the underlying writer.
+	Flush() error
+	// Close writes anything outstanding, but does not close the underlying
+	// writer.
+	Close() error
+}
+
+// NewRecordWriter creates a writer of records in the format, which must be
+// FormatYAML, FormatJSONLines or FormatCSV. Columns are the header of the
+// CSV format, in order, and must be provided for it. Values of other columns
+// are not written as CSV, and missing values are written as empty. The other
+// formats write all the values of each record and ignore the columns.
+func NewRecordWriter(
+	w io.Writer,
+	format EvidenceFormat,
+	columns []string) (RecordWriter, error) {
+	return newRecordWriter(w, format, columns, false)
+}
+
+// AppendRecordWriter creates a writer which continues the output of a writer
+// created by NewRecordWriter with the same format and columns, which wrote
+// at least one record. The CSV header is not written again and the first
+// YAML document is separated from the previous one, so the output is the
+// same as if a single writer had been used.
+func AppendRecordWriter(
+	w io.Writer,
+	format EvidenceFormat,
+	columns []string) (RecordWriter, error) {
+	return newRecordWriter(w, format, columns, true)
+}
+
+func newRecordWriter(
+	w io.Writer,
+	format EvidenceFormat,
+	columns []string,
+	appending bool) (RecordWriter, error) {
+	switch format {
+	case FormatYAML:
+		return &yamlRecordWriter{w, yaml.NewEncoder(w), appending}, nil
+	case FormatJSONLines:
+		return &jsonLinesRecordWriter{json.NewEncoder(w)}, nil
+	case FormatCSV:
+		if len(columns) == 0 {
+			return nil, fmt.Errorf("CSV records need at least one column")
+		}
+		cw := csv.NewWriter(w)
+		if !appending {
+			if err := cw.Write(columns); err != nil {
+				return nil, err
+			}
+		}
+		return &csvRecordWriter{cw, columns, make([]string, len(columns))}, nil
+	}
+	return nil, fmt.Errorf("records cannot be written in the '%s' format", format)
+}
+
+// Writes records as multi-document YAML ended by '...'. Each document is
+// written to the underlying writer once it is complete.
+type yamlRecordWriter struct {
+	w   io.Writer
+	enc *yaml.Encoder
+	// Whether a separator is needed before the first document
+	appending bool
+}
+
+func (r *yamlRecordWriter) Write(record map[string]string) error {
+	if r.appending {
+		// The encoder only separates documents it has written itself
+		if _, err := io.WriteString(r.w, "---\n"); err != nil {
+			return err
+		}
+		r.appending = false
+	}
+	return r.enc.Encode(record)
+}
+
+func (r *yamlRecordWriter) Flush() error {
+	return nil
+}
+
+func (r *yamlRecordWriter) Close() error {
+	if err := r.enc.Close(); err != nil {
+		return err
+	}
+	// Manually writing '...' to end the YAML file
+	_, err := io.WriteString(r.w, "...\n")
+	return err
+}
+
+// Writes records as one JSON object per line
+type jsonLinesRecordWriter struct {
+	enc *json.Encoder
+}
+
+func (r *jsonLinesRecordWriter) Write(record map[string]string) error {
+	return r.enc.Encode(record)
+}
+
+func (r *jsonLinesRecordWriter) Flush() error {
+	return nil
+}
+
+func (r *jsonLinesRecordWriter) Close() error {
+	return nil
+}
+
+// Writes records as CSV with a header row of column names
+type csvRecordWriter struct {
+	w       *csv.Writer
+	columns []string
+	row     []string
+}
+
+func (r *csvRecordWriter) Write(record map[string]string) error {
+	for i, column := range r.columns {
+		r.row[i] = record[column]
+	}
+	return r.w.Write(r.row)
+}
+
+func (r *csvRecordWriter) Flush() error {
+	r.w.Flush()
+	return r.w.Error()
+}
+
+func (r *csvRecordWriter) Close() error {
+	return r.Flush()
+}
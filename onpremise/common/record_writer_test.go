@@ -0,0 +1,91 @@
+/* *********************************************************************
+ * This Original Work is copyright of 51 Degrees Mobile Experts Limited.
+ * Copyright 2019 51 Degrees Mobile Experts Limited, 5 Charlotte Close,
+ * Caversham, Reading, Berkshire, United Kingdom RG4 7BY.
+ *
+ * This Original Work is licensed under the European Union Public Licence (EUPL)
+ * v.1.2 and is subject to its terms as set out below.
+ *
+ * If a copy of the EUPL was not distributed with this file, You can obtain
+ * one at https://opensource.org/licenses/EUPL-1.2.
+ *
+ * The 'Compatible Licences' set out in the Appendix to the EUPL (as may be
+ * amended by the European Commission) shall be deemed incompatible for
+ * the purposes of the Work and the provisions of the compatibility
+ * clause in Article 5 of the EUPL shall not apply.
+ *
+ * If using the Work as, or as part of, a network application, by
+ * including the attribution notice(s) required under Article 5 of the EUPL
+ * in the end user terms of the application under an appropriate heading,
+ * such notice(s) shall fulfill the requirements of that article.
+ * ********************************************************************* */
+
+package common
+
+import (
+	"strings"
+	"testing"
+)
+
+// Test if records are written in each format.
+func TestRecordWriter(t *testing.T) {
+	records := []map[string]string{
+		{"header.user-agent": "a, b", "device.ismobile": "True"},
+		{"device.ismobile": "False", "device.deviceid": "1-2-3"},
+	}
+	columns := []string{"header.user-agent", "device.ismobile", "device.deviceid"}
+	testData := []struct {
+		format   EvidenceFormat
+		expected string
+	}{
+		{FormatYAML, "device.ismobile: \"True\"\nheader.user-agent: a, b\n---\n" +
+			"device.deviceid: 1-2-3\ndevice.ismobile: \"False\"\n...\n"},
+		{FormatJSONLines, "{\"device.ismobile\":\"True\",\"header.user-agent\":\"a, b\"}\n" +
+			"{\"device.deviceid\":\"1-2-3\",\"device.ismobile\":\"False\"}\n"},
+		{FormatCSV, "header.user-agent,device.ismobile,device.deviceid\n" +
+			"\"a, b\",True,\n,False,1-2-3\n"},
+	}
+
+	for _, data := range testData {
+		var b strings.Builder
+		w, err := NewRecordWriter(&b, data.format, columns)
+		if err != nil {
+			t.Fatalf("Failed to create %s writer: %v", data.format, err)
+		}
+		for _, record := range records {
+			if err := w.Write(record); err != nil {
+				t.Fatalf("Failed to write %s record: %v", data.format, err)
+			}
+		}
+		if err := w.Close(); err != nil {
+			t.Fatalf("Failed to close %s writer: %v", data.format, err)
+		}
+		if b.String() != data.expected {
+			t.Errorf("Expected %s output:\n%s\nbut got:\n%s",
+				data.format, data.expected, b.String())
+		}
+	}
+}
+
+// Test if formats which cannot be written are rejected.
+func TestRecordWriterInvalid(t *testing.T) {
+	var b strings.Builder
+	if _, err := NewRecordWriter(&b, FormatUserAgents, nil); err == nil {
+		t.Errorf("Expected an error for the user-agents format")
+	}
+	if _, err := NewRecordWriter(&b, FormatCSV, nil); err == nil {
+		t.Errorf("Expected an error for CSV without columns")
+	}
+}
+
+// Test if formats are parsed from their names.
+func TestParseEvidenceFormat(t *testing.T) {
+	for f := FormatAuto; f <= FormatUserAgents; f++ {
+		if actual, err := ParseEvidenceFormat(strings.ToUpper(f.String())); actual != f || err != nil {
+			t.Errorf("Expected '%s' to be parsed but got '%s', %v", f, actual, err)
+		}
+	}
+	if _, err := ParseEvidenceFormat("parquet"); err == nil {
+		t.Errorf("Expected an error for an unknown format")
+	}
+}
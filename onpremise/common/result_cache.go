@@ -0,0 +1,239 @@
+/* *********************************************************************
+ * This Original Work is copyright of 51 Degrees Mobile Experts Limited.
+ * Copyright 2019 51 Degrees Mobile Experts Limited, 5 Charlotte Close,
+ * Caversham, Reading, Berkshire, United Kingdom RG4 7BY.
+ *
+ * This Original Work is licensed under the European Union Public Licence (EUPL)
+ * v.1.2 and is subject to its terms as set out below.
+ *
+ * If a copy of the EUPL was not distributed with this file, You can obtain
+ * one at https://opensource.org/licenses/EUPL-1.2.
+ *
+ * The 'Compatible Licences' set out in the Appendix to the EUPL (as may be
+ * amended by the European Commission) shall be deemed incompatible for
+ * the purposes of the Work and the provisions of the compatibility
+ * clause in Article 5 of the EUPL shall not apply.
+ *
+ * If using the Work as, or as part of, a network application, by
+ * including the attribution notice(s) required under Article 5 of the EUPL
+ * in the end user terms of the application under an appropriate heading,
+ * such notice(s) shall fulfill the requirements of that article.
+ * ********************************************************************* */
+package common
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/51Degrees/device-detection-go/v4/dd"
+	"github.com/51Degrees/device-detection-go/v4/onpremise"
+)
+
+// ResultCacheKey identifies the evidence of a cached result.
+type ResultCacheKey [sha256.Size]byte
+
+// NewResultCacheKey returns the cache key of the evidence. Only evidence
+// with a key in keys, normally the HttpHeaderKeys of the manager, is used so
+// that requests which differ only in evidence the engine ignores share a
+// result. The evidence is normalised by CanonicalEvidence first.
+func NewResultCacheKey(
+	evidence []onpremise.Evidence,
+	keys []dd.EvidenceKey) ResultCacheKey {
+	relevant := make([]onpremise.Evidence, 0, len(evidence))
+	for _, e := range evidence {
+		for _, k := range keys {
+			if e.Prefix == k.Prefix && strings.EqualFold(e.Key, k.Key) {
+				relevant = append(relevant, e)
+				break
+			}
+		}
+	}
+	return sha256.Sum256([]byte(CanonicalEvidence(relevant)))
+}
+
+// CachedResult holds the property values extracted from the results of a
+// detection, so that they can be reused after the results are freed.
+type CachedResult struct {
+	// Values of the properties which have matched values, joined by ','
+	Values map[string]string
+	// Response headers to set for the results, see dd.ResultsHash
+	// ResponseHeaders
+	ResponseHeaders map[string]string
+}
+
+// NewCachedResult extracts the values of the properties from the results.
+// All available properties are extracted if none are given.
+func NewCachedResult(
+	manager *dd.ResourceManager,
+	results *dd.ResultsHash,
+	properties []string) (*CachedResult, error) {
+	if len(properties) == 0 {
+		properties = results.AvailableProperties()
+	}
+	values := make(map[string]string, len(properties))
+	for _, property := range properties {
+		hasValues, err := results.HasValues(property)
+		if err != nil {
+			return nil, err
+		}
+		if !hasValues {
+			continue
+		}
+		value, err := results.ValuesString(property, ",")
+		if err != nil {
+			return nil, err
+		}
+		values[property] = value
+	}
+	headers, err := results.ResponseHeaders(manager)
+	if err != nil {
+		return nil, err
+	}
+	return &CachedResult{Values: values, ResponseHeaders: headers}, nil
+}
+
+// Value returns the values of a property joined by ','. The returned boolean
+// is false if the property does not have a matched value or was not
+// extracted.
+func (r *CachedResult) Value(property string) (string, bool) {
+	value, ok := r.Values[property]
+	return value, ok
+}
+
+// ResultCacheStats are the counters of a result cache.
+type ResultCacheStats struct {
+	Hits      uint64 `json:"hits"`
+	Misses    uint64 `json:"misses"`
+	Evictions uint64 `json:"evictions"`
+	// Number of times the cache was cleared
+	Invalidations uint64 `json:"invalidations"`
+	Entries       int    `json:"entries"`
+	Capacity      int    `json:"capacity"`
+}
+
+// resultCacheEntry is an element of the recently used list of a cache.
+type resultCacheEntry struct {
+	key    ResultCacheKey
+	result *CachedResult
+}
+
+// ResultCache is a bounded least recently used cache of detection results.
+// It is safe for concurrent use.
+//
+// Results must not outlive the data file they were detected with. The cache
+// is cleared when the published date passed to Validate changes or when an
+// UpdateReloaded event is observed. Reloads of a data file with the same
+// published date are only detected from update events, otherwise call
+// Clear after reloading.
+type ResultCache struct {
+	mutex      sync.Mutex
+	capacity   int
+	entries    map[ResultCacheKey]*list.Element
+	recent     *list.List
+	published  time.Time
+	generation uint64
+	stats      ResultCacheStats
+}
+
+// NewResultCache creates a cache holding up to capacity results.
+func NewResultCache(capacity int) *ResultCache {
+	if capacity < 1 {
+		capacity = 1
+	}
+	return &ResultCache{
+		capacity: capacity,
+		entries:  make(map[ResultCacheKey]*list.Element, capacity),
+		recent:   list.New(),
+	}
+}
+
+// Validate clears the cache if the published date of the data file differs
+// from the one of the cached results. It returns the generation of the
+// cache which must be passed to Add with results detected after the call.
+func (c *ResultCache) Validate(published time.Time) uint64 {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if !published.Equal(c.published) {
+		if !c.published.IsZero() {
+			c.clear()
+		}
+		c.published = published
+	}
+	return c.generation
+}
+
+// Get returns the cached result for the key and marks it as recently used.
+func (c *ResultCache) Get(key ResultCacheKey) (*CachedResult, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	element, ok := c.entries[key]
+	if !ok {
+		c.stats.Misses++
+		return nil, false
+	}
+	c.stats.Hits++
+	c.recent.MoveToFront(element)
+	return element.Value.(*resultCacheEntry).result, true
+}
+
+// Add caches the result for the key, evicting the least recently used
+// result if the cache is full. The result is discarded if the cache has been
+// cleared since generation was returned by Validate, as it may have been
+// detected with the previous data file.
+func (c *ResultCache) Add(
+	key ResultCacheKey,
+	generation uint64,
+	result *CachedResult) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if generation != c.generation {
+		return
+	}
+	if element, ok := c.entries[key]; ok {
+		element.Value.(*resultCacheEntry).result = result
+		c.recent.MoveToFront(element)
+		return
+	}
+	if c.recent.Len() >= c.capacity {
+		oldest := c.recent.Back()
+		c.recent.Remove(oldest)
+		delete(c.entries, oldest.Value.(*resultCacheEntry).key)
+		c.stats.Evictions++
+	}
+	c.entries[key] = c.recent.PushFront(&resultCacheEntry{key, result})
+}
+
+// Clear removes all the cached results.
+func (c *ResultCache) Clear() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.clear()
+}
+
+func (c *ResultCache) clear() {
+	c.entries = make(map[ResultCacheKey]*list.Element, c.capacity)
+	c.recent.Init()
+	c.generation++
+	c.stats.Invalidations++
+}
+
+// ObserveUpdateEvent clears the cache when the engine has reloaded its data
+// file. It can be used as the handler of an UpdateEventLogger.
+func (c *ResultCache) ObserveUpdateEvent(event UpdateEvent) {
+	if event.Type == UpdateReloaded {
+		c.Clear()
+	}
+}
+
+// Stats returns the counters of the cache.
+func (c *ResultCache) Stats() ResultCacheStats {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	stats := c.stats
+	stats.Entries = c.recent.Len()
+	stats.Capacity = c.capacity
+	return stats
+}
@@ -0,0 +1,137 @@
+/* *********************************************************************
+ * This Original Work is copyright of 51 Degrees Mobile Experts Limited.
+ * Copyright 2019 51 Degrees Mobile Experts Limited, 5 Charlotte Close,
+ * Caversham, Reading, Berkshire, United Kingdom RG4 7BY.
+ *
+ * This Original Work is licensed under the European Union Public Licence (EUPL)
+ * v.1.2 and is subject to its terms as set out below.
+ *
+ * If a copy of the EUPL was not distributed with this file, You can obtain
+ * one at https://opensource.org/licenses/EUPL-1.2.
+ *
+ * The 'Compatible Licences' set out in the Appendix to the EUPL (as may be
+ * amended by the European Commission) shall be deemed incompatible for
+ * the purposes of the Work and the provisions of the compatibility
+ * clause in Article 5 of the EUPL shall not apply.
+ *
+ * If using the Work as, or as part of, a network application, by
+ * including the attribution notice(s) required under Article 5 of the EUPL
+ * in the end user terms of the application under an appropriate heading,
+ * such notice(s) shall fulfill the requirements of that article.
+ * ********************************************************************* */
+package common
+
+import (
+	"testing"
+	"time"
+
+	"github.com/51Degrees/device-detection-go/v4/dd"
+	"github.com/51Degrees/device-detection-go/v4/onpremise"
+)
+
+// Evidence keys used by the engine in the tests
+var cacheTestKeys = []dd.EvidenceKey{
+	{Prefix: dd.HttpHeaderString, Key: "User-Agent"},
+	{Prefix: dd.HttpHeaderString, Key: "Sec-CH-UA"},
+}
+
+// Test if the key only depends on the relevant and normalised evidence.
+func TestNewResultCacheKey(t *testing.T) {
+	key := NewResultCacheKey([]onpremise.Evidence{
+		{Prefix: dd.HttpHeaderString, Key: "User-Agent", Value: "Chrome"},
+		{Prefix: dd.HttpHeaderString, Key: "Sec-CH-UA",
+			Value: `"Chromium";v="95", " Not A;Brand";v="99"`},
+	}, cacheTestKeys)
+
+	same := NewResultCacheKey([]onpremise.Evidence{
+		{Prefix: dd.HttpHeaderString, Key: "sec-ch-ua",
+			Value: `"Not.A/Brand";v="8", "Chromium";v="95"`},
+		{Prefix: dd.HttpHeaderString, Key: "Accept-Language", Value: "en"},
+		{Prefix: dd.HttpHeaderString, Key: "user-agent", Value: "Chrome"},
+	}, cacheTestKeys)
+	if key != same {
+		t.Errorf("Expected the same key for equivalent evidence")
+	}
+
+	different := NewResultCacheKey([]onpremise.Evidence{
+		{Prefix: dd.HttpHeaderString, Key: "User-Agent", Value: "Safari"},
+	}, cacheTestKeys)
+	if key == different {
+		t.Errorf("Expected a different key for different evidence")
+	}
+}
+
+// Test if the least recently used result is evicted when the cache is full.
+func TestResultCacheEviction(t *testing.T) {
+	c := NewResultCache(2)
+	keys := []ResultCacheKey{{1}, {2}, {3}}
+	generation := c.Validate(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	c.Add(keys[0], generation, &CachedResult{})
+	c.Add(keys[1], generation, &CachedResult{})
+	// Use the first result so that the second is the least recently used
+	if _, ok := c.Get(keys[0]); !ok {
+		t.Fatalf("Expected the first result to be cached")
+	}
+	c.Add(keys[2], generation, &CachedResult{})
+
+	if _, ok := c.Get(keys[1]); ok {
+		t.Errorf("Expected the second result to be evicted")
+	}
+	for _, key := range []ResultCacheKey{keys[0], keys[2]} {
+		if _, ok := c.Get(key); !ok {
+			t.Errorf("Expected result %d to be cached", key[0])
+		}
+	}
+
+	expected := ResultCacheStats{
+		Hits:      3,
+		Misses:    1,
+		Evictions: 1,
+		Entries:   2,
+		Capacity:  2,
+	}
+	if stats := c.Stats(); stats != expected {
+		t.Errorf("Expected stats %+v but got %+v", expected, stats)
+	}
+}
+
+// Test if the cache is cleared when the data file changes and if results
+// detected with the previous data file are discarded.
+func TestResultCacheInvalidation(t *testing.T) {
+	c := NewResultCache(10)
+	key := ResultCacheKey{1}
+	published := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	generation := c.Validate(published)
+	c.Add(key, generation, &CachedResult{})
+
+	if c.Validate(published) != generation {
+		t.Errorf("Expected the generation to be unchanged for the same file")
+	}
+	if _, ok := c.Get(key); !ok {
+		t.Fatalf("Expected the result to be cached")
+	}
+
+	c.Validate(published.AddDate(0, 0, 1))
+	if _, ok := c.Get(key); ok {
+		t.Errorf("Expected the cache to be cleared for a new data file")
+	}
+	// Detected before the data file changed
+	c.Add(key, generation, &CachedResult{})
+	if _, ok := c.Get(key); ok {
+		t.Errorf("Expected a result of the previous data file to be discarded")
+	}
+
+	generation = c.Validate(published.AddDate(0, 0, 1))
+	c.Add(key, generation, &CachedResult{})
+	c.ObserveUpdateEvent(UpdateEvent{Type: UpdateNotModified})
+	if _, ok := c.Get(key); !ok {
+		t.Errorf("Expected the result to be kept for a not modified event")
+	}
+	c.ObserveUpdateEvent(UpdateEvent{Type: UpdateReloaded})
+	if _, ok := c.Get(key); ok {
+		t.Errorf("Expected the cache to be cleared for a reloaded event")
+	}
+	if stats := c.Stats(); stats.Invalidations != 2 {
+		t.Errorf("Expected 2 invalidations but got %d", stats.Invalidations)
+	}
+}
@@ -0,0 +1,143 @@
+/* *********************************************************************
+ * This Original Work is copyright of 51 Degrees Mobile Experts Limited.
+ * Copyright 2019 51 Degrees Mobile Experts Limited, 5 Charlotte Close,
+ * Caversham, Reading, Berkshire, United Kingdom RG4 7BY.
+ *
+ * This Original Work is licensed under the European Union Public Licence (EUPL)
+ * v.1.2 and is subject to its terms as set out below.
+ *
+ * If a copy of the EUPL was not distributed with this file, You can obtain
+ * one at https://opensource.org/licenses/EUPL-1.2.
+ *
+ * The 'Compatible Licences' set out in the Appendix to the EUPL (as may be
+ * amended by the European Commission) shall be deemed incompatible for
+ * the purposes of the Work and the provisions of the compatibility
+ * clause in Article 5 of the EUPL shall not apply.
+ *
+ * If using the Work as, or as part of, a network application, by
+ * including the attribution notice(s) required under Article 5 of the EUPL
+ * in the end user terms of the application under an appropriate heading,
+ * such notice(s) shall fulfill the requirements of that article.
+ * ********************************************************************* */
+
+package common
+
+import (
+	"context"
+
+	"github.com/51Degrees/device-detection-go/v4/dd"
+	"github.com/51Degrees/device-detection-go/v4/onpremise"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Name of the tracer which creates detection spans
+const TracerName = "github.com/51Degrees/device-detection-examples-go/v4/onpremise/common"
+
+// Names of detection spans
+const (
+	ProcessSpanName       = "onpremise.Engine.Process"
+	MatchEvidenceSpanName = "dd.ResultsHash.MatchEvidence"
+)
+
+// Attributes of detection spans
+const (
+	EvidenceCountKey = attribute.Key("device_detection.evidence.count")
+	MatchMethodKey   = attribute.Key("device_detection.match.method")
+	IterationsKey    = attribute.Key("device_detection.match.iterations")
+	DeviceIdKey      = attribute.Key("device_detection.device_id")
+)
+
+// Tracer performs detections inside OpenTelemetry spans which record the
+// number of evidence keys and the match metrics of the results. A nil Tracer
+// performs detections without tracing, so tracing is optional for callers.
+type Tracer struct {
+	tracer trace.Tracer
+}
+
+// NewTracer creates a tracer using the provider. If the provider is nil the
+// global provider is used, which does nothing until one is registered with
+// otel.SetTracerProvider.
+func NewTracer(provider trace.TracerProvider) *Tracer {
+	if provider == nil {
+		provider = otel.GetTracerProvider()
+	}
+	return &Tracer{provider.Tracer(TracerName)}
+}
+
+// Process performs detection on the evidence using the engine in a span
+// which is a child of any span in the context. The caller is responsible for
+// freeing the returned results.
+func (t *Tracer) Process(
+	ctx context.Context,
+	engine *onpremise.Engine,
+	evidence []onpremise.Evidence) (*dd.ResultsHash, error) {
+	if t == nil {
+		return engine.Process(evidence)
+	}
+	_, span := t.tracer.Start(ctx, ProcessSpanName,
+		trace.WithAttributes(EvidenceCountKey.Int(len(evidence))))
+	defer span.End()
+
+	results, err := engine.Process(evidence)
+	if err != nil {
+		setError(span, err)
+		return nil, err
+	}
+	setMatchAttributes(span, results)
+	return results, nil
+}
+
+// MatchEvidence performs detection on the evidence into the results in a
+// span which is a child of any span in the context.
+func (t *Tracer) MatchEvidence(
+	ctx context.Context,
+	results *dd.ResultsHash,
+	evidence *dd.Evidence) error {
+	if t == nil {
+		return results.MatchEvidence(evidence)
+	}
+	_, span := t.tracer.Start(ctx, MatchEvidenceSpanName,
+		trace.WithAttributes(EvidenceCountKey.Int(evidence.Count())))
+	defer span.End()
+
+	if err := results.MatchEvidence(evidence); err != nil {
+		setError(span, err)
+		return err
+	}
+	setMatchAttributes(span, results)
+	return nil
+}
+
+// matchResults is the part of the results recorded on a span.
+type matchResults interface {
+	Method() dd.MatchMethod
+	Iterations() int32
+	DeviceId() (string, error)
+}
+
+// setMatchAttributes records the match metrics of the results on the span.
+// Nothing is read from the results if the span is not recording, such as
+// with the default no-op provider.
+func setMatchAttributes(span trace.Span, results matchResults) {
+	if !span.IsRecording() {
+		return
+	}
+	span.SetAttributes(
+		MatchMethodKey.String(MatchMethodName(results.Method())),
+		IterationsKey.Int64(int64(results.Iterations())))
+	// A missing device ID does not fail the detection
+	if deviceId, err := results.DeviceId(); err == nil {
+		span.SetAttributes(DeviceIdKey.String(deviceId))
+	} else {
+		span.RecordError(err)
+	}
+}
+
+// setError records the error on the span and marks it as failed.
+func setError(span trace.Span, err error) {
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+}
@@ -0,0 +1,179 @@
+/* *********************************************************************
+ * This Original Work is copyright of 51 Degrees Mobile Experts Limited.
+ * Copyright 2019 51 Degrees Mobile Experts Limited, 5 Charlotte Close,
+ * Caversham, Reading, Berkshire, United Kingdom RG4 7BY.
+ *
+ * This Original Work is licensed under the European Union Public Licence (EUPL)
+ * v.1.2 and is subject to its terms as set out below.
+ *
+ * If a copy of the EUPL was not distributed with this file, You can obtain
+ * one at https://opensource.org/licenses/EUPL-1.2.
+ *
+ * The 'Compatible Licences' set out in the Appendix to the EUPL (as may be
+ * amended by the European Commission) shall be deemed incompatible for
+ * the purposes of the Work and the provisions of the compatibility
+ * clause in Article 5 of the EUPL shall not apply.
+ *
+ * If using the Work as, or as part of, a network application, by
+ * including the attribution notice(s) required under Article 5 of the EUPL
+ * in the end user terms of the application under an appropriate heading,
+ * such notice(s) shall fulfill the requirements of that article.
+ * ********************************************************************* */
+
+package common
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/51Degrees/device-detection-go/v4/dd"
+	"github.com/51Degrees/device-detection-go/v4/onpremise"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Match results with fixed metrics
+type testMatchResults struct {
+	deviceIdErr error
+}
+
+func (r testMatchResults) Method() dd.MatchMethod { return dd.Predictive }
+func (r testMatchResults) Iterations() int32      { return 42 }
+func (r testMatchResults) DeviceId() (string, error) {
+	return "12280-131663-100002-18092", r.deviceIdErr
+}
+
+// newTestTracer returns a tracer which exports spans to memory.
+func newTestTracer() (*Tracer, *tracetest.InMemoryExporter) {
+	exporter := tracetest.NewInMemoryExporter()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	return NewTracer(provider), exporter
+}
+
+// spanAttributes returns the attributes of a span by key.
+func spanAttributes(span tracetest.SpanStub) map[attribute.Key]attribute.Value {
+	attrs := make(map[attribute.Key]attribute.Value)
+	for _, kv := range span.Attributes {
+		attrs[kv.Key] = kv.Value
+	}
+	return attrs
+}
+
+// Test if the match metrics of results are recorded on a span.
+func TestSetMatchAttributes(t *testing.T) {
+	tracer, exporter := newTestTracer()
+	_, span := tracer.tracer.Start(context.Background(), ProcessSpanName)
+	setMatchAttributes(span, testMatchResults{})
+	span.End()
+
+	spans := exporter.GetSpans()
+	if len(spans) != 1 {
+		t.Fatalf("Expected 1 span but got %d", len(spans))
+	}
+	attrs := spanAttributes(spans[0])
+	if v := attrs[MatchMethodKey].AsString(); v != "PREDICTIVE" {
+		t.Errorf("Expected method 'PREDICTIVE' but got '%s'", v)
+	}
+	if v := attrs[IterationsKey].AsInt64(); v != 42 {
+		t.Errorf("Expected 42 iterations but got %d", v)
+	}
+	if v := attrs[DeviceIdKey].AsString(); v != "12280-131663-100002-18092" {
+		t.Errorf("Expected device ID '12280-131663-100002-18092' but got '%s'", v)
+	}
+}
+
+// Test if a missing device ID is recorded without failing the span.
+func TestSetMatchAttributesNoDeviceId(t *testing.T) {
+	tracer, exporter := newTestTracer()
+	_, span := tracer.tracer.Start(context.Background(), ProcessSpanName)
+	setMatchAttributes(span, testMatchResults{errors.New("no device ID")})
+	span.End()
+
+	stub := exporter.GetSpans()[0]
+	if _, ok := spanAttributes(stub)[DeviceIdKey]; ok {
+		t.Errorf("Expected no device ID attribute")
+	}
+	if stub.Status.Code == codes.Error {
+		t.Errorf("Expected span not to be failed")
+	}
+	if len(stub.Events) != 1 {
+		t.Errorf("Expected the error to be recorded but got %d events",
+			len(stub.Events))
+	}
+}
+
+// Match results which fail the test if they are read
+type unreadMatchResults struct {
+	t *testing.T
+}
+
+func (r unreadMatchResults) Method() dd.MatchMethod {
+	r.t.Errorf("Unexpected read of match method")
+	return dd.None
+}
+
+func (r unreadMatchResults) Iterations() int32 {
+	r.t.Errorf("Unexpected read of iterations")
+	return 0
+}
+
+func (r unreadMatchResults) DeviceId() (string, error) {
+	r.t.Errorf("Unexpected read of device ID")
+	return "", nil
+}
+
+// Test if the results are not read for a span which is not recording.
+func TestSetMatchAttributesNotRecording(t *testing.T) {
+	tracer := NewTracer(trace.NewNoopTracerProvider())
+	_, span := tracer.tracer.Start(context.Background(), ProcessSpanName)
+	defer span.End()
+	setMatchAttributes(span, unreadMatchResults{t})
+}
+
+// Test if a detection performed by the engine is traced as a child of the
+// span in the context.
+func TestTracerProcess(t *testing.T) {
+	filePath, err := dd.GetFilePath("../..", []string{"51Degrees-LiteV4.1.hash"})
+	if err != nil {
+		t.Skip("Data file '51Degrees-LiteV4.1.hash' not found.")
+	}
+	engine, err := onpremise.New(
+		onpremise.WithDataFile(filePath),
+		onpremise.WithAutoUpdate(false))
+	if err != nil {
+		t.Skipf("Failed to create engine: %v", err)
+	}
+	defer engine.Stop()
+
+	tracer, exporter := newTestTracer()
+	ctx, parent := tracer.tracer.Start(context.Background(), "request")
+	results, err := tracer.Process(ctx, engine, []onpremise.Evidence{{
+		Prefix: dd.HttpHeaderString,
+		Key:    "User-Agent",
+		Value:  "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/95.0.4638.69 Safari/537.36",
+	}})
+	if err != nil {
+		t.Fatalf("Failed to process evidence: %v", err)
+	}
+	results.Free()
+	parent.End()
+
+	spans := exporter.GetSpans()
+	if len(spans) != 2 || spans[0].Name != ProcessSpanName {
+		t.Fatalf("Expected a '%s' span but got %v", ProcessSpanName, spans)
+	}
+	if spans[0].Parent.SpanID() != parent.SpanContext().SpanID() {
+		t.Errorf("Expected the span to be a child of the request span")
+	}
+	attrs := spanAttributes(spans[0])
+	if v := attrs[EvidenceCountKey].AsInt64(); v != 1 {
+		t.Errorf("Expected 1 evidence key but got %d", v)
+	}
+	if _, ok := attrs[MatchMethodKey]; !ok {
+		t.Errorf("Expected a match method attribute")
+	}
+}
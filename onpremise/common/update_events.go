@@ -0,0 +1,224 @@
+/* *********************************************************************
+ * This Original Work is copyright of 51 Degrees Mobile Experts Limited.
+ * Copyright 2019 51 Degrees Mobile Experts Limited, 5 Charlotte Close,
+ * Caversham, Reading, Berkshire, United Kingdom RG4 7BY.
+ *
+ * This Original Work is licensed under the European Union Public Licence (EUPL)
+ * v.1.2 and is subject to its terms as set out below.
+ *
+ * If a copy of the EUPL was not distributed with this file, You can obtain
+ * one at https://opensource.org/licenses/EUPL-1.2.
+ *
+ * The 'Compatible Licences' set out in the Appendix to the EUPL (as may be
+ * amended by the European Commission) shall be deemed incompatible for
+ * the purposes of the Work and the provisions of the compatibility
+ * clause in Article 5 of the EUPL shall not apply.
+ *
+ * If using the Work as, or as part of, a network application, by
+ * including the attribution notice(s) required under Article 5 of the EUPL
+ * in the end user terms of the application under an appropriate heading,
+ * such notice(s) shall fulfill the requirements of that article.
+ * ********************************************************************* */
+
+package common
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// UpdateEventType identifies a stage of the data file update lifecycle.
+type UpdateEventType int
+
+// Data file update lifecycle events
+const (
+	// A check for a new data file has started
+	UpdateCheckStarted UpdateEventType = iota
+	// The data file on the server is not newer than the local one
+	UpdateNotModified
+	// The server asked for the check to be retried later
+	UpdateRateLimited
+	// The data file could not be downloaded or written
+	UpdateDownloadFailed
+	// The downloaded data file failed MD5 or decompression checks
+	UpdateValidationFailed
+	// A new data file has been downloaded and written
+	UpdateDownloaded
+	// The engine has loaded a data file
+	UpdateReloaded
+	// The engine failed to load a changed data file
+	UpdateReloadFailed
+)
+
+// String returns the name of the event type.
+func (t UpdateEventType) String() string {
+	switch t {
+	case UpdateCheckStarted:
+		return "check-started"
+	case UpdateNotModified:
+		return "not-modified"
+	case UpdateRateLimited:
+		return "rate-limited"
+	case UpdateDownloadFailed:
+		return "download-failed"
+	case UpdateValidationFailed:
+		return "validation-failed"
+	case UpdateDownloaded:
+		return "downloaded"
+	case UpdateReloaded:
+		return "reloaded"
+	case UpdateReloadFailed:
+		return "reload-failed"
+	}
+	return fmt.Sprintf("UpdateEventType(%d)", int(t))
+}
+
+// UpdateEvent is a data file update lifecycle event of an engine.
+type UpdateEvent struct {
+	Type UpdateEventType
+	Time time.Time
+	// Message logged by the engine for the event
+	Message string
+	// Size of the downloaded data file for UpdateDownloaded
+	Bytes int
+	// Time to wait before the next check for UpdateRateLimited
+	RetryAfter time.Duration
+	// Data file loaded and its published date for UpdateReloaded
+	Path          string
+	PublishedDate time.Time
+}
+
+// LogWriter is the logger interface accepted by onpremise.WithCustomLogger.
+type LogWriter interface {
+	Printf(format string, v ...interface{})
+}
+
+// UpdateEventLogger observes the data file update lifecycle of an engine. It
+// implements the logger interface accepted by onpremise.WithCustomLogger and
+// turns the messages logged by the engine into update events, which are
+// passed to the handler. Messages are also passed on to the next logger if
+// there is one.
+//
+// The handler is called on the engine's update goroutines so must not block.
+type UpdateEventLogger struct {
+	handler func(UpdateEvent)
+	next    LogWriter
+}
+
+// NewUpdateEventLogger creates a logger which calls the handler for each
+// update event. next may be nil to discard the messages.
+func NewUpdateEventLogger(
+	handler func(UpdateEvent),
+	next LogWriter) *UpdateEventLogger {
+	return &UpdateEventLogger{handler, next}
+}
+
+// NewUpdateEventChannel creates a logger which sends update events to the
+// returned channel. Events are dropped rather than blocking the engine if the
+// channel buffer is full.
+func NewUpdateEventChannel(
+	size int,
+	next LogWriter) (*UpdateEventLogger, <-chan UpdateEvent) {
+	events := make(chan UpdateEvent, size)
+	logger := NewUpdateEventLogger(func(event UpdateEvent) {
+		select {
+		case events <- event:
+		default:
+		}
+	}, next)
+	return logger, events
+}
+
+// Printf passes the message on to the next logger and calls the handler if
+// the message is an update event.
+func (l *UpdateEventLogger) Printf(format string, v ...interface{}) {
+	if l.next != nil {
+		l.next.Printf(format, v...)
+	}
+	// The engine logs some messages with the values already in the format
+	message := format
+	if len(v) > 0 {
+		message = fmt.Sprintf(format, v...)
+	}
+	if event, ok := ParseUpdateEvent(message); ok {
+		event.Time = time.Now()
+		l.handler(event)
+	}
+}
+
+// Messages logged by the engine during updates
+const (
+	msgCheckStarted   = "Pulling data from "
+	msgNotModified    = "skipping pull, file not modified"
+	msgRetryAfter     = "received retry-after, retrying after "
+	msgPullFailed     = "failed to pull data file: "
+	msgWriteFailed    = "failed to write data file: "
+	msgDownloaded     = "data file pulled successfully: "
+	msgLoaded         = "data file loaded from "
+	msgPublishedOn    = " published on: "
+	msgChangeFailed   = "failed to handle file externally changed: "
+	msgNotModifiedErr = "data file not modified"
+	msgStatus429      = "received 429"
+)
+
+// Errors of a failed pull which indicate that the data file was invalid
+var validationErrors = []string{
+	"MD5 validation failed",
+	"failed to validate MD5",
+	"failed to decompress file",
+	"failed to read decompressed file",
+}
+
+// ParseUpdateEvent converts a message logged by the engine to an update event.
+// It returns false if the message is not an update event, including failures
+// which are followed by a more specific event.
+func ParseUpdateEvent(message string) (UpdateEvent, bool) {
+	event := UpdateEvent{Message: message}
+	switch {
+	case strings.HasPrefix(message, msgCheckStarted):
+		event.Type = UpdateCheckStarted
+	case message == msgNotModified:
+		event.Type = UpdateNotModified
+	case strings.HasPrefix(message, msgRetryAfter):
+		event.Type = UpdateRateLimited
+		seconds, _ := strconv.Atoi(strings.TrimSuffix(
+			strings.TrimPrefix(message, msgRetryAfter), " seconds"))
+		event.RetryAfter = time.Duration(seconds) * time.Second
+	case strings.HasPrefix(message, msgPullFailed):
+		reason := strings.TrimPrefix(message, msgPullFailed)
+		// Reported by the not modified and rate limited events
+		if reason == msgNotModifiedErr || strings.HasPrefix(reason, msgStatus429) {
+			return event, false
+		}
+		event.Type = UpdateDownloadFailed
+		for _, e := range validationErrors {
+			if strings.Contains(reason, e) {
+				event.Type = UpdateValidationFailed
+				break
+			}
+		}
+	case strings.HasPrefix(message, msgWriteFailed):
+		event.Type = UpdateDownloadFailed
+	case strings.HasPrefix(message, msgDownloaded):
+		event.Type = UpdateDownloaded
+		event.Bytes, _ = strconv.Atoi(strings.TrimSuffix(
+			strings.TrimPrefix(message, msgDownloaded), " bytes"))
+	case strings.HasPrefix(message, msgLoaded):
+		event.Type = UpdateReloaded
+		rest := strings.TrimPrefix(message, msgLoaded)
+		if i := strings.LastIndex(rest, msgPublishedOn); i >= 0 {
+			event.Path = rest[:i]
+			event.PublishedDate, _ = time.Parse(
+				"2006-1-2", rest[i+len(msgPublishedOn):])
+		} else {
+			event.Path = rest
+		}
+	case strings.HasPrefix(message, msgChangeFailed):
+		event.Type = UpdateReloadFailed
+	default:
+		return event, false
+	}
+	return event, true
+}
@@ -0,0 +1,117 @@
+/* *********************************************************************
+ * This Original Work is copyright of 51 Degrees Mobile Experts Limited.
+ * Copyright 2019 51 Degrees Mobile Experts Limited, 5 Charlotte Close,
+ * Caversham, Reading, Berkshire, United Kingdom RG4 7BY.
+ *
+ * This Original Work is licensed under the European Union Public Licence (EUPL)
+ * v.1.2 and is subject to its terms as set out below.
+ *
+ * If a copy of the EUPL was not distributed with this file, You can obtain
+ * one at https://opensource.org/licenses/EUPL-1.2.
+ *
+ * The 'Compatible Licences' set out in the Appendix to the EUPL (as may be
+ * amended by the European Commission) shall be deemed incompatible for
+ * the purposes of the Work and the provisions of the compatibility
+ * clause in Article 5 of the EUPL shall not apply.
+ *
+ * If using the Work as, or as part of, a network application, by
+ * including the attribution notice(s) required under Article 5 of the EUPL
+ * in the end user terms of the application under an appropriate heading,
+ * such notice(s) shall fulfill the requirements of that article.
+ * ********************************************************************* */
+
+package common
+
+import (
+	"testing"
+	"time"
+)
+
+// Test if messages logged by the engine are converted to update events.
+func TestParseUpdateEvent(t *testing.T) {
+	testData := []struct {
+		message  string
+		expected UpdateEventType
+	}{
+		{"Pulling data from http://localhost/data", UpdateCheckStarted},
+		{"skipping pull, file not modified", UpdateNotModified},
+		{"received retry-after, retrying after 5 seconds", UpdateRateLimited},
+		{"failed to pull data file: failed to pull data file: 500 Internal Server Error", UpdateDownloadFailed},
+		{"failed to pull data file: MD5 validation failed", UpdateValidationFailed},
+		{"failed to pull data file: failed to read decompressed file: unexpected EOF", UpdateValidationFailed},
+		{"failed to write data file: disk full", UpdateDownloadFailed},
+		{"data file pulled successfully: 1024 bytes", UpdateDownloaded},
+		{"data file loaded from /tmp/data.hash published on: 2024-5-17", UpdateReloaded},
+		{"failed to handle file externally changed: bad file", UpdateReloadFailed},
+	}
+
+	for _, data := range testData {
+		event, ok := ParseUpdateEvent(data.message)
+		if !ok || event.Type != data.expected {
+			t.Errorf("Expected '%s' to be '%s' but got '%s' (%t)",
+				data.message, data.expected, event.Type, ok)
+		}
+	}
+
+	// Failures which are followed by a more specific event
+	for _, message := range []string{
+		"failed to pull data file: data file not modified",
+		"failed to pull data file: received 429, retrying after 5 seconds",
+		"data file written successfully: 1024 bytes",
+	} {
+		if event, ok := ParseUpdateEvent(message); ok {
+			t.Errorf("Expected no event for '%s' but got '%s'", message, event.Type)
+		}
+	}
+}
+
+// Test if the event details are parsed from the messages.
+func TestParseUpdateEventDetails(t *testing.T) {
+	event, _ := ParseUpdateEvent("received retry-after, retrying after 5 seconds")
+	if event.RetryAfter != 5*time.Second {
+		t.Errorf("Expected retry after 5s but got %s", event.RetryAfter)
+	}
+	event, _ = ParseUpdateEvent("data file pulled successfully: 1024 bytes")
+	if event.Bytes != 1024 {
+		t.Errorf("Expected 1024 bytes but got %d", event.Bytes)
+	}
+	event, _ = ParseUpdateEvent(
+		"data file loaded from /tmp/a published on: b.hash published on: 2024-5-17")
+	expected := time.Date(2024, 5, 17, 0, 0, 0, 0, time.UTC)
+	if event.Path != "/tmp/a published on: b.hash" || !event.PublishedDate.Equal(expected) {
+		t.Errorf("Unexpected path '%s' and published date %s",
+			event.Path, event.PublishedDate)
+	}
+}
+
+// Test if the logger passes messages on and drops events when the channel is
+// full rather than blocking.
+func TestUpdateEventChannel(t *testing.T) {
+	next := &recordingLogger{}
+	logger, events := NewUpdateEventChannel(1, next)
+	logger.Printf("Pulling data from %s", "http://localhost/data")
+	logger.Printf("data file pulled successfully: %d bytes", 1024)
+	logger.Printf("unrelated message")
+
+	if len(next.messages) != 3 {
+		t.Errorf("Expected 3 messages passed on but got %d", len(next.messages))
+	}
+	event := <-events
+	if event.Type != UpdateCheckStarted || event.Time.IsZero() {
+		t.Errorf("Expected check started event but got %+v", event)
+	}
+	select {
+	case event := <-events:
+		t.Errorf("Expected event to be dropped but got %+v", event)
+	default:
+	}
+}
+
+// Records the formats of the messages logged.
+type recordingLogger struct {
+	messages []string
+}
+
+func (l *recordingLogger) Printf(format string, v ...interface{}) {
+	l.messages = append(l.messages, format)
+}
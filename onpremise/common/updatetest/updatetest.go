@@ -0,0 +1,206 @@
+/* *********************************************************************
+ * This Original Work is copyright of 51 Degrees Mobile Experts Limited.
+ * Copyright 2019 51 Degrees Mobile Experts Limited, 5 Charlotte Close,
+ * Caversham, Reading, Berkshire, United Kingdom RG4 7BY.
+ *
+ * This Original Work is licensed under the European Union Public Licence (EUPL)
+ * v.1.2 and is subject to its terms as set out below.
+ *
+ * If a copy of the EUPL was not distributed with this file, You can obtain
+ * one at https://opensource.org/licenses/EUPL-1.2.
+ *
+ * The 'Compatible Licences' set out in the Appendix to the EUPL (as may be
+ * amended by the European Commission) shall be deemed incompatible for
+ * the purposes of the Work and the provisions of the compatibility
+ * clause in Article 5 of the EUPL shall not apply.
+ *
+ * If using the Work as, or as part of, a network application, by
+ * including the attribution notice(s) required under Article 5 of the EUPL
+ * in the end user terms of the application under an appropriate heading,
+ * such notice(s) shall fulfill the requirements of that article.
+ * ********************************************************************* */
+
+/*
+Package updatetest provides a local stand-in for the 51Degrees distributor so
+that automatic data file updates can be tested without a license key.
+*/
+package updatetest
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/md5"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/51Degrees/device-detection-examples-go/v4/onpremise/common"
+)
+
+// Failure selects how the server fails a request.
+type Failure int
+
+// Supported update failures
+const (
+	// Serve the data file normally
+	FailNone Failure = iota
+	// Respond with 429 Too Many Requests and a Retry-After header
+	FailTooManyRequests
+	// Respond with 500 Internal Server Error
+	FailServerError
+	// Close the connection part way through the download
+	FailTruncated
+	// Serve a file which does not match its Content-MD5 header
+	FailCorrupted
+)
+
+// Stats counts the requests handled by a server.
+type Stats struct {
+	Requests    int
+	Downloads   int
+	NotModified int
+	Failures    int
+}
+
+// Server is a local stand-in for the 51Degrees distributor which serves
+// a gzipped data file. It supports conditional requests using
+// If-Modified-Since and can be told to fail requests so that automatic data
+// updates can be tested without a license key. Use URL as the data update
+// URL of the engine.
+type Server struct {
+	*httptest.Server
+
+	// Seconds sent in the Retry-After header of a 429 response
+	RetryAfter int
+
+	mu       sync.Mutex
+	data     []byte
+	md5      string
+	modified time.Time
+	failures []Failure
+	stats    Stats
+}
+
+// NewServer starts a server serving the data file at path, modified at the
+// current time. The server must be closed after use.
+func NewServer(path string) (*Server, error) {
+	s := &Server{RetryAfter: 1}
+	if err := s.SetDataFile(path, time.Now()); err != nil {
+		return nil, err
+	}
+	s.Server = httptest.NewServer(s)
+	return s, nil
+}
+
+// SetDataFile publishes the data file at path with the modified time.
+func (s *Server) SetDataFile(path string, modified time.Time) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return common.NewFileNotFoundError(path, err)
+	}
+	return s.SetData(data, modified)
+}
+
+// SetData publishes the uncompressed data file content with the modified
+// time.
+func (s *Server) SetData(data []byte, modified time.Time) error {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	if _, err := w.Write(data); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	sum := md5.Sum(buf.Bytes())
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data = buf.Bytes()
+	s.md5 = hex.EncodeToString(sum[:])
+	s.modified = modified.UTC().Truncate(time.Second)
+	return nil
+}
+
+// FailNext makes the next requests fail in the order given. Requests after
+// these are served normally.
+func (s *Server) FailNext(failures ...Failure) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failures = append(s.failures, failures...)
+}
+
+// Stats returns the number of requests handled so far.
+func (s *Server) Stats() Stats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.stats
+}
+
+// ServeHTTP responds to a data file request.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	s.stats.Requests++
+	failure := FailNone
+	if len(s.failures) > 0 {
+		failure = s.failures[0]
+		s.failures = s.failures[1:]
+		s.stats.Failures++
+	}
+	data, sum, modified := s.data, s.md5, s.modified
+	retryAfter := s.RetryAfter
+	notModified := false
+	if failure == FailNone {
+		notModified = isNotModified(r, modified)
+		if notModified {
+			s.stats.NotModified++
+		} else {
+			s.stats.Downloads++
+		}
+	}
+	s.mu.Unlock()
+
+	switch failure {
+	case FailTooManyRequests:
+		w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+		w.WriteHeader(http.StatusTooManyRequests)
+		return
+	case FailServerError:
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	case FailCorrupted:
+		corrupt := append([]byte(nil), data...)
+		corrupt[len(corrupt)/2] ^= 0xff
+		data = corrupt
+	}
+	if notModified {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/gzip")
+	w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+	w.Header().Set("Content-MD5", sum)
+	w.Header().Set("Last-Modified", modified.Format(http.TimeFormat))
+	if failure == FailTruncated {
+		w.Write(data[:len(data)/2])
+		// Send the partial body and abort the response so the client sees
+		// an unexpected EOF rather than retrying the request
+		if f, ok := w.(http.Flusher); ok {
+			f.Flush()
+		}
+		panic(http.ErrAbortHandler)
+	}
+	w.Write(data)
+}
+
+// isNotModified checks if the data has not been modified since the time in
+// the If-Modified-Since header of the request.
+func isNotModified(r *http.Request, modified time.Time) bool {
+	since, err := http.ParseTime(r.Header.Get("If-Modified-Since"))
+	return err == nil && !modified.After(since)
+}
@@ -0,0 +1,277 @@
+/* *********************************************************************
+ * This Original Work is copyright of 51 Degrees Mobile Experts Limited.
+ * Copyright 2019 51 Degrees Mobile Experts Limited, 5 Charlotte Close,
+ * Caversham, Reading, Berkshire, United Kingdom RG4 7BY.
+ *
+ * This Original Work is licensed under the European Union Public Licence (EUPL)
+ * v.1.2 and is subject to its terms as set out below.
+ *
+ * If a copy of the EUPL was not distributed with this file, You can obtain
+ * one at https://opensource.org/licenses/EUPL-1.2.
+ *
+ * The 'Compatible Licences' set out in the Appendix to the EUPL (as may be
+ * amended by the European Commission) shall be deemed incompatible for
+ * the purposes of the Work and the provisions of the compatibility
+ * clause in Article 5 of the EUPL shall not apply.
+ *
+ * If using the Work as, or as part of, a network application, by
+ * including the attribution notice(s) required under Article 5 of the EUPL
+ * in the end user terms of the application under an appropriate heading,
+ * such notice(s) shall fulfill the requirements of that article.
+ * ********************************************************************* */
+
+package updatetest
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/md5"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/51Degrees/device-detection-examples-go/v4/onpremise/common"
+	"github.com/51Degrees/device-detection-go/v4/dd"
+	"github.com/51Degrees/device-detection-go/v4/onpremise"
+)
+
+// newTestUpdateServer starts an update server serving the content.
+func newTestUpdateServer(t *testing.T, content string) *Server {
+	path := filepath.Join(t.TempDir(), "data.hash")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write test file: %v", err)
+	}
+	server, err := NewServer(path)
+	if err != nil {
+		t.Fatalf("Failed to start update server: %v", err)
+	}
+	t.Cleanup(server.Close)
+	return server
+}
+
+// get requests the data file, optionally if modified since the time.
+func get(t *testing.T, url string, since time.Time) (*http.Response, []byte, error) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		t.Fatalf("Failed to create request: %v", err)
+	}
+	if !since.IsZero() {
+		req.Header.Set("If-Modified-Since", since.UTC().Format(http.TimeFormat))
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	return resp, body, err
+}
+
+// Test if the data file is served gzipped with a valid Content-MD5 and
+// conditional requests are supported.
+func TestUpdateServer(t *testing.T) {
+	server := newTestUpdateServer(t, "data file")
+
+	resp, body, err := get(t, server.URL, time.Time{})
+	if err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected data file but got %v, %v", resp, err)
+	}
+	sum := md5.Sum(body)
+	if resp.Header.Get("Content-MD5") != hex.EncodeToString(sum[:]) {
+		t.Errorf("Expected Content-MD5 to match the body")
+	}
+	r, err := gzip.NewReader(bytes.NewReader(body))
+	if err != nil {
+		t.Fatalf("Expected gzipped body but got: %v", err)
+	}
+	if data, _ := io.ReadAll(r); string(data) != "data file" {
+		t.Errorf("Expected 'data file' but got '%s'", data)
+	}
+
+	resp, _, _ = get(t, server.URL, time.Now().Add(time.Minute))
+	if resp.StatusCode != http.StatusNotModified {
+		t.Errorf("Expected 304 but got %d", resp.StatusCode)
+	}
+	resp, _, _ = get(t, server.URL, time.Now().Add(-time.Hour))
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("Expected 200 but got %d", resp.StatusCode)
+	}
+
+	stats := server.Stats()
+	if stats.Requests != 3 || stats.Downloads != 2 || stats.NotModified != 1 {
+		t.Errorf("Unexpected stats %+v", stats)
+	}
+}
+
+// Test if each failure mode is simulated once and then cleared.
+func TestUpdateServerFailures(t *testing.T) {
+	server := newTestUpdateServer(t, strings.Repeat("data file ", 1000))
+	server.RetryAfter = 5
+	server.FailNext(
+		FailTooManyRequests,
+		FailServerError,
+		FailTruncated,
+		FailCorrupted)
+
+	resp, _, _ := get(t, server.URL, time.Time{})
+	if resp.StatusCode != http.StatusTooManyRequests ||
+		resp.Header.Get("Retry-After") != "5" {
+		t.Errorf("Expected 429 with Retry-After but got %d", resp.StatusCode)
+	}
+	resp, _, _ = get(t, server.URL, time.Time{})
+	if resp.StatusCode != http.StatusInternalServerError {
+		t.Errorf("Expected 500 but got %d", resp.StatusCode)
+	}
+	if _, _, err := get(t, server.URL, time.Time{}); err == nil {
+		t.Errorf("Expected truncated download to fail")
+	}
+	resp, body, err := get(t, server.URL, time.Time{})
+	sum := md5.Sum(body)
+	if err != nil || resp.Header.Get("Content-MD5") == hex.EncodeToString(sum[:]) {
+		t.Errorf("Expected corrupted body not to match Content-MD5")
+	}
+	resp, _, _ = get(t, server.URL, time.Time{})
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("Expected 200 after failures but got %d", resp.StatusCode)
+	}
+
+	if stats := server.Stats(); stats.Failures != 4 || stats.Downloads != 1 {
+		t.Errorf("Unexpected stats %+v", stats)
+	}
+}
+
+// Counts the data files loaded by an engine from its update events.
+type loadCounter struct {
+	mu    sync.Mutex
+	loads int
+}
+
+func (c *loadCounter) handle(event common.UpdateEvent) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if event.Type == common.UpdateReloaded {
+		c.loads++
+	}
+}
+
+func (c *loadCounter) count() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.loads
+}
+
+// newUpdatingEngine creates an engine which polls the update server every
+// second for a copy of the Lite data file. The test is skipped if the data
+// file has not been fetched.
+func newUpdatingEngine(t *testing.T) (*onpremise.Engine, *Server, *loadCounter) {
+	filePath, err := dd.GetFilePath("../../..", []string{"51Degrees-LiteV4.1.hash"})
+	if err != nil {
+		t.Skip("Data file '51Degrees-LiteV4.1.hash' not found.")
+	}
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		t.Skipf("Data file '%s' could not be read: %v", filePath, err)
+	}
+
+	// Make the local copy older than the file on the server
+	localPath := filepath.Join(t.TempDir(), "51Degrees-LiteV4.1.hash")
+	if err := os.WriteFile(localPath, data, 0644); err != nil {
+		t.Fatalf("Failed to write data file: %v", err)
+	}
+	past := time.Now().Add(-time.Hour)
+	if err := os.Chtimes(localPath, past, past); err != nil {
+		t.Fatalf("Failed to set data file time: %v", err)
+	}
+
+	server, err := NewServer(filePath)
+	if err != nil {
+		t.Fatalf("Failed to start update server: %v", err)
+	}
+	t.Cleanup(server.Close)
+
+	counter := &loadCounter{}
+	engine, err := onpremise.New(
+		onpremise.WithDataFile(localPath),
+		onpremise.WithDataUpdateUrl(server.URL),
+		onpremise.WithAutoUpdate(true),
+		onpremise.WithPollingInterval(1),
+		onpremise.WithRandomization(0),
+		onpremise.WithUpdateOnStart(false),
+		onpremise.WithFileWatch(false),
+		onpremise.WithTempDataDir(t.TempDir()),
+		onpremise.WithCustomLogger(common.NewUpdateEventLogger(counter.handle, nil)),
+	)
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	t.Cleanup(engine.Stop)
+	return engine, server, counter
+}
+
+// waitForLoads waits until the engine has loaded the data file the number of
+// times, including the initial load, checking that detections keep working.
+func waitForLoads(
+	t *testing.T,
+	engine *onpremise.Engine,
+	counter *loadCounter,
+	loads int,
+	timeout time.Duration) {
+	deadline := time.Now().Add(timeout)
+	for counter.count() < loads {
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected %d loads within %s but got %d",
+				loads, timeout, counter.count())
+		}
+		results, err := engine.Process(common.ExampleEvidenceMobile)
+		if err != nil {
+			t.Fatalf("Failed to process evidence: %v", err)
+		}
+		results.Free()
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+// Test if the engine picks up a new data file and then stops downloading it
+// once it is up to date.
+func TestEngineAutoUpdate(t *testing.T) {
+	engine, server, counter := newUpdatingEngine(t)
+
+	waitForLoads(t, engine, counter, 2, 10*time.Second)
+
+	// The local file is now newer than the file on the server
+	deadline := time.Now().Add(5 * time.Second)
+	for server.Stats().NotModified == 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected a not modified response but got %+v",
+				server.Stats())
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	if downloads := server.Stats().Downloads; downloads != 1 {
+		t.Errorf("Expected 1 download but got %d", downloads)
+	}
+}
+
+// Test if the engine keeps working through failed downloads and picks up the
+// data file once the server recovers.
+func TestEngineAutoUpdateFailures(t *testing.T) {
+	engine, server, counter := newUpdatingEngine(t)
+	server.FailNext(
+		FailTooManyRequests,
+		FailServerError,
+		FailTruncated,
+		FailCorrupted)
+
+	waitForLoads(t, engine, counter, 2, 20*time.Second)
+
+	stats := server.Stats()
+	if stats.Failures != 4 || stats.Downloads != 1 {
+		t.Errorf("Expected 4 failures then 1 download but got %+v", stats)
+	}
+}
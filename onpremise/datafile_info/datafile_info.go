@@ -0,0 +1,228 @@
+/* *********************************************************************
+ * This Original Work is copyright of 51 Degrees Mobile Experts Limited.
+ * Copyright 2019 51 Degrees Mobile Experts Limited, 5 Charlotte Close,
+ * Caversham, Reading, Berkshire, United Kingdom RG4 7BY.
+ *
+ * This Original Work is licensed under the European Union Public Licence (EUPL)
+ * v.1.2 and is subject to its terms as set out below.
+ *
+ * If a copy of the EUPL was not distributed with this file, You can obtain
+ * one at https://opensource.org/licenses/EUPL-1.2.
+ *
+ * The 'Compatible Licences' set out in the Appendix to the EUPL (as may be
+ * amended by the European Commission) shall be deemed incompatible for
+ * the purposes of the Work and the provisions of the compatibility
+ * clause in Article 5 of the EUPL shall not apply.
+ *
+ * If using the Work as, or as part of, a network application, by
+ * including the attribution notice(s) required under Article 5 of the EUPL
+ * in the end user terms of the application under an appropriate heading,
+ * such notice(s) shall fulfill the requirements of that article.
+ * ********************************************************************* */
+
+package main
+
+/*
+This command reports which data file is loaded and whether it is stale, for
+use in health checks.
+
+It loads a Hash data file and prints its tier (Lite or Enterprise), name,
+format, published date, next update date, age, the evidence keys the engine
+can use and the available properties. The output is text by default or JSON
+with -format json.
+
+To run this command, perform the following command from the root directory:
+```
+go run onpremise/datafile_info/datafile_info.go -data-file 51Degrees-LiteV4.1.hash -max-age-days 30
+```
+```
+Path:          51Degrees-LiteV4.1.hash
+Tier:          Lite
+Name:          Lite
+Format:        HashV41
+Version:       4.1.0.0
+Published:     2024-05-17
+Next update:   2024-05-24
+Age:           12 days (maximum 30)
+Properties:    59
+Evidence keys: 17
+...
+```
+
+The exit code is 0 if the data file is no older than the maximum age, 1 if
+it could not be loaded and 2 if it is stale.
+*/
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	dd_example "github.com/51Degrees/device-detection-examples-go/v4/dd"
+	"github.com/51Degrees/device-detection-examples-go/v4/onpremise/common"
+
+	"github.com/51Degrees/device-detection-go/v4/dd"
+)
+
+// Exit codes
+const (
+	exitOK     = 0
+	exitFailed = 1
+	exitStale  = 2
+)
+
+// Date format used in the output
+const dateFormat = "2006-01-02"
+
+// Information about a data file
+type dataFileInfo struct {
+	Path          string   `json:"path"`
+	Tier          string   `json:"tier"`
+	Name          string   `json:"name,omitempty"`
+	Format        string   `json:"format,omitempty"`
+	Version       string   `json:"version,omitempty"`
+	Published     string   `json:"published"`
+	NextUpdate    string   `json:"nextUpdate,omitempty"`
+	AgeDays       int      `json:"ageDays"`
+	MaxAgeDays    int      `json:"maxAgeDays"`
+	Stale         bool     `json:"stale"`
+	PropertyCount int      `json:"propertyCount"`
+	Properties    []string `json:"properties"`
+	EvidenceKeys  []string `json:"evidenceKeys"`
+}
+
+// dataFileTier returns whether the data file is the free Lite tier or an
+// Enterprise tier, from its name or otherwise from its file name.
+func dataFileTier(path string, header *common.DataFileHeader) string {
+	if header != nil {
+		if strings.Contains(strings.ToLower(header.Name), "lite") {
+			return "Lite"
+		}
+		return "Enterprise"
+	}
+	switch filepath.Base(path) {
+	case dd_example.LiteDataFile:
+		return "Lite"
+	case dd_example.EnterpriseDataFile:
+		return "Enterprise"
+	}
+	return "Unknown"
+}
+
+// inspect loads the data file and collects information about it.
+func inspect(path string, maxAgeDays int, now time.Time) (*dataFileInfo, error) {
+	manager := dd.NewResourceManager()
+	config := dd.NewConfigHash(dd.LowMemory)
+	if err := dd.InitManagerFromFile(manager, *config, "", path); err != nil {
+		return nil, err
+	}
+	defer manager.Free()
+
+	// Results are only used to access the data set so no detection is needed
+	results := dd.NewResultsHash(manager, 0, 0)
+	defer results.Free()
+
+	published := dd.GetPublishedDate(manager)
+	ageDays := int(now.Sub(published).Hours() / 24)
+	info := &dataFileInfo{
+		Path:         path,
+		Published:    published.Format(dateFormat),
+		AgeDays:      ageDays,
+		MaxAgeDays:   maxAgeDays,
+		Stale:        ageDays > maxAgeDays,
+		Properties:   results.AvailableProperties(),
+		EvidenceKeys: make([]string, 0, len(manager.HttpHeaderKeys)),
+	}
+	info.PropertyCount = len(info.Properties)
+	for _, key := range manager.HttpHeaderKeys {
+		info.EvidenceKeys = append(info.EvidenceKeys, common.EvidenceKeyString(key))
+	}
+
+	// The header holds details which are not available from the manager
+	header, err := common.ReadDataFileHeader(path)
+	if err != nil {
+		log.Printf("WARNING: Failed to read data file header. %v\n", err)
+		header = nil
+	} else {
+		info.Name = header.Name
+		info.Format = header.Format
+		info.Version = header.Version
+		info.NextUpdate = header.NextUpdate.Format(dateFormat)
+	}
+	info.Tier = dataFileTier(path, header)
+	return info, nil
+}
+
+// printText prints the information in a human readable format.
+func printText(info *dataFileInfo) {
+	fmt.Printf("Path:          %s\n", info.Path)
+	fmt.Printf("Tier:          %s\n", info.Tier)
+	if info.Name != "" {
+		fmt.Printf("Name:          %s\n", info.Name)
+		fmt.Printf("Format:        %s\n", info.Format)
+		fmt.Printf("Version:       %s\n", info.Version)
+	}
+	fmt.Printf("Published:     %s\n", info.Published)
+	if info.NextUpdate != "" {
+		fmt.Printf("Next update:   %s\n", info.NextUpdate)
+	}
+	fmt.Printf("Age:           %d days (maximum %d)\n", info.AgeDays, info.MaxAgeDays)
+	fmt.Printf("Properties:    %d\n", info.PropertyCount)
+	fmt.Printf("Evidence keys: %d\n", len(info.EvidenceKeys))
+	fmt.Println("\nEvidence keys:")
+	for _, key := range info.EvidenceKeys {
+		fmt.Printf("\t%s\n", key)
+	}
+	fmt.Println("\nProperties:")
+	for _, property := range info.Properties {
+		fmt.Printf("\t%s\n", property)
+	}
+	if info.Stale {
+		fmt.Printf("\nWARNING: Data file is %d days old, which is more than "+
+			"the maximum of %d days.\n", info.AgeDays, info.MaxAgeDays)
+	}
+}
+
+func main() {
+	dataFile := os.Getenv("DATA_FILE")
+	if dataFile == "" {
+		dataFile = dd_example.LiteDataFile
+	}
+	flag.StringVar(&dataFile, "data-file", dataFile, "Path to a 51Degrees Hash data file")
+	flag.StringVar(&dataFile, "d", dataFile, "Alias for -data-file")
+	format := flag.String("format", "text", "Output format, 'text' or 'json'")
+	maxAgeDays := flag.Int("max-age-days", 30, "Maximum age in days before the data file is stale")
+	flag.Parse()
+
+	if *format != "text" && *format != "json" {
+		log.Printf("ERROR: Unsupported format \"%s\".\n", *format)
+		os.Exit(exitFailed)
+	}
+
+	info, err := inspect(dataFile, *maxAgeDays, time.Now())
+	if err != nil {
+		log.Printf("ERROR: Failed to load data file \"%s\". %v\n", dataFile, err)
+		os.Exit(exitFailed)
+	}
+
+	if *format == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(info); err != nil {
+			log.Printf("ERROR: Failed to write output. %v\n", err)
+			os.Exit(exitFailed)
+		}
+	} else {
+		printText(info)
+	}
+
+	if info.Stale {
+		os.Exit(exitStale)
+	}
+	os.Exit(exitOK)
+}
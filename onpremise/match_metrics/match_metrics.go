@@ -75,18 +75,7 @@ func matchMetrics(
 		drift := results.Drift()
 		difference := results.Difference()
 		iterations := results.Iterations()
-		method := results.Method()
-		methodStr := "NONE"
-		switch method {
-		case dd.Performance:
-			methodStr = "PERFORMANCE"
-		case dd.Combined:
-			methodStr = "COMBINED"
-		case dd.Predictive:
-			methodStr = "PREDICTIVE"
-		default:
-			methodStr = "NONE"
-		}
+		methodStr := common.MatchMethodName(results.Method())
 		// We only use one User-Agent so there can only be one result
 		matchedUserAgent, err := results.UserAgent(0)
 		if err != nil {
@@ -0,0 +1,468 @@
+/* *********************************************************************
+ * This Original Work is copyright of 51 Degrees Mobile Experts Limited.
+ * Copyright 2019 51 Degrees Mobile Experts Limited, 5 Charlotte Close,
+ * Caversham, Reading, Berkshire, United Kingdom RG4 7BY.
+ *
+ * This Original Work is licensed under the European Union Public Licence (EUPL)
+ * v.1.2 and is subject to its terms as set out below.
+ *
+ * If a copy of the EUPL was not distributed with this file, You can obtain
+ * one at https://opensource.org/licenses/EUPL-1.2.
+ *
+ * The 'Compatible Licences' set out in the Appendix to the EUPL (as may be
+ * amended by the European Commission) shall be deemed incompatible for
+ * the purposes of the Work and the provisions of the compatibility
+ * clause in Article 5 of the EUPL shall not apply.
+ *
+ * If using the Work as, or as part of, a network application, by
+ * including the attribution notice(s) required under Article 5 of the EUPL
+ * in the end user terms of the application under an appropriate heading,
+ * such notice(s) shall fulfill the requirements of that article.
+ * ********************************************************************* */
+
+package main
+
+/*
+This example measures the memory footprint of the onpremise Engine under each
+performance profile so that a profile can be chosen with data, such as
+between InMemory and LowMemory.
+
+Each combination of performance profile, concurrency and temp data copy
+setting is measured in a separate process so that one does not affect
+another. The resident memory (RSS) and Go heap are measured before and after
+the engine is created, and under sustained load while Evidence Records are
+processed by as many workers as the configured concurrency. RSS includes the
+memory of the native library which is not visible in the Go heap, and is only
+available on Linux.
+
+To run this example, perform the following command from the root directory:
+```
+go run onpremise/memory_profile/memory_profile.go -profiles LowMemory,InMemory -load-duration 10s
+```
+A table similar to the following is printed and the report is written to
+`memory_report.csv`, or as JSON if the `-report` file name ends in `.json`:
+```
+Profile    Concurrency  Temp copy  RSS before  RSS init  RSS load  Heap before  Heap init  Heap load  Detections/s
+LowMemory  1            false      12.1        21.4      22.0      4.2          4.3        4.9        41022
+LowMemory  1            true       12.1        21.6      22.1      4.2          4.3        4.9        40871
+InMemory   8            false      12.0        74.8      75.3      4.2          4.3        5.6        411870
+...
+```
+Memory is in MB. RSS load and Heap load are the highest values sampled under
+load.
+
+Go heap profiles can be written after the engine is created and after the load
+with `-heap-profile-dir`, to be inspected with `go tool pprof`.
+*/
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"runtime/pprof"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"text/tabwriter"
+	"time"
+
+	dd_example "github.com/51Degrees/device-detection-examples-go/v4/dd"
+	"github.com/51Degrees/device-detection-examples-go/v4/onpremise/common"
+
+	"github.com/51Degrees/device-detection-go/v4/dd"
+	"github.com/51Degrees/device-detection-go/v4/onpremise"
+)
+
+// Interval at which memory is sampled under load
+const sampleInterval = 100 * time.Millisecond
+
+// Engine settings measured in a single process
+type setting struct {
+	profile     dd.PerformanceProfile
+	concurrency int
+	tempCopy    bool
+}
+
+// String returns the setting in the format accepted by parseSetting.
+func (s setting) String() string {
+	return fmt.Sprintf("%s,%d,%t",
+		dd_example.PerformanceProfileName(s.profile),
+		s.concurrency,
+		s.tempCopy)
+}
+
+// parseSetting parses a setting in the 'profile,concurrency,tempCopy' format.
+func parseSetting(value string) (setting, error) {
+	parts := strings.Split(value, ",")
+	if len(parts) != 3 {
+		return setting{}, fmt.Errorf("invalid setting '%s'", value)
+	}
+	profile, err := dd_example.ParsePerformanceProfile(parts[0])
+	if err != nil {
+		return setting{}, err
+	}
+	concurrency, err := strconv.Atoi(parts[1])
+	if err != nil || concurrency < 1 {
+		return setting{}, fmt.Errorf("invalid concurrency '%s'", parts[1])
+	}
+	tempCopy, err := strconv.ParseBool(parts[2])
+	if err != nil {
+		return setting{}, fmt.Errorf("invalid temp copy '%s'", parts[2])
+	}
+	return setting{profile, concurrency, tempCopy}, nil
+}
+
+// Memory measurements of a setting. Memory is in MB, with -1 for RSS values
+// which are not available.
+type measurement struct {
+	Profile             string  `json:"profile"`
+	Concurrency         int     `json:"concurrency"`
+	TempCopy            bool    `json:"tempCopy"`
+	RSSBefore           float64 `json:"rssBeforeMB"`
+	RSSInit             float64 `json:"rssInitMB"`
+	RSSLoad             float64 `json:"rssLoadMB"`
+	HeapBefore          float64 `json:"heapBeforeMB"`
+	HeapInit            float64 `json:"heapInitMB"`
+	HeapLoad            float64 `json:"heapLoadMB"`
+	Detections          uint64  `json:"detections"`
+	DetectionsPerSecond float64 `json:"detectionsPerSecond"`
+}
+
+// megabytes converts bytes to MB, keeping -1 for values not available.
+func megabytes(b int64) float64 {
+	if b < 0 {
+		return -1
+	}
+	return float64(b) / (1 << 20)
+}
+
+// heapAlloc returns the bytes allocated on the Go heap after a collection.
+func heapAlloc() int64 {
+	runtime.GC()
+	var stats runtime.MemStats
+	runtime.ReadMemStats(&stats)
+	return int64(stats.HeapAlloc)
+}
+
+// writeHeapProfile writes a Go heap profile for the setting and stage to the
+// directory, if one is provided.
+func writeHeapProfile(dir string, s setting, stage string) error {
+	if dir == "" {
+		return nil
+	}
+	name := fmt.Sprintf("%s-c%d-copy-%t-%s.pprof",
+		dd_example.PerformanceProfileName(s.profile),
+		s.concurrency,
+		s.tempCopy,
+		stage)
+	f, err := os.Create(filepath.Join(dir, name))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	runtime.GC()
+	return pprof.WriteHeapProfile(f)
+}
+
+// applyLoad processes the evidence with a worker per unit of concurrency for
+// the duration, sampling memory. It returns the number of detections and the
+// highest RSS and heap sampled.
+func applyLoad(
+	engine *onpremise.Engine,
+	evidence [][]onpremise.Evidence,
+	workers int,
+	duration time.Duration) (detections uint64, rss int64, heap int64) {
+	var wg sync.WaitGroup
+	done := make(chan struct{})
+	wg.Add(workers)
+	for w := 0; w < workers; w++ {
+		go func(offset int) {
+			defer wg.Done()
+			for i := offset; ; i++ {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				results, err := engine.Process(evidence[i%len(evidence)])
+				if err != nil {
+					log.Fatalln(err)
+				}
+				results.Free()
+				atomic.AddUint64(&detections, 1)
+			}
+		}(w * len(evidence) / workers)
+	}
+
+	rss, heap = -1, 0
+	ticker := time.NewTicker(sampleInterval)
+	defer ticker.Stop()
+	deadline := time.After(duration)
+sample:
+	for {
+		select {
+		case <-ticker.C:
+			if mem := common.ReadProcessMemory(); mem.RSS > rss {
+				rss = mem.RSS
+			}
+			var stats runtime.MemStats
+			runtime.ReadMemStats(&stats)
+			if int64(stats.HeapAlloc) > heap {
+				heap = int64(stats.HeapAlloc)
+			}
+		case <-deadline:
+			break sample
+		}
+	}
+	close(done)
+
+	// Wait until all workers finish
+	wg.Wait()
+	return atomic.LoadUint64(&detections), rss, heap
+}
+
+// measure creates an engine with the setting and measures its memory.
+func measure(
+	s setting,
+	params common.ExampleParams,
+	loadDuration time.Duration,
+	heapProfileDir string) (*measurement, error) {
+	evidenceFilePath, err := dd_example.FindFilePathByPath(params.EvidenceYaml)
+	if err != nil {
+		return nil, err
+	}
+	evidence, err := common.ReadAllEvidence(evidenceFilePath)
+	if err != nil {
+		return nil, err
+	}
+	if len(evidence) == 0 {
+		return nil, fmt.Errorf("no evidence records in '%s'", evidenceFilePath)
+	}
+
+	m := &measurement{
+		Profile:     dd_example.PerformanceProfileName(s.profile),
+		Concurrency: s.concurrency,
+		TempCopy:    s.tempCopy,
+		HeapBefore:  megabytes(heapAlloc()),
+		RSSBefore:   megabytes(common.ReadProcessMemory().RSS),
+	}
+
+	config := dd.NewConfigHash(s.profile)
+	config.SetConcurrency(uint16(s.concurrency))
+	config.SetUseUpperPrefixHeaders(false)
+	engine, err := onpremise.New(
+		onpremise.WithConfigHash(config),
+		onpremise.WithDataFile(params.DataFile),
+		onpremise.WithTempDataCopy(s.tempCopy),
+		onpremise.WithAutoUpdate(false),
+		// Log to stderr as stdout only holds the measurement read by the
+		// parent process
+		onpremise.WithCustomLogger(log.New(os.Stderr, "", log.LstdFlags)),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create engine: %w", err)
+	}
+	// Make sure engine is stopped after the function execution
+	defer engine.Stop()
+
+	m.HeapInit = megabytes(heapAlloc())
+	m.RSSInit = megabytes(common.ReadProcessMemory().RSS)
+	if err := writeHeapProfile(heapProfileDir, s, "init"); err != nil {
+		return nil, fmt.Errorf("failed to write heap profile: %w", err)
+	}
+
+	detections, rss, heap := applyLoad(
+		engine, evidence, s.concurrency, loadDuration)
+	m.Detections = detections
+	m.DetectionsPerSecond = float64(detections) / loadDuration.Seconds()
+	m.RSSLoad = megabytes(rss)
+	m.HeapLoad = megabytes(heap)
+	if err := writeHeapProfile(heapProfileDir, s, "load"); err != nil {
+		return nil, fmt.Errorf("failed to write heap profile: %w", err)
+	}
+	return m, nil
+}
+
+// runSetting runs this example in a new process for a single setting and
+// returns the measurement it writes.
+func runSetting(s setting) (*measurement, error) {
+	exe, err := os.Executable()
+	if err != nil {
+		return nil, err
+	}
+	args := append(os.Args[1:], "-setting", s.String())
+	cmd := exec.Command(exe, args...)
+	cmd.Stderr = os.Stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("setting %s failed: %w", s, err)
+	}
+	var m measurement
+	if err := json.NewDecoder(bytes.NewReader(out)).Decode(&m); err != nil {
+		return nil, fmt.Errorf("invalid output from setting %s: %w", s, err)
+	}
+	return &m, nil
+}
+
+// settings returns every combination of the comma separated profiles,
+// concurrency values and temp copy values.
+func settings(profiles, concurrency, tempCopy string) ([]setting, error) {
+	var all []setting
+	for _, p := range strings.Split(profiles, ",") {
+		for _, c := range strings.Split(concurrency, ",") {
+			for _, t := range strings.Split(tempCopy, ",") {
+				s, err := parseSetting(strings.Join([]string{
+					strings.TrimSpace(p),
+					strings.TrimSpace(c),
+					strings.TrimSpace(t)}, ","))
+				if err != nil {
+					return nil, err
+				}
+				all = append(all, s)
+			}
+		}
+	}
+	return all, nil
+}
+
+// formatMB formats memory in MB, or n/a if it is not available.
+func formatMB(mb float64) string {
+	if mb < 0 {
+		return "n/a"
+	}
+	return strconv.FormatFloat(mb, 'f', 1, 64)
+}
+
+// printTable prints the measurements as a table.
+func printTable(measurements []*measurement) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "Profile\tConcurrency\tTemp copy\tRSS before\tRSS init\t"+
+		"RSS load\tHeap before\tHeap init\tHeap load\tDetections/s")
+	for _, m := range measurements {
+		fmt.Fprintf(w, "%s\t%d\t%t\t%s\t%s\t%s\t%s\t%s\t%s\t%.0f\n",
+			m.Profile,
+			m.Concurrency,
+			m.TempCopy,
+			formatMB(m.RSSBefore),
+			formatMB(m.RSSInit),
+			formatMB(m.RSSLoad),
+			formatMB(m.HeapBefore),
+			formatMB(m.HeapInit),
+			formatMB(m.HeapLoad),
+			m.DetectionsPerSecond)
+	}
+	w.Flush()
+}
+
+// writeReport writes the measurements to a file as JSON if the file name ends
+// in .json, otherwise as CSV.
+func writeReport(measurements []*measurement, path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		enc := json.NewEncoder(f)
+		enc.SetIndent("", "  ")
+		return enc.Encode(measurements)
+	}
+
+	w := csv.NewWriter(f)
+	w.Write([]string{"profile", "concurrency", "temp_copy", "rss_before_mb",
+		"rss_init_mb", "rss_load_mb", "heap_before_mb", "heap_init_mb",
+		"heap_load_mb", "detections", "detections_per_second"})
+	mb := func(v float64) string { return strconv.FormatFloat(v, 'f', 2, 64) }
+	for _, m := range measurements {
+		w.Write([]string{
+			m.Profile,
+			strconv.Itoa(m.Concurrency),
+			strconv.FormatBool(m.TempCopy),
+			mb(m.RSSBefore),
+			mb(m.RSSInit),
+			mb(m.RSSLoad),
+			mb(m.HeapBefore),
+			mb(m.HeapInit),
+			mb(m.HeapLoad),
+			strconv.FormatUint(m.Detections, 10),
+			strconv.FormatFloat(m.DetectionsPerSecond, 'f', 2, 64),
+		})
+	}
+	w.Flush()
+	return w.Error()
+}
+
+func main() {
+	names := make([]string, 0, len(dd_example.PerformanceProfiles))
+	for _, p := range dd_example.PerformanceProfiles {
+		names = append(names, dd_example.PerformanceProfileName(p))
+	}
+	profiles := flag.String("profiles", strings.Join(names, ","),
+		"Comma separated performance profiles to measure")
+	concurrency := flag.String("concurrency",
+		fmt.Sprintf("1,%d", runtime.NumCPU()),
+		"Comma separated concurrency values to measure")
+	tempCopy := flag.String("temp-copy", "false,true",
+		"Comma separated temp data copy settings to measure")
+	loadDuration := flag.Duration("load-duration", 5*time.Second,
+		"Duration of the sustained load for each setting")
+	heapProfileDir := flag.String("heap-profile-dir", "",
+		"Directory to write Go heap profiles to, none if empty")
+	report := flag.String("report", "memory_report.csv",
+		"Path to the report, written as JSON if it ends in .json")
+	single := flag.String("setting", "",
+		"Measure a single 'profile,concurrency,tempCopy' setting and output "+
+			"the result as JSON")
+	flag.Parse()
+
+	common.RunExample(
+		func(params common.ExampleParams) error {
+			// Measure a single setting when run by the parent process
+			if *single != "" {
+				s, err := parseSetting(*single)
+				if err != nil {
+					return err
+				}
+				m, err := measure(s, params, *loadDuration, *heapProfileDir)
+				if err != nil {
+					return err
+				}
+				return json.NewEncoder(os.Stdout).Encode(m)
+			}
+
+			all, err := settings(*profiles, *concurrency, *tempCopy)
+			if err != nil {
+				return err
+			}
+			if *heapProfileDir != "" {
+				if err := os.MkdirAll(*heapProfileDir, 0755); err != nil {
+					return err
+				}
+			}
+			measurements := make([]*measurement, 0, len(all))
+			for _, s := range all {
+				fmt.Fprintf(os.Stderr, "Measuring %s...\n", s)
+				m, err := runSetting(s)
+				if err != nil {
+					return err
+				}
+				measurements = append(measurements, m)
+			}
+			printTable(measurements)
+			if err := writeReport(measurements, *report); err != nil {
+				return fmt.Errorf("failed to write report: %w", err)
+			}
+			fmt.Printf("Output report to file \"%s\".\n", *report)
+			return nil
+		},
+	)
+}
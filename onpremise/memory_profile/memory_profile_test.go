@@ -0,0 +1,74 @@
+/* *********************************************************************
+ * This Original Work is copyright of 51 Degrees Mobile Experts Limited.
+ * Copyright 2019 51 Degrees Mobile Experts Limited, 5 Charlotte Close,
+ * Caversham, Reading, Berkshire, United Kingdom RG4 7BY.
+ *
+ * This Original Work is licensed under the European Union Public Licence (EUPL)
+ * v.1.2 and is subject to its terms as set out below.
+ *
+ * If a copy of the EUPL was not distributed with this file, You can obtain
+ * one at https://opensource.org/licenses/EUPL-1.2.
+ *
+ * The 'Compatible Licences' set out in the Appendix to the EUPL (as may be
+ * amended by the European Commission) shall be deemed incompatible for
+ * the purposes of the Work and the provisions of the compatibility
+ * clause in Article 5 of the EUPL shall not apply.
+ *
+ * If using the Work as, or as part of, a network application, by
+ * including the attribution notice(s) required under Article 5 of the EUPL
+ * in the end user terms of the application under an appropriate heading,
+ * such notice(s) shall fulfill the requirements of that article.
+ * ********************************************************************* */
+package main
+
+import (
+	"os"
+	"testing"
+
+	"github.com/51Degrees/device-detection-go/v4/dd"
+)
+
+// Environment variable which makes the test binary run the example, so that
+// it can be the child process started by runSetting
+const childEnv = "MEMORY_PROFILE_TEST_CHILD"
+
+func TestMain(m *testing.M) {
+	if os.Getenv(childEnv) != "" {
+		main()
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// Test if the measurement written by a child process is decoded, which
+// requires nothing else to be written to its stdout.
+func TestRunSetting(t *testing.T) {
+	dataFilePath, err := dd.GetFilePath("../..", []string{"51Degrees-LiteV4.1.hash"})
+	if err != nil {
+		t.Skip("Data file '51Degrees-LiteV4.1.hash' not found.")
+	}
+	evidenceFilePath, err := dd.GetFilePath("../..", []string{"20000 Evidence Records.yml"})
+	if err != nil {
+		t.Skip("Evidence file '20000 Evidence Records.yml' not found.")
+	}
+	t.Setenv("DATA_FILE", dataFilePath)
+	t.Setenv("EVIDENCE_YAML", evidenceFilePath)
+	t.Setenv(childEnv, "1")
+
+	// The child process is passed the arguments of this one, so keep its
+	// load short
+	args := os.Args
+	os.Args = append(args[:len(args):len(args)], "-load-duration", "100ms")
+	defer func() { os.Args = args }()
+
+	m, err := runSetting(setting{dd.LowMemory, 1, false})
+	if err != nil {
+		t.Fatalf("Failed to run setting. %v", err)
+	}
+	if m.Profile != "LowMemory" || m.Concurrency != 1 || m.TempCopy {
+		t.Errorf("Expected measurement of 'LowMemory,1,false' but got %+v", m)
+	}
+	if m.Detections == 0 {
+		t.Errorf("Expected detections under load but got none")
+	}
+}
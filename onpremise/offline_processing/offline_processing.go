@@ -38,24 +38,83 @@ go test -run Example_offline_processing
 This example will output to a file located at
 "../device-detection-go/dd/device-detection-cxx/device-detection-data/20000 Evidence Records.processed.yml".
 This contains IsMobile, BrowserName, BrowserVersion, PlatformName, PlatformVersion, DeviceId
+
+Records are processed by a pipeline: a reader, `-workers` detection workers
+and a writer which outputs the records in the same order as the input, so the
+output is identical to processing the records one at a time with
+`-workers 1`. Reading waits while too many records are waiting to be written,
+so memory use is bounded for files of any size. Progress is reported to
+stderr every `-progress` interval, e.g. `-progress 10s`, after a first pass
+which counts the records to estimate the time remaining.
+
+The output is written as YAML by default, or with `-format jsonl` as one JSON
+object per line or with `-format csv` as CSV, with the file extension
+changed to match. The CSV header is derived from the selected properties so it
+is the same for every file: `device.<property>` for each property in
+lowercase followed by `device.deviceid`. With `-include-evidence` the evidence
+of each record is written next to the detected properties using the same
+'prefix.key' names in lowercase as the Evidence Records file. For CSV the
+evidence columns are those the engine can use, and come before the properties.
+With `-normalise-evidence` as well, client hints are written in a canonical
+form: GREASE brands are removed from Sec-CH-UA and Sec-CH-UA-Full-Version-List,
+the other brands are sorted, and quoting and whitespace are normalised, so the
+values are the same however the browser greases its brands.
+
+The output is written to a '.partial' file which is renamed once every record
+has been processed, so an incomplete file never looks complete. Every
+`-checkpoint` records the number of records written is saved in a
+'.checkpoint' file next to the output. If processing is interrupted, running
+again with `-resume` skips the records already written and appends to the
+partial output from the last checkpoint, rather than starting again.
+
+Access logs can be processed instead of an Evidence Records file by setting
+EVIDENCE_YAML to the log file and selecting its format with `-log-format`:
+- `combined` for the combined log format of Apache and nginx, which includes
+  the User-Agent.
+- `regex` with `-log-pattern`, a regular expression where each named group
+  captures the header it is named after with '_' for '-', e.g.
+  `(?P<sec_ch_ua_platform>...)` for Sec-CH-UA-Platform.
+- `json` for one JSON object per line, with `-log-fields` mapping fields to
+  evidence, e.g. `request.ua=header.user-agent`. The default maps the fields
+  named after the nginx variables of the User-Agent and Sec-CH-UA-* headers,
+  e.g. `http_sec_ch_ua_platform`.
+Lines which cannot be parsed are skipped and their number is reported.
 */
 
 import (
+	"flag"
 	"fmt"
-	"io"
 	"log"
 	"os"
 	"path/filepath"
+	"runtime"
+	"sort"
 	"strings"
+	"time"
 
 	dd_example "github.com/51Degrees/device-detection-examples-go/v4/dd"
 	"github.com/51Degrees/device-detection-examples-go/v4/onpremise/common"
-	"gopkg.in/yaml.v3"
 
 	"github.com/51Degrees/device-detection-go/v4/dd"
 	"github.com/51Degrees/device-detection-go/v4/onpremise"
 )
 
+// Properties selected for detection
+var properties = []string{
+	"IsMobile",
+	"BrowserName",
+	"BrowserVersion",
+	"PlatformName",
+	"PlatformVersion",
+}
+
+// Extension of the output file for each format
+var outputExtensions = map[common.EvidenceFormat]string{
+	common.FormatYAML:      "yml",
+	common.FormatJSONLines: "jsonl",
+	common.FormatCSV:       "csv",
+}
+
 // function match performs a match on an input Evidence, calulates
 // configured properties and returns them as yaml entry
 func processEvidence(
@@ -96,66 +155,281 @@ func processEvidence(
 	return res
 }
 
+// Options of the offline processing
+type processOptions struct {
+	// Number of detection workers, records are processed sequentially if 1
+	workers int
+	// Interval between progress reports, none if 0
+	progress time.Duration
+	// Format of the output file
+	format common.EvidenceFormat
+	// Whether the evidence of each record is written next to the properties
+	includeEvidence bool
+	// Whether client hints in the evidence written are normalised
+	normaliseEvidence bool
+	// Number of records between checkpoints, none if 0
+	checkpoint uint64
+	// Whether to resume from the last checkpoint
+	resume bool
+	// Parser of the input if it is an access log, otherwise nil
+	logParser common.LogParser
+	// Description of the access log format, empty if not an access log
+	logFormat string
+}
+
+// newLogParser creates the parser of an access log format, or returns nil if
+// no format is given.
+func newLogParser(format, pattern, fields string) (common.LogParser, error) {
+	switch format {
+	case "":
+		return nil, nil
+	case "combined":
+		return common.NewCombinedLogParser(), nil
+	case "regex":
+		return common.NewRegexLogParser(pattern)
+	case "json":
+		if fields == "" {
+			return common.NewJSONLogParser(common.DefaultJSONLogFields)
+		}
+		mapping, err := common.ParseLogFields(fields)
+		if err != nil {
+			return nil, err
+		}
+		return common.NewJSONLogParser(mapping)
+	}
+	return nil, fmt.Errorf("unknown log format '%s'", format)
+}
+
+// openEvidence opens the input file as an access log if a log parser is
+// selected, or as an Evidence Records file.
+func openEvidence(path string, options processOptions) (common.EvidenceSource, error) {
+	if options.logParser == nil {
+		return common.OpenEvidenceSource(path)
+	}
+	src, err := common.OpenLogEvidenceSource(path, options.logParser)
+	if err != nil {
+		return nil, err
+	}
+	return src, nil
+}
+
+// countEvidence counts the records in the input file.
+func countEvidence(path string, options processOptions) (uint64, error) {
+	src, err := openEvidence(path, options)
+	if err != nil {
+		return 0, err
+	}
+	defer src.Close()
+
+	var count uint64
+	err = common.ForEachEvidence(src, func(evidence []onpremise.Evidence) error {
+		count++
+		return nil
+	})
+	return count, err
+}
+
+// outputCheckpoint returns the checkpoint of the output for an input file.
+// The output settings must be the same to resume.
+func outputCheckpoint(evidenceFilePath string, options processOptions) common.Checkpoint {
+	return common.Checkpoint{
+		Input: evidenceFilePath,
+		Settings: fmt.Sprintf(
+			"format=%s include-evidence=%t normalise-evidence=%t log-format=%s",
+			options.format,
+			options.includeEvidence,
+			options.normaliseEvidence,
+			options.logFormat),
+	}
+}
+
+// evidenceColumn returns the output column name of an evidence key.
+func evidenceColumn(key dd.EvidenceKey) string {
+	return strings.ToLower(common.EvidenceKeyString(key))
+}
+
+// outputColumns returns the CSV columns: the evidence keys the engine can use
+// if evidence is included, followed by the selected properties and the
+// device ID.
+func outputColumns(engine *onpremise.Engine, includeEvidence bool) []string {
+	var columns []string
+	if includeEvidence {
+		seen := make(map[string]bool)
+		for _, key := range engine.GetHttpHeaderKeys() {
+			column := evidenceColumn(key)
+			if !seen[column] {
+				seen[column] = true
+				columns = append(columns, column)
+			}
+		}
+		sort.Strings(columns)
+	}
+	for _, property := range properties {
+		columns = append(columns, "device."+strings.ToLower(property))
+	}
+	return append(columns, "device.deviceid")
+}
+
+// processRecord performs detection on the evidence of a record and returns
+// the values to output, including the evidence if required.
+func processRecord(
+	engine *onpremise.Engine,
+	evidence []onpremise.Evidence,
+	options processOptions) map[string]string {
+	values := processEvidence(engine, evidence)
+	if options.includeEvidence {
+		if options.normaliseEvidence {
+			evidence = common.NormaliseEvidence(evidence)
+		}
+		for _, e := range evidence {
+			values[evidenceColumn(dd.EvidenceKey{Prefix: e.Prefix, Key: e.Key})] = e.Value
+		}
+	}
+	return values
+}
+
+// printProgress prints the progress of the pipeline to stderr.
+func printProgress(p common.PipelineProgress) {
+	fmt.Fprintf(os.Stderr,
+		"Processed %d of %d records, %.0f records per second, ETA %s\n",
+		p.Records,
+		p.Total,
+		p.RecordsPerSecond,
+		p.ETA.Round(time.Second))
+}
+
+// processRecords processes every record in the source and writes the
+// values of each record in order, saving a checkpoint of the output file
+// every options.checkpoint records.
+func processRecords(
+	engine *onpremise.Engine,
+	src common.EvidenceSource,
+	w common.RecordWriter,
+	out *common.OutputFile,
+	options processOptions,
+	total uint64) error {
+	var written uint64
+	write := func(values map[string]string) error {
+		if err := w.Write(values); err != nil {
+			return err
+		}
+		written++
+		if options.checkpoint > 0 && written%options.checkpoint == 0 {
+			if err := w.Flush(); err != nil {
+				return err
+			}
+			return out.Checkpoint(written)
+		}
+		return nil
+	}
+
+	// Records are processed sequentially by a single worker, rather than by
+	// the pipeline default of one per CPU, if workers is 1 or less
+	pipelineOptions := common.PipelineOptions{
+		Workers: options.workers,
+		Total:   total,
+	}
+	if pipelineOptions.Workers < 1 {
+		pipelineOptions.Workers = 1
+	}
+	if options.progress > 0 {
+		pipelineOptions.Progress = printProgress
+		pipelineOptions.ProgressInterval = options.progress
+	}
+	return common.ProcessPipeline(
+		src,
+		pipelineOptions,
+		func(evidence []onpremise.Evidence) (interface{}, error) {
+			return processRecord(engine, evidence, options), nil
+		},
+		func(output interface{}) error {
+			return write(output.(map[string]string))
+		})
+}
+
 func process(
 	engine *onpremise.Engine,
 	evidenceFilePath string,
-	outputFilePath string) {
-	outFile, err := os.Create(outputFilePath)
+	outputFilePath string,
+	options processOptions) {
+	// Count the records to estimate the time remaining
+	var total uint64
+	if options.progress > 0 {
+		var err error
+		if total, err = countEvidence(evidenceFilePath, options); err != nil {
+			log.Fatalf("ERROR: Failed during decoding file \"%s\". %v\n", evidenceFilePath, err)
+		}
+	}
+
+	// Write to a partial file, continuing from the last checkpoint if resuming
+	checkpoint := outputCheckpoint(evidenceFilePath, options)
+	var out *common.OutputFile
+	var err error
+	if options.resume {
+		out, err = common.ResumeOutputFile(outputFilePath, checkpoint)
+	} else {
+		out, err = common.CreateOutputFile(outputFilePath, checkpoint)
+	}
 	if err != nil {
-		log.Fatalf("ERROR: Failed to create file %s.\n", outputFilePath)
+		log.Fatalf("ERROR: Failed to create file %s. %v\n", outputFilePath, err)
 	}
-	defer func() {
-		if err := outFile.Close(); err != nil {
-			log.Fatalf("ERROR: Failed to close file \"%s\".\n", outputFilePath)
-		}
-	}()
 
 	// Open the Evidence Records file for processing
-	file, err := os.OpenFile(evidenceFilePath, os.O_RDONLY, 0444)
+	src, err := openEvidence(evidenceFilePath, options)
 	if err != nil {
 		log.Fatalf("ERROR: Failed to open file \"%s\".\n", evidenceFilePath)
 	}
 	defer func() {
-		if err := file.Close(); err != nil {
+		if err := src.Close(); err != nil {
 			log.Fatalf("ERROR: Failed to close file \"%s\".\n", evidenceFilePath)
 		}
 	}()
 
-	enc := yaml.NewEncoder(outFile)
-	dec := yaml.NewDecoder(file)
-	for {
-		// Decode Evidence file by line
-		var doc map[string]string
-		if err := dec.Decode(&doc); err == io.EOF {
-			break
-		} else if err != nil {
-			log.Fatalf("ERROR: Failed during decoding file \"%s\". %v\n", evidenceFilePath, err)
+	// Skip the records already written and continue the output after them
+	newRecordWriter := common.NewRecordWriter
+	if resumed := out.Records(); resumed > 0 {
+		if err := common.SkipEvidence(src, resumed); err != nil {
+			log.Fatalf("ERROR: Failed to resume from file \"%s\". %v\n", evidenceFilePath, err)
 		}
-
-		// Prepare evidence for usage
-		evidence := common.ConvertToEvidence(doc)
-
-		values := processEvidence(engine, evidence)
-
-		err = enc.Encode(values)
-		if err != nil {
-			log.Fatalf("ERROR: Failed during encoding file \"%s\". %v\n", outputFilePath, err)
+		fmt.Fprintf(os.Stderr, "Resuming after %d records\n", resumed)
+		newRecordWriter = common.AppendRecordWriter
+		if total > resumed {
+			total -= resumed
 		}
 	}
-	enc.Close()
 
-	// Manually writing '...' to end the YAML file
-	_, err = outFile.WriteString("...\n")
+	w, err := newRecordWriter(
+		out,
+		options.format,
+		outputColumns(engine, options.includeEvidence))
+	if err != nil {
+		log.Fatalf("ERROR: Failed to create writer for file \"%s\". %v\n", outputFilePath, err)
+	}
+	err = processRecords(engine, src, w, out, options, total)
 	if err != nil {
+		log.Fatalf("ERROR: Failed to process file \"%s\" to \"%s\". %v\n",
+			evidenceFilePath, outputFilePath, err)
+	}
+	if err := w.Close(); err != nil {
 		log.Fatalf("ERROR: Failed to write end for file \"%s\". %v\n", outputFilePath, err)
 	}
+	if err := out.Commit(); err != nil {
+		log.Fatalf("ERROR: Failed to complete file \"%s\". %v\n", outputFilePath, err)
+	}
+	if logSrc, ok := src.(*common.LogEvidenceSource); ok {
+		fmt.Fprintf(os.Stderr, "Skipped %d unparseable lines\n", logSrc.Unparsed())
+	}
 }
 
-func runOfflineProcessing(engine *onpremise.Engine, params common.ExampleParams) {
+func runOfflineProcessing(
+	engine *onpremise.Engine,
+	params common.ExampleParams,
+	options processOptions) {
 	evidenceFilePath := dd_example.GetFilePathByPath(params.EvidenceYaml)
 	evDir := filepath.Dir(evidenceFilePath)
 	evBase := strings.TrimSuffix(filepath.Base(evidenceFilePath), filepath.Ext(evidenceFilePath))
-	outputFilePath := fmt.Sprintf("%s/%s.processed.yml", evDir, evBase)
+	outputFilePath := fmt.Sprintf("%s/%s.processed.%s",
+		evDir, evBase, outputExtensions[options.format])
 	//Get base path
 	basePath, err := os.Getwd()
 	if err != nil {
@@ -169,29 +443,62 @@ func runOfflineProcessing(engine *onpremise.Engine, params common.ExampleParams)
 	// Convert path separators to '/'
 	relOutputFilePath = filepath.ToSlash(relOutputFilePath)
 
-	process(engine, evidenceFilePath, outputFilePath)
+	process(engine, evidenceFilePath, outputFilePath, options)
 	fmt.Printf("Output to \"%s\".\n", relOutputFilePath)
 }
 
 func main() {
+	var options processOptions
+	flag.IntVar(&options.workers, "workers", runtime.NumCPU(),
+		"Number of detection workers, records are processed sequentially if 1")
+	flag.DurationVar(&options.progress, "progress", 0,
+		"Interval between progress reports, none if 0")
+	format := flag.String("format", common.FormatYAML.String(),
+		"Output format, 'yaml', 'jsonl' or 'csv'")
+	flag.BoolVar(&options.includeEvidence, "include-evidence", false,
+		"Write the evidence of each record next to the detected properties")
+	flag.BoolVar(&options.normaliseEvidence, "normalise-evidence", false,
+		"Write client hints in the evidence in a canonical form without GREASE brands")
+	flag.Uint64Var(&options.checkpoint, "checkpoint", 1000,
+		"Number of records between checkpoints, none if 0")
+	flag.BoolVar(&options.resume, "resume", false,
+		"Resume from the last checkpoint rather than starting again")
+	logFormat := flag.String("log-format", "",
+		"Format of the input if it is an access log, 'combined', 'regex' or 'json'")
+	logPattern := flag.String("log-pattern", "",
+		"Regular expression of the 'regex' log format, named groups capture headers")
+	logFields := flag.String("log-fields", "",
+		"Mapping of the 'json' log format, 'field=prefix.key,...'")
+	flag.Parse()
+
+	var err error
+	options.format, err = common.ParseEvidenceFormat(*format)
+	if _, ok := outputExtensions[options.format]; err != nil || !ok {
+		log.Fatalf("ERROR: Unsupported output format \"%s\".\n", *format)
+	}
+	options.logParser, err = newLogParser(*logFormat, *logPattern, *logFields)
+	if err != nil {
+		log.Fatalf("ERROR: Invalid log format \"%s\". %v\n", *logFormat, err)
+	}
+	if options.logParser != nil {
+		options.logFormat = strings.Join([]string{*logFormat, *logPattern, *logFields}, " ")
+	}
+
 	common.RunExample(
 		func(params common.ExampleParams) error {
 			//... Example code
 			//Create config
 			config := dd.NewConfigHash(dd.Default)
 			config.SetUpdateMatchedUserAgent(true)
+			// Allow a detection by each worker at the same time
+			config.SetConcurrency(uint16(options.workers))
 
 			//Create on-premise engine
 			engine, err := onpremise.New(
 				// Optimized config provided
 				onpremise.WithConfigHash(config),
 				// List of selected properties for detection
-				onpremise.WithProperties([]string{
-					"IsMobile",
-					"BrowserName",
-					"BrowserVersion",
-					"PlatformName",
-					"PlatformVersion"}),
+				onpremise.WithProperties(properties),
 				// Path to your data file
 				onpremise.WithDataFile(params.DataFile),
 				// Enable automatic updates.
@@ -203,7 +510,7 @@ func main() {
 			}
 
 			// Run example
-			runOfflineProcessing(engine, params)
+			runOfflineProcessing(engine, params, options)
 
 			engine.Stop()
 
@@ -0,0 +1,188 @@
+/* *********************************************************************
+ * This Original Work is copyright of 51 Degrees Mobile Experts Limited.
+ * Copyright 2019 51 Degrees Mobile Experts Limited, 5 Charlotte Close,
+ * Caversham, Reading, Berkshire, United Kingdom RG4 7BY.
+ *
+ * This Original Work is licensed under the European Union Public Licence (EUPL)
+ * v.1.2 and is subject to its terms as set out below.
+ *
+ * If a copy of the EUPL was not distributed with this file, You can obtain
+ * one at https://opensource.org/licenses/EUPL-1.2.
+ *
+ * The 'Compatible Licences' set out in the Appendix to the EUPL (as may be
+ * amended by the European Commission) shall be deemed incompatible for
+ * the purposes of the Work and the provisions of the compatibility
+ * clause in Article 5 of the EUPL shall not apply.
+ *
+ * If using the Work as, or as part of, a network application, by
+ * including the attribution notice(s) required under Article 5 of the EUPL
+ * in the end user terms of the application under an appropriate heading,
+ * such notice(s) shall fulfill the requirements of that article.
+ * ********************************************************************* */
+
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/51Degrees/device-detection-examples-go/v4/onpremise/common"
+	"github.com/51Degrees/device-detection-go/v4/dd"
+	"github.com/51Degrees/device-detection-go/v4/onpremise"
+)
+
+// Number of detection workers used by the tests
+const workers = 8
+
+// newTestEngine creates an engine for the tests and returns it with the path
+// of the Evidence Records file, skipping the test if the files are missing.
+func newTestEngine(t *testing.T) (*onpremise.Engine, string) {
+	dataFilePath, err := dd.GetFilePath("../..", []string{"51Degrees-LiteV4.1.hash"})
+	if err != nil {
+		t.Skip("Data file '51Degrees-LiteV4.1.hash' not found.")
+	}
+	evidenceFilePath, err := dd.GetFilePath("../..", []string{"20000 Evidence Records.yml"})
+	if err != nil {
+		t.Skip("Evidence file '20000 Evidence Records.yml' not found.")
+	}
+
+	config := dd.NewConfigHash(dd.Default)
+	config.SetUpdateMatchedUserAgent(true)
+	config.SetConcurrency(workers)
+	engine, err := onpremise.New(
+		onpremise.WithConfigHash(config),
+		onpremise.WithProperties(properties),
+		onpremise.WithDataFile(dataFilePath),
+		onpremise.WithAutoUpdate(false),
+	)
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	t.Cleanup(engine.Stop)
+	return engine, evidenceFilePath
+}
+
+// Test if the pipeline produces the same output as processing the records
+// one at a time.
+func TestProcessParallelMatchesSequential(t *testing.T) {
+	engine, evidenceFilePath := newTestEngine(t)
+
+	dir := t.TempDir()
+	sequentialPath := filepath.Join(dir, "sequential.yml")
+	parallelPath := filepath.Join(dir, "parallel.yml")
+	for _, format := range []common.EvidenceFormat{
+		common.FormatYAML, common.FormatJSONLines, common.FormatCSV} {
+		for _, includeEvidence := range []bool{false, true} {
+			process(engine, evidenceFilePath, sequentialPath, processOptions{
+				workers:         1,
+				format:          format,
+				includeEvidence: includeEvidence,
+			})
+			process(engine, evidenceFilePath, parallelPath, processOptions{
+				workers:         workers,
+				format:          format,
+				includeEvidence: includeEvidence,
+			})
+
+			sequential, err := os.ReadFile(sequentialPath)
+			if err != nil {
+				t.Fatalf("Failed to read output: %v", err)
+			}
+			parallel, err := os.ReadFile(parallelPath)
+			if err != nil {
+				t.Fatalf("Failed to read output: %v", err)
+			}
+			if len(sequential) == 0 || !bytes.Equal(sequential, parallel) {
+				t.Errorf("Expected parallel %s output to match the sequential "+
+					"output of %d bytes but got %d bytes",
+					format, len(sequential), len(parallel))
+			}
+			if format == common.FormatCSV {
+				header := strings.Join(outputColumns(engine, includeEvidence), ",")
+				if !strings.HasPrefix(string(sequential), header+"\n") {
+					t.Errorf("Expected CSV header '%s'", header)
+				}
+			}
+		}
+	}
+}
+
+// Test if resuming from a checkpoint produces the same output as processing
+// every record at once.
+func TestProcessResume(t *testing.T) {
+	engine, evidenceFilePath := newTestEngine(t)
+	options := processOptions{
+		workers:    workers,
+		format:     common.FormatJSONLines,
+		checkpoint: 100,
+	}
+	outputPath := filepath.Join(t.TempDir(), "output.jsonl")
+	process(engine, evidenceFilePath, outputPath, options)
+	expected, err := os.ReadFile(outputPath)
+	if err != nil {
+		t.Fatalf("Failed to read output: %v", err)
+	}
+
+	// Leave the output as if processing stopped after a checkpoint, with an
+	// incomplete record written after it
+	const records = 1500
+	offset := 0
+	for i := 0; i < records; i++ {
+		offset += bytes.IndexByte(expected[offset:], '\n') + 1
+	}
+	partial := append(append([]byte{}, expected[:offset]...), "{\"device."...)
+	if err := os.WriteFile(common.PartialPath(outputPath), partial, 0644); err != nil {
+		t.Fatalf("Failed to write partial output: %v", err)
+	}
+	checkpoint := outputCheckpoint(evidenceFilePath, options)
+	checkpoint.Records = records
+	checkpoint.Offset = int64(offset)
+	err = common.WriteCheckpoint(common.CheckpointPath(outputPath), &checkpoint)
+	if err != nil {
+		t.Fatalf("Failed to write checkpoint: %v", err)
+	}
+	if err := os.Remove(outputPath); err != nil {
+		t.Fatalf("Failed to remove output: %v", err)
+	}
+
+	options.resume = true
+	process(engine, evidenceFilePath, outputPath, options)
+	resumed, err := os.ReadFile(outputPath)
+	if err != nil {
+		t.Fatalf("Failed to read output: %v", err)
+	}
+	if !bytes.Equal(expected, resumed) {
+		t.Errorf("Expected resumed output to match the output of %d bytes "+
+			"but got %d bytes", len(expected), len(resumed))
+	}
+	if _, err := os.Stat(common.CheckpointPath(outputPath)); !os.IsNotExist(err) {
+		t.Errorf("Expected the checkpoint to be removed but got %v", err)
+	}
+}
+
+// Test if parsers are created for each access log format.
+func TestNewLogParser(t *testing.T) {
+	if parser, err := newLogParser("", "", ""); parser != nil || err != nil {
+		t.Errorf("Expected no parser without a log format but got %v, %v", parser, err)
+	}
+	for _, format := range []string{"combined", "json"} {
+		if parser, err := newLogParser(format, "", ""); parser == nil || err != nil {
+			t.Errorf("Expected a parser for '%s' but got %v", format, err)
+		}
+	}
+	if _, err := newLogParser("regex", `(?P<user_agent>.*)`, ""); err != nil {
+		t.Errorf("Expected a parser for a pattern but got %v", err)
+	}
+	if _, err := newLogParser("json", "", "ua=header.user-agent"); err != nil {
+		t.Errorf("Expected a parser for a field mapping but got %v", err)
+	}
+	if _, err := newLogParser("regex", "", ""); err == nil {
+		t.Errorf("Expected an error for a pattern without named groups")
+	}
+	if _, err := newLogParser("w3c", "", ""); err == nil {
+		t.Errorf("Expected an error for an unknown log format")
+	}
+}
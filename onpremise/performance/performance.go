@@ -42,17 +42,40 @@ IsMobile Evidence Records: 58076
 Processed Evidence Records: 80000
 Number of CPUs: 2
 ```
+
+With `-sweep` the example instead measures how throughput and latency change
+with the number of workers, so that deployments can be sized against the
+throughput curve:
+```
+go run onpremise/performance/performance.go -sweep -sweep-report performance_sweep.csv
+```
+Each sweep point processes all Evidence Records `-sweep-passes` times using a
+fixed number of workers. The worker counts are 1, then doubling up to twice
+the number of CPUs, including the number of CPUs itself. The latency of every
+detection is recorded and the report lists the throughput and the p50, p90,
+p99 and p99.9 latencies of each sweep point. The report is written as JSON if
+the file name ends in `.json`, otherwise as CSV:
+```
+workers,detections,seconds,detections_per_second,p50_ms,p90_ms,p99_ms,p99_9_ms,max_ms
+1,20000,0.412,48543.69,0.01798,0.03021,0.05402,0.11968,0.47530
+2,20000,0.215,93023.26,0.01830,0.03110,0.05709,0.13107,0.52102
+...
+```
 */
 
 import ( //	"runtime"
 	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"flag"
 	"fmt"
-	"io"
 	"log"
 	_ "net/http/pprof"
 	"os"
 	"path/filepath"
 	"runtime"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
 	"sync/atomic"
@@ -60,7 +83,6 @@ import ( //	"runtime"
 
 	dd_example "github.com/51Degrees/device-detection-examples-go/v4/dd"
 	"github.com/51Degrees/device-detection-examples-go/v4/onpremise/common"
-	"gopkg.in/yaml.v3"
 
 	"github.com/51Degrees/device-detection-go/v4/dd"
 	"github.com/51Degrees/device-detection-go/v4/onpremise"
@@ -93,16 +115,14 @@ func matchEvidenceRecord(
 	}
 	defer results.Free()
 
-	// Get the value in string
-	res, err := results.ValuesString(
-		"IsMobile",
-		",")
+	// Get the typed value
+	isMobile, _, err := dd_example.NewTypedResults(results).IsMobile()
 	if err != nil {
 		log.Fatalln(err)
 	}
 
 	// Update report
-	if strings.Compare("True", res) == 0 {
+	if isMobile {
 		atomic.AddUint64(&rep.evidenceIsMobile, 1)
 	}
 
@@ -122,7 +142,7 @@ func performDetections(
 	evidenceFilePath := dd_example.GetFilePathByPath(params.EvidenceYaml)
 
 	// Read and extract Evidence for the performance check
-	evidenceSlice := readYAMLFile(evidenceFilePath)
+	evidenceSlice := readEvidenceFile(evidenceFilePath)
 
 	start := time.Now()
 	for i := 0; i < int(fIterationCount); i++ {
@@ -146,35 +166,10 @@ func performDetections(
 
 // Open, read, decode and extract Evidence to be used in the performance test.
 // Data can be reused for multiple iterations.
-func readYAMLFile(evidenceFilePath string) [][]onpremise.Evidence {
-	// Open YAML file
-	file, err := os.OpenFile(evidenceFilePath, os.O_RDONLY, 0444)
+func readEvidenceFile(evidenceFilePath string) [][]onpremise.Evidence {
+	res, err := common.ReadAllEvidence(evidenceFilePath)
 	if err != nil {
-		log.Fatalf("ERROR: Failed to open file \"%s\".\n", evidenceFilePath)
-	}
-	defer func() {
-		// Make sure the file is closed properly
-		if err := file.Close(); err != nil {
-			log.Fatalf("ERROR: Failed to close file \"%s\".\n", evidenceFilePath)
-		}
-	}()
-
-	// Decode YAML file
-	var res [][]onpremise.Evidence
-	dec := yaml.NewDecoder(file)
-	for {
-		// Decode Evidence file by line
-		var doc map[string]string
-		if err := dec.Decode(&doc); err == io.EOF {
-			break
-		} else if err != nil {
-			// Make sure there is no decoder error
-			log.Fatalf("ERROR: Failed during decoding file \"%s\". %v\n", evidenceFilePath, err)
-		}
-		// Prepare evidence for usage
-		evidence := common.ConvertToEvidence(doc)
-
-		res = append(res, evidence)
+		log.Fatalf("ERROR: Failed to read file \"%s\". %v\n", evidenceFilePath, err)
 	}
 	return res
 }
@@ -229,7 +224,168 @@ func printReport(actR *report, logOutputPath string) {
 	fmt.Printf("Output report to file \"%s\".\n", path)
 }
 
+// Result of a single point of a concurrency sweep
+type sweepPoint struct {
+	Workers             int     `json:"workers"`
+	Detections          uint64  `json:"detections"`
+	Seconds             float64 `json:"seconds"`
+	DetectionsPerSecond float64 `json:"detectionsPerSecond"`
+	P50Ms               float64 `json:"p50Ms"`
+	P90Ms               float64 `json:"p90Ms"`
+	P99Ms               float64 `json:"p99Ms"`
+	P999Ms              float64 `json:"p99_9Ms"`
+	MaxMs               float64 `json:"maxMs"`
+}
+
+// sweepWorkers returns the worker counts to sweep: 1, then doubling up to
+// twice the number of CPUs, including the number of CPUs itself.
+func sweepWorkers(cpus int) []int {
+	counts := map[int]bool{cpus: true, 2 * cpus: true}
+	for w := 1; w < 2*cpus; w *= 2 {
+		counts[w] = true
+	}
+	workers := make([]int, 0, len(counts))
+	for w := range counts {
+		workers = append(workers, w)
+	}
+	sort.Ints(workers)
+	return workers
+}
+
+// milliseconds returns a duration in fractional milliseconds.
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+// measureWorkers processes every evidence record the number of passes using
+// a fixed number of workers, recording the latency of every detection.
+func measureWorkers(
+	engine *onpremise.Engine,
+	evidence [][]onpremise.Evidence,
+	workers int,
+	passes int) sweepPoint {
+	histograms := make([]common.LatencyHistogram, workers)
+	records := make(chan []onpremise.Evidence)
+	var wg sync.WaitGroup
+	wg.Add(workers)
+	start := time.Now()
+	for w := 0; w < workers; w++ {
+		go func(h *common.LatencyHistogram) {
+			defer wg.Done()
+			for record := range records {
+				detectionStart := time.Now()
+				results, err := engine.Process(record)
+				if err != nil {
+					log.Fatalln(err)
+				}
+				results.Free()
+				h.Record(time.Since(detectionStart))
+			}
+		}(&histograms[w])
+	}
+	for i := 0; i < passes; i++ {
+		for _, record := range evidence {
+			records <- record
+		}
+	}
+	close(records)
+
+	// Wait until all workers finish
+	wg.Wait()
+	elapsed := time.Since(start)
+
+	var h common.LatencyHistogram
+	for i := range histograms {
+		h.Merge(&histograms[i])
+	}
+	return sweepPoint{
+		Workers:             workers,
+		Detections:          h.Count(),
+		Seconds:             elapsed.Seconds(),
+		DetectionsPerSecond: float64(h.Count()) / elapsed.Seconds(),
+		P50Ms:               milliseconds(h.Percentile(50)),
+		P90Ms:               milliseconds(h.Percentile(90)),
+		P99Ms:               milliseconds(h.Percentile(99)),
+		P999Ms:              milliseconds(h.Percentile(99.9)),
+		MaxMs:               milliseconds(h.Max()),
+	}
+}
+
+// writeSweepReport writes the sweep points to a file as JSON if the file
+// name ends in .json, otherwise as CSV.
+func writeSweepReport(points []sweepPoint, path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		enc := json.NewEncoder(f)
+		enc.SetIndent("", "  ")
+		return enc.Encode(points)
+	}
+
+	w := csv.NewWriter(f)
+	w.Write([]string{"workers", "detections", "seconds",
+		"detections_per_second", "p50_ms", "p90_ms", "p99_ms", "p99_9_ms",
+		"max_ms"})
+	ms := func(v float64) string { return strconv.FormatFloat(v, 'f', 5, 64) }
+	for _, p := range points {
+		w.Write([]string{
+			strconv.Itoa(p.Workers),
+			strconv.FormatUint(p.Detections, 10),
+			strconv.FormatFloat(p.Seconds, 'f', 3, 64),
+			strconv.FormatFloat(p.DetectionsPerSecond, 'f', 2, 64),
+			ms(p.P50Ms),
+			ms(p.P90Ms),
+			ms(p.P99Ms),
+			ms(p.P999Ms),
+			ms(p.MaxMs),
+		})
+	}
+	w.Flush()
+	return w.Error()
+}
+
+// Run a concurrency sweep and write the report.
+func performSweep(
+	engine *onpremise.Engine,
+	params common.ExampleParams,
+	passes int,
+	reportPath string) error {
+	evidenceFilePath := dd_example.GetFilePathByPath(params.EvidenceYaml)
+	evidence := readEvidenceFile(evidenceFilePath)
+
+	// Warm up the engine so the first sweep point is not penalised
+	measureWorkers(engine, evidence, runtime.NumCPU(), 1)
+
+	var points []sweepPoint
+	for _, workers := range sweepWorkers(runtime.NumCPU()) {
+		point := measureWorkers(engine, evidence, workers, passes)
+		fmt.Printf("Workers: %d, %.2f detections per second, "+
+			"p99 %.5f ms\n", workers, point.DetectionsPerSecond, point.P99Ms)
+		points = append(points, point)
+	}
+	if err := writeSweepReport(points, reportPath); err != nil {
+		return fmt.Errorf("failed to write sweep report: %w", err)
+	}
+	fmt.Printf("Output sweep report to file \"%s\".\n", reportPath)
+	return nil
+}
+
 func main() {
+	sweep := flag.Bool("sweep", false,
+		"Measure throughput and latency percentiles for a range of worker counts")
+	sweepPasses := flag.Int("sweep-passes", 1,
+		"Number of times all Evidence Records are processed at each sweep point")
+	sweepReport := flag.String("sweep-report", "performance_sweep.csv",
+		"Path to the sweep report, written as JSON if it ends in .json")
+	flag.Parse()
+	if *sweepPasses < 1 {
+		log.Fatalln("ERROR: -sweep-passes must be at least 1.")
+	}
+
 	common.RunExample(
 		func(params common.ExampleParams) error {
 			//... Example code
@@ -257,6 +413,11 @@ func main() {
 				log.Fatalf("Failed to create engine: %v", err)
 			}
 
+			if *sweep {
+				defer engine.Stop()
+				return performSweep(engine, params, *sweepPasses, *sweepReport)
+			}
+
 			// Action
 			actReport := report{0, 0, 0, 0}
 			performDetections(engine, params, &actReport)
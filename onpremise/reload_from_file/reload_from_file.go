@@ -2,7 +2,6 @@ package main
 
 import (
 	"hash/fnv"
-	"io"
 	"log"
 	"os"
 	"runtime"
@@ -15,7 +14,6 @@ import (
 	"github.com/51Degrees/device-detection-examples-go/v4/onpremise/common"
 	"github.com/51Degrees/device-detection-go/v4/dd"
 	"github.com/51Degrees/device-detection-go/v4/onpremise"
-	"gopkg.in/yaml.v3"
 )
 
 // Number of iterations to perform over the Evidence Records.
@@ -88,40 +86,33 @@ func performDetectionIterations(
 	rep *freport) {
 	for i := 0; i < fIterationCount; i++ {
 		// Loop through the Evidence file
-		file, err := os.OpenFile(evidenceFilePath, os.O_RDONLY, 0444)
+		src, err := common.OpenEvidenceSource(evidenceFilePath)
 		if err != nil {
 			log.Fatalf("ERROR: Failed to open file \"%s\".\n", evidenceFilePath)
 		}
-		defer func() {
-			// Make sure the file is closed properly
-			if err := file.Close(); err != nil {
-				log.Fatalf("ERROR: Failed to close file \"%s\".\n", evidenceFilePath)
-			}
-		}()
 
 		// Actual processing
-		dec := yaml.NewDecoder(file)
-		for {
-			// Decode Evidence file by line
-			var doc map[string]string
-			if err := dec.Decode(&doc); err == io.EOF {
-				break
-			} else if err != nil {
-				// Make sure there is no decoder error
-				log.Fatalf("ERROR: Error during decoding file \"%s\". %v\n", evidenceFilePath, err)
-			}
+		iteration := uint32(i)
+		err = common.ForEachEvidence(src, func(evidence []onpremise.Evidence) error {
 			// Increase wait group
 			wg.Add(1)
 
-			// Prepare evidence for usage
-			evidence := common.ConvertToEvidence(doc)
-
 			go executeTest(
 				engine,
 				wg,
 				evidence,
 				rep,
-				uint32(i))
+				iteration)
+			return nil
+		})
+		if err != nil {
+			// Make sure there is no decoder error
+			log.Fatalf("ERROR: Error during decoding file \"%s\". %v\n", evidenceFilePath, err)
+		}
+
+		// Make sure the file is closed properly
+		if err := src.Close(); err != nil {
+			log.Fatalf("ERROR: Failed to close file \"%s\".\n", evidenceFilePath)
 		}
 	}
 	wg.Done()
@@ -0,0 +1,411 @@
+/* *********************************************************************
+ * This Original Work is copyright of 51 Degrees Mobile Experts Limited.
+ * Copyright 2019 51 Degrees Mobile Experts Limited, 5 Charlotte Close,
+ * Caversham, Reading, Berkshire, United Kingdom RG4 7BY.
+ *
+ * This Original Work is licensed under the European Union Public Licence (EUPL)
+ * v.1.2 and is subject to its terms as set out below.
+ *
+ * If a copy of the EUPL was not distributed with this file, You can obtain
+ * one at https://opensource.org/licenses/EUPL-1.2.
+ *
+ * The 'Compatible Licences' set out in the Appendix to the EUPL (as may be
+ * amended by the European Commission) shall be deemed incompatible for
+ * the purposes of the Work and the provisions of the compatibility
+ * clause in Article 5 of the EUPL shall not apply.
+ *
+ * If using the Work as, or as part of, a network application, by
+ * including the attribution notice(s) required under Article 5 of the EUPL
+ * in the end user terms of the application under an appropriate heading,
+ * such notice(s) shall fulfill the requirements of that article.
+ * ********************************************************************* */
+
+package main
+
+/*
+This example illustrates how to expose device detection as a JSON REST service
+using the onpremise Engine API.
+
+To run this example, perform the following command from the root directory:
+```
+go run onpremise/rest_service/rest_service.go
+```
+This will start the service at "localhost:8001" with the following endpoints:
+
+POST /v1/detect accepts evidence as a JSON object where keys are in the same
+'prefix.key' format as the Evidence Records file and returns the values of all
+available properties together with the match metrics:
+```
+curl -X POST localhost:8001/v1/detect \
+  -d '{"header.user-agent": "Mozilla/5.0 (iPhone; CPU iPhone OS 17_1_2 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.1.2 Mobile/15E148 Safari/604.1"}'
+```
+```
+{
+  "properties": {
+    "BrowserName": "Mobile Safari",
+    ...
+  },
+  "matchMetrics": {
+    "method": "PERFORMANCE",
+    "drift": 0,
+    "difference": 0,
+    "iterations": 71,
+    "deviceId": "12280-131663-100002-18092"
+  }
+}
+```
+Properties which do not have a matched value are returned as null.
+
+POST /v1/detect/batch accepts a JSON array of evidence objects and returns the
+results in the same order. Evidence sets are processed by a fixed number of
+workers matching the concurrency configured for the engine. An evidence set
+which cannot be processed has an error in place of its result so the rest of
+the batch is unaffected:
+```
+curl -X POST localhost:8001/v1/detect/batch \
+  -d '[{"header.user-agent": "curl/7.80.0"}, {"user-agent": "no prefix"}]'
+```
+```
+{
+  "results": [
+    {"properties": {...}, "matchMetrics": {...}},
+    {"error": "evidence key 'user-agent' must be in the 'prefix.key' format"}
+  ]
+}
+```
+
+GET /v1/properties lists the properties provided by the loaded data file and
+the evidence keys which the engine can use:
+```
+curl localhost:8001/v1/properties
+```
+
+GET /metrics exposes the data file reloads and update events of the engine in
+the Prometheus text format. The engine reloads the data file when it is
+replaced.
+
+Detections are performed in OpenTelemetry spans which are children of any
+span in the request context. Spans are discarded unless a tracer provider is
+registered with otel.SetTracerProvider.
+*/
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"runtime"
+
+	"github.com/51Degrees/device-detection-examples-go/v4/onpremise/common"
+	"github.com/51Degrees/device-detection-examples-go/v4/web/metrics"
+	"github.com/51Degrees/device-detection-go/v4/dd"
+	"github.com/51Degrees/device-detection-go/v4/onpremise"
+)
+
+// Port the service listens on
+const port = 8001
+
+// Maximum size of a request body in bytes
+const maxBodySize = 1 << 20
+
+// Maximum size of a batch request body in bytes
+const maxBatchBodySize = 32 << 20
+
+// Maximum number of evidence sets in a batch
+const maxBatchSize = 10000
+
+// Match metrics of a detection
+type matchMetrics struct {
+	Method     string `json:"method"`
+	Drift      int32  `json:"drift"`
+	Difference int32  `json:"difference"`
+	Iterations int32  `json:"iterations"`
+	DeviceId   string `json:"deviceId"`
+}
+
+// Response body for a detection
+type detectResponse struct {
+	Properties   map[string]*string `json:"properties"`
+	MatchMetrics matchMetrics       `json:"matchMetrics"`
+}
+
+// Result of a single evidence set in a batch. Either the detection response or
+// the error is set.
+type batchItem struct {
+	Properties   map[string]*string `json:"properties,omitempty"`
+	MatchMetrics *matchMetrics      `json:"matchMetrics,omitempty"`
+	Error        string             `json:"error,omitempty"`
+}
+
+// Response body for a batch detection
+type batchResponse struct {
+	Results []batchItem `json:"results"`
+}
+
+// Response body for the list of properties
+type propertiesResponse struct {
+	Properties   []string `json:"properties"`
+	EvidenceKeys []string `json:"evidenceKeys"`
+}
+
+// Response body for an error
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+// service serves the REST endpoints using an engine.
+type service struct {
+	engine  *onpremise.Engine
+	workers int
+	tracer  *common.Tracer
+}
+
+// newServeMux creates a mux with all the REST endpoints registered. Batches
+// are processed using the given number of workers.
+func newServeMux(engine *onpremise.Engine, workers int) *http.ServeMux {
+	s := &service{engine, workers, common.NewTracer(nil)}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/detect", s.detect)
+	mux.HandleFunc("/v1/detect/batch", s.detectBatch)
+	mux.HandleFunc("/v1/properties", s.properties)
+	return mux
+}
+
+// writeJSON writes the value as a JSON response with the status code.
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("ERROR: Failed to write response. %v\n", err)
+	}
+}
+
+// writeError writes an error message as a JSON response.
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, errorResponse{err.Error()})
+}
+
+// checkMethod checks the request method and writes an error response if it
+// is not the expected one.
+func checkMethod(w http.ResponseWriter, r *http.Request, method string) bool {
+	if r.Method != method {
+		w.Header().Set("Allow", method)
+		writeError(w, http.StatusMethodNotAllowed,
+			fmt.Errorf("method %s is not allowed", r.Method))
+		return false
+	}
+	return true
+}
+
+// readEvidence decodes the evidence from a request body.
+func readEvidence(r *http.Request) ([]onpremise.Evidence, error) {
+	var values map[string]string
+	dec := json.NewDecoder(r.Body)
+	if err := dec.Decode(&values); err != nil {
+		return nil, fmt.Errorf("invalid evidence: %w", err)
+	}
+	return convertEvidence(values)
+}
+
+// convertEvidence converts evidence values keyed by 'prefix.key' to evidence.
+func convertEvidence(values map[string]string) ([]onpremise.Evidence, error) {
+	if len(values) == 0 {
+		return nil, errors.New("no evidence provided")
+	}
+	return common.ParseEvidence(values)
+}
+
+// processEvidence performs detection on the evidence and returns the values
+// of all available properties and the match metrics.
+func processEvidence(
+	ctx context.Context,
+	tracer *common.Tracer,
+	engine *onpremise.Engine,
+	evidence []onpremise.Evidence) (*detectResponse, error) {
+	results, err := tracer.Process(ctx, engine, evidence)
+	if err != nil {
+		return nil, err
+	}
+	defer results.Free()
+
+	return newDetectResponse(results)
+}
+
+// newDetectResponse returns the values of all available properties and the
+// match metrics from the results.
+func newDetectResponse(results *dd.ResultsHash) (*detectResponse, error) {
+	available := results.AvailableProperties()
+	res := &detectResponse{
+		Properties: make(map[string]*string, len(available)),
+	}
+	for i, property := range available {
+		hasValues, err := results.HasValuesByIndex(i)
+		if err != nil {
+			return nil, err
+		}
+		if !hasValues {
+			res.Properties[property] = nil
+			continue
+		}
+		value, err := results.ValuesString(property, ",")
+		if err != nil {
+			return nil, err
+		}
+		res.Properties[property] = &value
+	}
+
+	deviceId, err := results.DeviceId()
+	if err != nil {
+		return nil, err
+	}
+	res.MatchMetrics = matchMetrics{
+		Method:     common.MatchMethodName(results.Method()),
+		Drift:      results.Drift(),
+		Difference: results.Difference(),
+		Iterations: results.Iterations(),
+		DeviceId:   deviceId,
+	}
+	return res, nil
+}
+
+// detect handles POST /v1/detect
+func (s *service) detect(w http.ResponseWriter, r *http.Request) {
+	if !checkMethod(w, r, http.MethodPost) {
+		return
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, maxBodySize)
+
+	evidence, err := readEvidence(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	res, err := processEvidence(r.Context(), s.tracer, s.engine, evidence)
+	if err != nil {
+		log.Printf("ERROR: Failed to perform detection. %v\n", err)
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, res)
+}
+
+// detectBatch handles POST /v1/detect/batch
+func (s *service) detectBatch(w http.ResponseWriter, r *http.Request) {
+	if !checkMethod(w, r, http.MethodPost) {
+		return
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, maxBatchBodySize)
+
+	var values []map[string]string
+	if err := json.NewDecoder(r.Body).Decode(&values); err != nil {
+		writeError(w, http.StatusBadRequest,
+			fmt.Errorf("invalid batch: %w", err))
+		return
+	}
+	if len(values) > maxBatchSize {
+		writeError(w, http.StatusRequestEntityTooLarge,
+			fmt.Errorf("batch must not contain more than %d evidence sets",
+				maxBatchSize))
+		return
+	}
+
+	// Evidence sets which cannot be converted are reported as errors and
+	// skipped so that indexes stay aligned.
+	res := batchResponse{Results: make([]batchItem, len(values))}
+	batch := make([][]onpremise.Evidence, len(values))
+	invalid := make([]error, len(values))
+	for i, v := range values {
+		batch[i], invalid[i] = convertEvidence(v)
+	}
+
+	errs, err := common.ProcessBatchContext(r.Context(), s.tracer, s.engine,
+		batch, invalid, s.workers,
+		func(i int, results *dd.ResultsHash) error {
+			item, err := newDetectResponse(results)
+			if err != nil {
+				return err
+			}
+			res.Results[i] = batchItem{
+				Properties:   item.Properties,
+				MatchMetrics: &item.MatchMetrics,
+			}
+			return nil
+		})
+	if err != nil {
+		// The request was cancelled so the batch is incomplete
+		writeError(w, http.StatusServiceUnavailable, err)
+		return
+	}
+	for i, err := range errs {
+		if err != nil {
+			res.Results[i] = batchItem{Error: err.Error()}
+		}
+	}
+	writeJSON(w, http.StatusOK, res)
+}
+
+// properties handles GET /v1/properties
+func (s *service) properties(w http.ResponseWriter, r *http.Request) {
+	if !checkMethod(w, r, http.MethodGet) {
+		return
+	}
+
+	// Results are only used to access the data set so no detection is needed
+	results := s.engine.NewResultsHash(0, 0)
+	defer results.Free()
+
+	keys := s.engine.GetHttpHeaderKeys()
+	res := propertiesResponse{
+		Properties:   results.AvailableProperties(),
+		EvidenceKeys: make([]string, 0, len(keys)),
+	}
+	for _, key := range keys {
+		res.EvidenceKeys = append(res.EvidenceKeys, common.EvidenceKeyString(key))
+	}
+	writeJSON(w, http.StatusOK, res)
+}
+
+func main() {
+	common.RunExample(
+		func(params common.ExampleParams) error {
+			//... Example code
+			//Create config
+			config := dd.NewConfigHash(dd.Balanced)
+			config.SetConcurrency(uint16(runtime.NumCPU()))
+			config.SetUseUpperPrefixHeaders(false)
+
+			// Record the update events logged by the engine
+			updateMetrics := metrics.New()
+			logger := common.NewUpdateEventLogger(
+				updateMetrics.ObserveUpdateEvent,
+				log.Default())
+
+			//Create on-premise engine
+			engine, err := onpremise.New(
+				// Optimized config provided
+				onpremise.WithConfigHash(config),
+				// Path to your data file
+				onpremise.WithDataFile(params.DataFile),
+				// Disable automatic updates.
+				onpremise.WithAutoUpdate(false),
+				// Observe data file reloads
+				onpremise.WithCustomLogger(logger),
+			)
+
+			if err != nil {
+				log.Fatalf("Failed to create engine: %v", err)
+			}
+
+			// Make sure engine is stopped after the function execution
+			defer engine.Stop()
+
+			mux := newServeMux(engine, common.BatchWorkers(config))
+			mux.Handle("/metrics", updateMetrics.Handler())
+			fmt.Printf("Server listening on port: %d\n", port)
+			return http.ListenAndServe(fmt.Sprintf("localhost:%d", port), mux)
+		},
+	)
+}
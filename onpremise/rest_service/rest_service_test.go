@@ -0,0 +1,212 @@
+/* *********************************************************************
+ * This Original Work is copyright of 51 Degrees Mobile Experts Limited.
+ * Copyright 2019 51 Degrees Mobile Experts Limited, 5 Charlotte Close,
+ * Caversham, Reading, Berkshire, United Kingdom RG4 7BY.
+ *
+ * This Original Work is licensed under the European Union Public Licence (EUPL)
+ * v.1.2 and is subject to its terms as set out below.
+ *
+ * If a copy of the EUPL was not distributed with this file, You can obtain
+ * one at https://opensource.org/licenses/EUPL-1.2.
+ *
+ * The 'Compatible Licences' set out in the Appendix to the EUPL (as may be
+ * amended by the European Commission) shall be deemed incompatible for
+ * the purposes of the Work and the provisions of the compatibility
+ * clause in Article 5 of the EUPL shall not apply.
+ *
+ * If using the Work as, or as part of, a network application, by
+ * including the attribution notice(s) required under Article 5 of the EUPL
+ * in the end user terms of the application under an appropriate heading,
+ * such notice(s) shall fulfill the requirements of that article.
+ * ********************************************************************* */
+
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/51Degrees/device-detection-go/v4/dd"
+	"github.com/51Degrees/device-detection-go/v4/onpremise"
+)
+
+var engine *onpremise.Engine
+
+const mobileUA = "Mozilla/5.0 (iPhone; CPU iPhone OS 17_1_2 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.1.2 Mobile/15E148 Safari/604.1"
+
+func TestMain(m *testing.M) {
+	dataFiles := []string{"51Degrees-LiteV4.1.hash"}
+	filePath, err := dd.GetFilePath("../..", dataFiles)
+	if err != nil {
+		log.Fatalf("Cannot find file that matches any of \"%s\".\n",
+			strings.Join(dataFiles, ", "))
+	}
+
+	config := dd.NewConfigHash(dd.Balanced)
+	config.SetUseUpperPrefixHeaders(false)
+	engine, err = onpremise.New(
+		onpremise.WithConfigHash(config),
+		onpremise.WithDataFile(filePath),
+		onpremise.WithAutoUpdate(false),
+		onpremise.WithFileWatch(false),
+	)
+	if err != nil {
+		log.Fatalf("Failed to create engine: %v", err)
+	}
+
+	// Execute the test
+	code := m.Run()
+
+	// Make sure engine is stopped after the tests
+	engine.Stop()
+	os.Exit(code)
+}
+
+// serve sends a request to the service and returns the response.
+func serve(method string, target string, body string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, target, strings.NewReader(body))
+	rr := httptest.NewRecorder()
+	newServeMux(engine, 2).ServeHTTP(rr, r)
+	return rr
+}
+
+// Test if evidence is detected and properties and metrics are returned.
+func TestDetect(t *testing.T) {
+	body := `{"header.user-agent": "` + mobileUA + `"}`
+	rr := serve(http.MethodPost, "/v1/detect", body)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d but got %d: %s",
+			http.StatusOK, rr.Code, rr.Body.String())
+	}
+
+	var res detectResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &res); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	isMobile, ok := res.Properties["IsMobile"]
+	if !ok || isMobile == nil || *isMobile != "True" {
+		t.Errorf("Expected IsMobile 'True' but got %v", isMobile)
+	}
+	if res.MatchMetrics.DeviceId == "" {
+		t.Errorf("Expected a device id in the match metrics")
+	}
+	if res.MatchMetrics.Method == "NONE" {
+		t.Errorf("Expected a match method other than NONE")
+	}
+}
+
+// Test if invalid requests are rejected.
+func TestDetectInvalid(t *testing.T) {
+	testData := []struct {
+		method string
+		body   string
+		status int
+	}{
+		{http.MethodGet, "", http.StatusMethodNotAllowed},
+		{http.MethodPost, "not json", http.StatusBadRequest},
+		{http.MethodPost, "{}", http.StatusBadRequest},
+		{http.MethodPost, `{"user-agent": "test"}`, http.StatusBadRequest},
+	}
+
+	for _, data := range testData {
+		rr := serve(data.method, "/v1/detect", data.body)
+		if rr.Code != data.status {
+			t.Errorf("Expected status code %d for '%s' but got %d",
+				data.status, data.body, rr.Code)
+		}
+		var res errorResponse
+		if err := json.Unmarshal(rr.Body.Bytes(), &res); err != nil || res.Error == "" {
+			t.Errorf("Expected an error message for '%s'", data.body)
+		}
+	}
+}
+
+// Test if a batch is returned in order with errors reported per item.
+func TestDetectBatch(t *testing.T) {
+	desktopUA := "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/124.0.0.0 Safari/537.36"
+	items := make([]string, 0, 20)
+	for i := 0; i < 20; i++ {
+		switch i % 3 {
+		case 0:
+			items = append(items, `{"header.user-agent": "`+mobileUA+`"}`)
+		case 1:
+			items = append(items, `{"header.user-agent": "`+desktopUA+`"}`)
+		default:
+			items = append(items, `{"user-agent": "no prefix"}`)
+		}
+	}
+	body := "[" + strings.Join(items, ",") + "]"
+
+	rr := serve(http.MethodPost, "/v1/detect/batch", body)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d but got %d: %s",
+			http.StatusOK, rr.Code, rr.Body.String())
+	}
+
+	var res batchResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &res); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if len(res.Results) != len(items) {
+		t.Fatalf("Expected %d results but got %d", len(items), len(res.Results))
+	}
+	for i, item := range res.Results {
+		if i%3 == 2 {
+			if item.Error == "" || item.MatchMetrics != nil {
+				t.Errorf("Expected only an error for item %d", i)
+			}
+			continue
+		}
+		if item.Error != "" || item.MatchMetrics == nil {
+			t.Fatalf("Expected a result for item %d but got error '%s'",
+				i, item.Error)
+		}
+		expected := "True"
+		if i%3 == 1 {
+			expected = "False"
+		}
+		isMobile := item.Properties["IsMobile"]
+		if isMobile == nil || *isMobile != expected {
+			t.Errorf("Expected IsMobile '%s' for item %d but got %v",
+				expected, i, isMobile)
+		}
+	}
+}
+
+// Test if the available properties and evidence keys are listed.
+func TestProperties(t *testing.T) {
+	rr := serve(http.MethodGet, "/v1/properties", "")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d but got %d",
+			http.StatusOK, rr.Code)
+	}
+
+	var res propertiesResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &res); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	found := false
+	for _, property := range res.Properties {
+		if property == "IsMobile" {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("Expected IsMobile in the available properties")
+	}
+
+	found = false
+	for _, key := range res.EvidenceKeys {
+		if strings.EqualFold(key, "header.User-Agent") {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("Expected header.User-Agent in the evidence keys")
+	}
+}
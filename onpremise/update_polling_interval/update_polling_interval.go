@@ -32,9 +32,46 @@ func processExampleEvidence(engine *onpremise.Engine, evidence []onpremise.Evide
 
 }
 
+// Data files published longer ago than this are reported as stale
+const staleAfter = 7 * 24 * time.Hour
+
+// waitForUpdate reports the update lifecycle events of the engine until a
+// downloaded data file has been loaded or the timeout expires. Returns true
+// if a new data file was loaded.
+func waitForUpdate(events <-chan common.UpdateEvent, timeout time.Duration) bool {
+	downloaded := false
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	for {
+		select {
+		case event := <-events:
+			log.Printf("Update event '%s': %s", event.Type, event.Message)
+			switch event.Type {
+			case common.UpdateDownloaded:
+				downloaded = true
+			case common.UpdateReloaded:
+				// This is where a dashboard would be told the data file is stale
+				if age := time.Since(event.PublishedDate); age > staleAfter {
+					log.Printf("WARNING: Data file published on %s is stale.",
+						event.PublishedDate.Format("2006-01-02"))
+				}
+				if downloaded {
+					return true
+				}
+			}
+		case <-timer.C:
+			return false
+		}
+	}
+}
+
 func main() {
 	common.RunExample(
 		func(params common.ExampleParams) error {
+			// Observe the data file update lifecycle. Messages are still
+			// written to the standard logger.
+			updateLogger, events := common.NewUpdateEventChannel(16, log.Default())
+
 			//Create on-premise engine
 			engine, err := onpremise.New(
 				// Path to your data file
@@ -77,8 +114,9 @@ func main() {
 				// By default logging is on
 				// onpremise.WithLogging(false),
 
-				// Custom logger implementing LogWriter interface can be passed
-				// onpremise.WithCustomLogger()
+				// Custom logger implementing LogWriter interface can be passed,
+				// here it is used to deliver update events
+				onpremise.WithCustomLogger(updateLogger),
 
 				// Set properties for checking, default is [] = all properties
 				// onpremise.WithProperties([]string{}),
@@ -94,9 +132,12 @@ func main() {
 			processExampleEvidence(engine, common.ExampleEvidenceDesktop)
 			processExampleEvidence(engine, common.ExampleEvidenceMobile)
 
-			<-time.After(20 * time.Second)
+			// Wait for the data file to be updated rather than sleeping
+			if !waitForUpdate(events, 20*time.Second) {
+				log.Printf("No data file update within 20 seconds.")
+			}
 
-			//process again after the file has presumably been updated
+			//process again after the file has been updated
 			processExampleEvidence(engine, common.ExampleEvidenceDesktop)
 			processExampleEvidence(engine, common.ExampleEvidenceMobile)
 
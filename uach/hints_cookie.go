@@ -0,0 +1,271 @@
+/* *********************************************************************
+ * This Original Work is copyright of 51 Degrees Mobile Experts Limited.
+ * Copyright 2019 51 Degrees Mobile Experts Limited, 5 Charlotte Close,
+ * Caversham, Reading, Berkshire, United Kingdom RG4 7BY.
+ *
+ * This Original Work is licensed under the European Union Public Licence (EUPL)
+ * v.1.2 and is subject to its terms as set out below.
+ *
+ * If a copy of the EUPL was not distributed with this file, You can obtain
+ * one at https://opensource.org/licenses/EUPL-1.2.
+ *
+ * The 'Compatible Licences' set out in the Appendix to the EUPL (as may be
+ * amended by the European Commission) shall be deemed incompatible for
+ * the purposes of the Work and the provisions of the compatibility
+ * clause in Article 5 of the EUPL shall not apply.
+ *
+ * If using the Work as, or as part of, a network application, by
+ * including the attribution notice(s) required under Article 5 of the EUPL
+ * in the end user terms of the application under an appropriate heading,
+ * such notice(s) shall fulfill the requirements of that article.
+ * ********************************************************************* */
+
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/51Degrees/device-detection-examples-go/v4/onpremise/common"
+	"github.com/51Degrees/device-detection-examples-go/v4/web/middleware"
+)
+
+// Name of the cookie which persists the client hints
+const hintsCookieName = "uach_hints"
+
+// Evidence key of client hints in the format returned by
+// navigator.userAgentData.getHighEntropyValues, encoded in base64. The engine
+// converts them to the headers they represent.
+const highEntropyValuesKey = "51D_gethighentropyvalues"
+
+// Prefix of cookie evidence in literal format
+const cookiePrefix = "cookie."
+
+// Headers of the client hints persisted in the cookie
+var hintsHeaders = []string{
+	"Sec-CH-UA",
+	"Sec-CH-UA-Arch",
+	"Sec-CH-UA-Bitness",
+	"Sec-CH-UA-Full-Version-List",
+	"Sec-CH-UA-Mobile",
+	"Sec-CH-UA-Model",
+	"Sec-CH-UA-Platform",
+	"Sec-CH-UA-Platform-Version",
+}
+
+// Errors returned when a hints cookie cannot be used
+var (
+	errHintsMalformed = errors.New("hints cookie is malformed")
+	errHintsSignature = errors.New("hints cookie signature does not match")
+	errHintsExpired   = errors.New("hints cookie has expired")
+)
+
+// hintsCookie persists the client hints sent by a browser in a signed
+// cookie, so that they can be used for later requests without them.
+type hintsCookie struct {
+	// Key of the HMAC signature
+	key []byte
+	// Time the hints are kept after they were last sent
+	maxAge time.Duration
+	// Returns the current time
+	now func() time.Time
+}
+
+// Content of the hints cookie
+type hintsCookiePayload struct {
+	// Header values keyed by header name
+	Hints map[string]string `json:"hints"`
+	// Unix time after which the hints are not used
+	Expires int64 `json:"expires"`
+}
+
+// Hints cookie used by the handler, nil if hints are not persisted
+var persistedHints *hintsCookie
+
+// newHintsCookie creates a hints cookie signed with the key.
+func newHintsCookie(key []byte, maxAge time.Duration) *hintsCookie {
+	return &hintsCookie{key, maxAge, time.Now}
+}
+
+// sign returns the signature of the payload.
+func (c *hintsCookie) sign(payload []byte) []byte {
+	mac := hmac.New(sha256.New, c.key)
+	mac.Write(payload)
+	return mac.Sum(nil)
+}
+
+// encode returns the cookie value for the hints: the payload and its
+// signature encoded in base64 and separated by '.'.
+func (c *hintsCookie) encode(hints map[string]string) (string, error) {
+	payload, err := json.Marshal(hintsCookiePayload{
+		Hints:   hints,
+		Expires: c.now().Add(c.maxAge).Unix(),
+	})
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(payload) + "." +
+		base64.RawURLEncoding.EncodeToString(c.sign(payload)), nil
+}
+
+// decode returns the hints of a cookie value if the signature matches and
+// the hints have not expired.
+func (c *hintsCookie) decode(value string) (map[string]string, error) {
+	encodedPayload, encodedSignature, found := strings.Cut(value, ".")
+	if !found {
+		return nil, errHintsMalformed
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(encodedPayload)
+	if err != nil {
+		return nil, errHintsMalformed
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(encodedSignature)
+	if err != nil {
+		return nil, errHintsMalformed
+	}
+	if !hmac.Equal(signature, c.sign(payload)) {
+		return nil, errHintsSignature
+	}
+	var p hintsCookiePayload
+	if err := json.Unmarshal(payload, &p); err != nil {
+		return nil, errHintsMalformed
+	}
+	if c.now().Unix() > p.Expires {
+		return nil, errHintsExpired
+	}
+	return p.Hints, nil
+}
+
+// load returns the hints persisted in the cookie of the request. Invalid
+// cookies are ignored.
+func (c *hintsCookie) load(r *http.Request) map[string]string {
+	cookie, err := r.Cookie(hintsCookieName)
+	if err != nil {
+		return nil
+	}
+	hints, err := c.decode(cookie.Value)
+	if err != nil {
+		log.Printf("Ignoring client hints cookie. %v\n", err)
+		return nil
+	}
+	return hints
+}
+
+// store sets the cookie of the response to the hints.
+func (c *hintsCookie) store(
+	w http.ResponseWriter,
+	r *http.Request,
+	hints map[string]string) error {
+	value, err := c.encode(hints)
+	if err != nil {
+		return err
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     hintsCookieName,
+		Value:    value,
+		Path:     "/",
+		MaxAge:   int(c.maxAge.Seconds()),
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+	return nil
+}
+
+// apply persists the hints sent with the request together with any
+// persisted before, and returns cookie evidence for the persisted hints which
+// the request does not have. As the response then depends on the cookie,
+// Cookie is added to the Vary header so that shared caches do not return it
+// for other users.
+func (c *hintsCookie) apply(
+	w http.ResponseWriter,
+	r *http.Request,
+	sent map[string]string) []stringEvidence {
+	middleware.AddVary(w.Header(), "Cookie")
+	persisted := c.load(r)
+	if len(sent) > 0 {
+		merged := make(map[string]string, len(hintsHeaders))
+		for header, value := range persisted {
+			merged[header] = value
+		}
+		for header, value := range sent {
+			merged[header] = value
+		}
+		if err := c.store(w, r, merged); err != nil {
+			log.Printf("ERROR: Failed to persist client hints. %v\n", err)
+		}
+	}
+
+	// The engine replaces headers with the hints, so only add missing ones
+	missing := make(map[string]string)
+	for header, value := range persisted {
+		if _, ok := sent[header]; !ok {
+			missing[header] = value
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+	data, err := json.Marshal(hintsToHighEntropyValues(missing))
+	if err != nil {
+		log.Printf("ERROR: Failed to convert client hints. %v\n", err)
+		return nil
+	}
+	return []stringEvidence{{
+		cookiePrefix,
+		highEntropyValuesKey,
+		base64.StdEncoding.EncodeToString(data),
+	}}
+}
+
+// requestHints returns the client hints sent with the request, keyed by
+// header name. Hints can be headers or query parameters named after the
+// headers in lowercase, which take precedence as they do for the engine.
+func requestHints(r *http.Request) map[string]string {
+	hints := make(map[string]string)
+	query := r.URL.Query()
+	for _, header := range hintsHeaders {
+		if value := query.Get(strings.ToLower(header)); value != "" {
+			hints[header] = value
+		} else if value := r.Header.Get(header); value != "" {
+			hints[header] = value
+		}
+	}
+	return hints
+}
+
+// hintsToHighEntropyValues converts client hints headers to the values
+// returned by navigator.userAgentData.getHighEntropyValues. Headers which
+// cannot be parsed are omitted.
+func hintsToHighEntropyValues(hints map[string]string) highEntropyValues {
+	var v highEntropyValues
+	stringValue := func(header string) *string {
+		if s, err := common.ParseStringHint(hints[header]); err == nil {
+			return &s
+		}
+		return nil
+	}
+	v.Architecture = stringValue("Sec-CH-UA-Arch")
+	v.Bitness = stringValue("Sec-CH-UA-Bitness")
+	v.Model = stringValue("Sec-CH-UA-Model")
+	v.Platform = stringValue("Sec-CH-UA-Platform")
+	v.PlatformVersion = stringValue("Sec-CH-UA-Platform-Version")
+	v.Brands, _ = common.ParseBrandList(hints["Sec-CH-UA"])
+	v.FullVersionList, _ = common.ParseBrandList(hints["Sec-CH-UA-Full-Version-List"])
+	switch strings.TrimSpace(hints["Sec-CH-UA-Mobile"]) {
+	case "?1":
+		mobile := true
+		v.Mobile = &mobile
+	case "?0":
+		mobile := false
+		v.Mobile = &mobile
+	}
+	return v
+}
@@ -0,0 +1,178 @@
+/* *********************************************************************
+ * This Original Work is copyright of 51 Degrees Mobile Experts Limited.
+ * Copyright 2019 51 Degrees Mobile Experts Limited, 5 Charlotte Close,
+ * Caversham, Reading, Berkshire, United Kingdom RG4 7BY.
+ *
+ * This Original Work is licensed under the European Union Public Licence (EUPL)
+ * v.1.2 and is subject to its terms as set out below.
+ *
+ * If a copy of the EUPL was not distributed with this file, You can obtain
+ * one at https://opensource.org/licenses/EUPL-1.2.
+ *
+ * The 'Compatible Licences' set out in the Appendix to the EUPL (as may be
+ * amended by the European Commission) shall be deemed incompatible for
+ * the purposes of the Work and the provisions of the compatibility
+ * clause in Article 5 of the EUPL shall not apply.
+ *
+ * If using the Work as, or as part of, a network application, by
+ * including the attribution notice(s) required under Article 5 of the EUPL
+ * in the end user terms of the application under an appropriate heading,
+ * such notice(s) shall fulfill the requirements of that article.
+ * ********************************************************************* */
+
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/51Degrees/device-detection-examples-go/v4/onpremise/common"
+)
+
+// Client hints sent by Chrome on Windows with chromeUA
+var chromeHints = map[string]string{
+	"Sec-CH-UA":                   `" Not A;Brand";v="99", "Chromium";v="95", "Google Chrome";v="95"`,
+	"Sec-CH-UA-Full-Version-List": `" Not A;Brand";v="99.0.0.0", "Chromium";v="95.0.4638.69", "Google Chrome";v="95.0.4638.69"`,
+	"Sec-CH-UA-Mobile":            "?0",
+	"Sec-CH-UA-Model":             `""`,
+	"Sec-CH-UA-Platform":          `"Windows"`,
+	"Sec-CH-UA-Platform-Version":  `"14.0.0"`,
+}
+
+// Test if hints are decoded from the cookie they were encoded in, and the
+// cookie is rejected if it is modified or has expired.
+func TestHintsCookie(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	c := newHintsCookie([]byte("secret"), time.Hour)
+	c.now = func() time.Time { return now }
+
+	value, err := c.encode(chromeHints)
+	if err != nil {
+		t.Fatalf("Failed to encode hints. %v", err)
+	}
+	if hints, err := c.decode(value); err != nil || !reflect.DeepEqual(hints, chromeHints) {
+		t.Errorf("Expected hints %v but got %v, %v", chromeHints, hints, err)
+	}
+
+	payload, signature, _ := strings.Cut(value, ".")
+	data, _ := base64.RawURLEncoding.DecodeString(payload)
+	tampered := base64.RawURLEncoding.EncodeToString(
+		[]byte(strings.Replace(string(data), "14.0.0", "15.0.0", 1)))
+	other := newHintsCookie([]byte("other"), time.Hour)
+	testData := []struct {
+		cookie   *hintsCookie
+		value    string
+		expected error
+	}{
+		{c, tampered + "." + signature, errHintsSignature},
+		{other, value, errHintsSignature},
+		{c, payload, errHintsMalformed},
+		{c, "!." + signature, errHintsMalformed},
+	}
+	for _, data := range testData {
+		if _, err := data.cookie.decode(data.value); err != data.expected {
+			t.Errorf("Expected '%v' for '%s' but got '%v'", data.expected, data.value, err)
+		}
+	}
+
+	now = now.Add(2 * time.Hour)
+	if _, err := c.decode(value); err != errHintsExpired {
+		t.Errorf("Expected '%v' but got '%v'", errHintsExpired, err)
+	}
+}
+
+// Test if persisted hints which a request does not have are returned as
+// cookie evidence in the format of getHighEntropyValues.
+func TestHintsCookieApply(t *testing.T) {
+	c := newHintsCookie([]byte("secret"), time.Hour)
+	value, _ := c.encode(chromeHints)
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("Sec-CH-UA-Platform", `"Linux"`)
+	r.AddCookie(&http.Cookie{Name: hintsCookieName, Value: value})
+	rr := httptest.NewRecorder()
+
+	evidence := c.apply(rr, r, requestHints(r))
+	if len(evidence) != 1 || evidence[0].Prefix != cookiePrefix ||
+		evidence[0].Key != highEntropyValuesKey {
+		t.Fatalf("Expected high entropy values cookie evidence but got %v", evidence)
+	}
+	data, err := base64.StdEncoding.DecodeString(evidence[0].Value)
+	if err != nil {
+		t.Fatalf("Failed to decode evidence. %v", err)
+	}
+	var values highEntropyValues
+	if err := json.Unmarshal(data, &values); err != nil {
+		t.Fatalf("Failed to decode evidence. %v", err)
+	}
+	if values.Platform != nil {
+		t.Errorf("Expected the platform sent with the request to be omitted")
+	}
+	if values.PlatformVersion == nil || *values.PlatformVersion != "14.0.0" ||
+		values.Model == nil || *values.Model != "" ||
+		len(values.Brands) != 3 || values.Brands[1] != (common.Brand{Name: "Chromium", Version: "95"}) {
+		t.Errorf("Expected the persisted hints but got %s", data)
+	}
+
+	vary := common.SplitHeaderList(rr.Header().Values("Vary")...)
+	if !common.ContainsFold(vary, "Cookie") {
+		t.Errorf("Expected Vary to contain Cookie but got %v", vary)
+	}
+
+	// The hints sent replace those persisted
+	cookies := rr.Result().Cookies()
+	if len(cookies) != 1 {
+		t.Fatalf("Expected the hints cookie to be set but got %v", cookies)
+	}
+	hints, err := c.decode(cookies[0].Value)
+	if err != nil || hints["Sec-CH-UA-Platform"] != `"Linux"` ||
+		hints["Sec-CH-UA-Platform-Version"] != `"14.0.0"` {
+		t.Errorf("Expected merged hints but got %v, %v", hints, err)
+	}
+}
+
+// pageValue returns the value of a detection result shown in a page.
+func pageValue(body, label string) string {
+	_, value, _ := strings.Cut(body, "<b>"+label+":</b> ")
+	value, _, _ = strings.Cut(value, "<br />")
+	return value
+}
+
+// Test if a request with only the User-Agent and the hints cookie is
+// detected as the request which sent the hints.
+func TestHandlerHintsCookie(t *testing.T) {
+	initTestManager(t)
+	persistedHints = newHintsCookie([]byte("secret"), time.Hour)
+	defer func() { persistedHints = nil }()
+
+	full := httptest.NewRequest(http.MethodGet, "/", nil)
+	full.Header.Set("User-Agent", chromeUA)
+	for header, value := range chromeHints {
+		full.Header.Set(header, value)
+	}
+	rr := httptest.NewRecorder()
+	handler(rr, full)
+	expected := pageValue(rr.Body.String(), "Platform Version")
+	cookies := rr.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != hintsCookieName {
+		t.Fatalf("Expected the hints cookie to be set but got %v", cookies)
+	}
+
+	userAgentOnly := httptest.NewRequest(http.MethodGet, "/", nil)
+	userAgentOnly.Header.Set("User-Agent", chromeUA)
+	userAgentOnly.AddCookie(cookies[0])
+	rr = httptest.NewRecorder()
+	handler(rr, userAgentOnly)
+	body := rr.Body.String()
+	if !strings.Contains(body, cookiePrefix+highEntropyValuesKey) {
+		t.Errorf("Expected the persisted hints to be used as evidence")
+	}
+	if actual := pageValue(body, "Platform Version"); expected == "" || actual != expected {
+		t.Errorf("Expected Platform Version '%s' but got '%s'", expected, actual)
+	}
+}
@@ -48,6 +48,13 @@ package main
  Accept-Ch: Sec-CH-UA-Arch, Sec-CH-UA-Full-Version, Sec-CH-UA-Mobile, Sec-CH-UA-Model, Sec-CH-UA-Platform-Version, Sec-CH-UA-Platform, Sec-CH-UA
  ```
 
+ The response also includes `Critical-CH` listing the requested hints which
+ materially change the results, `Sec-CH-UA-Model` and
+ `Sec-CH-UA-Platform-Version`. A Chromium based browser which did not send
+ them retries the request with them straight away, so the first page shown
+ already uses them. `Vary` lists the User-Agent and the requested hints so
+ that caches keep a response for each combination.
+
  NOTE: To see how User Agent Client Hints, run the following command:
  ```
  curl --header "Sec-CH-UA-Platform: Windows" --header "Sec-CH-UA-Platform-Version: 14.0.0" localhost:3001
@@ -55,15 +62,51 @@ package main
  You should see the html text returned with `Platform Name` set to `Windows`, and
  `Platform Version` set to `11.0`.
 
+ Some browsers never resend client hints, e.g. in first-party iframes or behind
+ HTTP/1 proxies. Run with `-collect-hints` to add a script to the page which
+ obtains the hints from `navigator.userAgentData.getHighEntropyValues` and
+ posts them to "localhost:3001/hints". The values are converted to
+ query evidence, e.g. `query.sec-ch-ua-model`, which the engine uses in the
+ same way as the headers. The response contains the detection results and the
+ hints as query parameters, which the script uses to reload the page so that it
+ shows the results using them:
+
+ ```
+ curl -d '{"platform":"Android","platformVersion":"13.0.0","model":"Pixel 7"}' localhost:3001/hints
+ ```
+
+ After the first page the browser may stop sending some hints. Run with
+ `-hints-cookie-key <secret>` to persist the last hints sent by the browser,
+ or posted to "/hints", in a cookie signed with the secret. The cookie expires
+ after `-hints-cookie-max-age` and is ignored if it has been modified. Hints
+ which a later request does not have are taken from the cookie and used as
+ the cookie evidence `cookie.51D_gethighentropyvalues`, so that detection is
+ the same as for the request which sent them.
+
+ Detection duration, match metrics and data file reloads are exposed in the
+ Prometheus text format at "localhost:3001/metrics". The data file is checked
+ for changes every `-reload-interval`, one minute by default, and reloaded
+ when it has been replaced. Detections are performed in OpenTelemetry
+ spans which are discarded unless a tracer provider is registered with
+ otel.SetTracerProvider.
+
 */
 
 import (
+	"context"
+	"encoding/json"
+	"flag"
 	"fmt"
 	"html/template"
 	"log"
 	"net/http"
+	"net/url"
 	"strings"
+	"time"
 
+	"github.com/51Degrees/device-detection-examples-go/v4/onpremise/common"
+	"github.com/51Degrees/device-detection-examples-go/v4/web/metrics"
+	"github.com/51Degrees/device-detection-examples-go/v4/web/middleware"
 	"github.com/51Degrees/device-detection-go/v4/dd"
 )
 
@@ -86,11 +129,22 @@ type Page struct {
 	BrowserVendor   string
 	BrowserName     string
 	BrowserVersion  string
+	// Whether the page includes the script which collects client hints
+	CollectHints bool `json:"-"`
 }
 
+// Whether pages include the script which collects client hints
+var collectHints bool
+
 var manager *dd.ResourceManager
 var config *dd.ConfigHash
 
+// Metrics of the detections performed by the handler
+var detectionMetrics = metrics.New()
+
+// Tracer of the detections performed by the handler
+var tracer = common.NewTracer(nil)
+
 // Template for the response HTML page.
 
 var templ = `<!DOCTYPE HTML>
@@ -111,9 +165,11 @@ var templ = `<!DOCTYPE HTML>
 	 <br />
 	 If the server determines that the browser supports client hints, then
 	 it may request additional client hints headers by setting the
-	 Accept-CH header in the response.
+	 Accept-CH header in the response. Hints which materially change the
+	 result are also listed in the Critical-CH header, so browsers which
+	 support it retry the first request with them automatically.
 	 <br />
-	 Select the <strong>Make second request</strong> button below,
+	 For other browsers, select the <strong>Make second request</strong> button below,
 	 to use send another request to the server. This time, any
 	 additional client hints headers that have been requested
 	 will be included.
@@ -183,9 +239,93 @@ var templ = `<!DOCTYPE HTML>
 	      <b>Browser Name:</b> {{.BrowserName}}<br />
 	      <b>Browser Version:</b> {{.BrowserVersion}}<br />
 	   </div>
+	   {{if .CollectHints}}<script src="/hints.js"></script>{{end}}
    </body>
 </html>`
 
+// Script which posts the high entropy client hints to the hints path and
+// reloads the page with them as query parameters. It does nothing if the
+// browser does not support client hints or the page already has them.
+const hintsScript = `(function () {
+	if (!navigator.userAgentData ||
+		new URLSearchParams(location.search).has("sec-ch-ua-platform")) {
+		return;
+	}
+	navigator.userAgentData.getHighEntropyValues([
+		"architecture",
+		"bitness",
+		"fullVersionList",
+		"model",
+		"platformVersion"
+	]).then(function (values) {
+		return fetch("/hints", {
+			method: "POST",
+			headers: { "Content-Type": "application/json" },
+			body: JSON.stringify(values)
+		});
+	}).then(function (response) {
+		return response.json();
+	}).then(function (hints) {
+		location.replace(location.pathname + "?" + hints.query);
+	});
+})();
+`
+
+// Maximum size of the client hints posted to the hints path
+const maxHintsSize = 64 * 1024
+
+// Values returned by navigator.userAgentData.getHighEntropyValues. Values
+// which were not returned are nil.
+type highEntropyValues struct {
+	Architecture    *string        `json:"architecture,omitempty"`
+	Bitness         *string        `json:"bitness,omitempty"`
+	Brands          []common.Brand `json:"brands,omitempty"`
+	FullVersionList []common.Brand `json:"fullVersionList,omitempty"`
+	Mobile          *bool          `json:"mobile,omitempty"`
+	Model           *string        `json:"model,omitempty"`
+	Platform        *string        `json:"platform,omitempty"`
+	PlatformVersion *string        `json:"platformVersion,omitempty"`
+}
+
+// Response of the hints path
+type hintsResponse struct {
+	// Client hints as query parameters
+	Query string `json:"query"`
+	// Detection results using the client hints
+	Results *Page `json:"results"`
+}
+
+// query converts the values to query parameters named after the client hints
+// headers in lowercase, with the values the headers would have.
+func (v *highEntropyValues) query() url.Values {
+	q := make(url.Values)
+	setString := func(name string, value *string) {
+		if value != nil {
+			q.Set(name, common.FormatStringHint(*value))
+		}
+	}
+	if len(v.Brands) > 0 {
+		q.Set("sec-ch-ua", common.FormatBrandList(v.Brands))
+	}
+	if len(v.FullVersionList) > 0 {
+		q.Set("sec-ch-ua-full-version-list",
+			common.FormatBrandList(v.FullVersionList))
+	}
+	if v.Mobile != nil {
+		mobile := "?0"
+		if *v.Mobile {
+			mobile = "?1"
+		}
+		q.Set("sec-ch-ua-mobile", mobile)
+	}
+	setString("sec-ch-ua-arch", v.Architecture)
+	setString("sec-ch-ua-bitness", v.Bitness)
+	setString("sec-ch-ua-model", v.Model)
+	setString("sec-ch-ua-platform", v.Platform)
+	setString("sec-ch-ua-platform-version", v.PlatformVersion)
+	return q
+}
+
 // Prefixes in literal format
 const queryPrefix = "query."
 const headerPrefix = "header."
@@ -220,8 +360,11 @@ func extractEvidence(strEvidence []stringEvidence) *dd.Evidence {
 	evidence := dd.NewEvidenceHash(uint32(len(strEvidence)))
 	for _, e := range strEvidence {
 		prefix := dd.HttpHeaderString
-		if e.Prefix == queryPrefix {
+		switch e.Prefix {
+		case queryPrefix:
 			prefix = dd.HttpEvidenceQuery
+		case cookiePrefix:
+			prefix = dd.HttpEvidenceCookie
 		}
 		evidence.Add(prefix, e.Key, e.Value)
 	}
@@ -231,9 +374,10 @@ func extractEvidence(strEvidence []stringEvidence) *dd.Evidence {
 // function match performs a match on an input User-Agent string and determine
 // if the device is a mobile device.
 func match(
+	ctx context.Context,
 	results *dd.ResultsHash,
 	evidence *dd.Evidence) {
-	err := results.MatchEvidence(evidence)
+	err := tracer.MatchEvidence(ctx, results, evidence)
 	if err != nil {
 		log.Fatal("ERROR: Failed to perform detection.")
 	}
@@ -266,9 +410,9 @@ func getValue(
 	return value
 }
 
-// Handler for web request
-func handler(w http.ResponseWriter, r *http.Request) {
-	filteredEvidence := extractEvidenceStrings(r, manager.HttpHeaderKeys)
+// detect performs detection on the evidence. The caller is responsible for
+// freeing the returned results.
+func detect(ctx context.Context, filteredEvidence []stringEvidence) *dd.ResultsHash {
 	// Extract evidence
 	evidence := extractEvidence(filteredEvidence)
 	// Make sure evidence is freed at the end
@@ -277,47 +421,120 @@ func handler(w http.ResponseWriter, r *http.Request) {
 	// Create results
 	results := dd.NewResultsHash(manager, uint32(evidence.Count()), 0)
 
+	// Perform detection on the evidence
+	start := time.Now()
+	match(ctx, results, evidence)
+	detectionMetrics.ObserveDetection(results, time.Since(start))
+	return results
+}
+
+// newPage returns the page showing the evidence and the detection results.
+func newPage(results *dd.ResultsHash, filteredEvidence []stringEvidence) *Page {
+	return &Page{
+		Keys:            filteredEvidence,
+		HardwareVendor:  getValue(results, "HardwareVendor"),
+		HardwareName:    getValue(results, "HardwareName"),
+		DeviceType:      getValue(results, "DeviceType"),
+		PlatformVendor:  getValue(results, "PlatformVendor"),
+		PlatformName:    getValue(results, "PlatformName"),
+		PlatformVersion: getValue(results, "PlatformVersion"),
+		BrowserVendor:   getValue(results, "BrowserVendor"),
+		BrowserName:     getValue(results, "BrowserName"),
+		BrowserVersion:  getValue(results, "BrowserVersion"),
+		CollectHints:    collectHints,
+	}
+}
+
+// Handler for web request
+func handler(w http.ResponseWriter, r *http.Request) {
+	filteredEvidence := extractEvidenceStrings(r, manager.HttpHeaderKeys)
+	if persistedHints != nil {
+		filteredEvidence = append(
+			filteredEvidence,
+			persistedHints.apply(w, r, requestHints(r))...)
+	}
+	results := detect(r.Context(), filteredEvidence)
+
 	// Make sure results object is freed after function execution.
 	defer results.Free()
 
-	// Perform detection on mobile User-Agent
-	match(results, evidence)
-
 	// NOTE: Add response headers to request User-Agent Client Hints
 	// from client. This is IMPORTANT so that User-Agent Client Hints
 	// required by Device Detection engine are returned in the subsequence
-	// requests.
-	results.SetResponseHeaders(w, manager)
-
-	hardwareVendor := getValue(results, "HardwareVendor")
-	hardwareName := getValue(results, "HardwareName")
-	deviceType := getValue(results, "DeviceType")
-	platformVendor := getValue(results, "PlatformVendor")
-	platformName := getValue(results, "PlatformName")
-	platformVersion := getValue(results, "PlatformVersion")
-	browserVendor := getValue(results, "BrowserVendor")
-	browserName := getValue(results, "BrowserName")
-	browserVersion := getValue(results, "BrowserVersion")
-	p := &Page{
-		filteredEvidence,
-		hardwareVendor,
-		hardwareName,
-		deviceType,
-		platformVendor,
-		platformName,
-		platformVersion,
-		browserVendor,
-		browserName,
-		browserVersion,
+	// requests. Critical hints are requested with Critical-CH so that the
+	// browser retries this request with them.
+	err := middleware.SetClientHintsHeaders(
+		w, manager, results, middleware.DefaultCriticalHints)
+	if err != nil {
+		log.Fatalln("ERROR: Failed to set response headers.")
 	}
 
+	p := newPage(results, filteredEvidence)
+
 	// Construct the template
 	t := template.Must(template.New("dd").Parse(templ))
 	// Return the constructed template in a response
 	t.Execute(w, p)
 }
 
+// Handler for the client hints posted by the hints script. The hints are
+// converted to query evidence and used for detection with the evidence of
+// the request.
+func hintsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed),
+			http.StatusMethodNotAllowed)
+		return
+	}
+	var values highEntropyValues
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxHintsSize))
+	if err := dec.Decode(&values); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid client hints. %v", err),
+			http.StatusBadRequest)
+		return
+	}
+
+	// Add the hints to the query so they are extracted as query evidence
+	query := values.query()
+	hinted := r.Clone(r.Context())
+	hinted.URL.RawQuery = query.Encode()
+	filteredEvidence := extractEvidenceStrings(hinted, manager.HttpHeaderKeys)
+	if persistedHints != nil {
+		filteredEvidence = append(
+			filteredEvidence,
+			persistedHints.apply(w, r, requestHints(hinted))...)
+	}
+	results := detect(r.Context(), filteredEvidence)
+	defer results.Free()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(hintsResponse{
+		Query:   query.Encode(),
+		Results: newPage(results, filteredEvidence),
+	})
+}
+
+// Handler for the hints script
+func hintsScriptHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/javascript")
+	fmt.Fprint(w, hintsScript)
+}
+
 func main() {
+	flag.BoolVar(&collectHints, "collect-hints", false,
+		"Add a script to pages which posts the high entropy client hints to /hints")
+	hintsCookieKey := flag.String("hints-cookie-key", "",
+		"Secret which signs the cookie persisting client hints, none are persisted if empty")
+	hintsCookieMaxAge := flag.Duration("hints-cookie-max-age", 30*24*time.Hour,
+		"Time client hints are persisted after they were last sent")
+	reloadInterval := flag.Duration("reload-interval", time.Minute,
+		"Interval the data file is checked for changes and reloaded, 0 to disable")
+	flag.Parse()
+	if *hintsCookieKey != "" {
+		persistedHints = newHintsCookie([]byte(*hintsCookieKey), *hintsCookieMaxAge)
+	}
+
 	// Initialise manager
 	manager = dd.NewResourceManager()
 	config = dd.NewConfigHash(dd.Balanced)
@@ -343,7 +560,23 @@ func main() {
 	// Make sure manager object will be freed after the function execution
 	defer manager.Free()
 
+	// Reload the data file when it is replaced, recording each reload in the
+	// metrics
+	if *reloadInterval > 0 {
+		stop := common.WatchDataFile(filePath, *reloadInterval, func() {
+			err := manager.ReloadFromOriginalFile()
+			if err != nil {
+				log.Printf("ERROR: Failed to reload data file \"%s\". %v\n", filePath, err)
+			}
+			detectionMetrics.ObserveReload(err)
+		})
+		defer stop()
+	}
+
 	http.HandleFunc("/", handler)
+	http.HandleFunc("/hints", hintsHandler)
+	http.HandleFunc("/hints.js", hintsScriptHandler)
+	http.Handle("/metrics", detectionMetrics.Handler())
 	const port = 3001
 	fmt.Printf("Server listening on port: %d\n", port)
 	log.Fatal(http.ListenAndServe(fmt.Sprintf("localhost:%d", port), nil))
@@ -28,6 +28,7 @@ package main
 */
 
 import (
+	"encoding/json"
 	"fmt"
 	"log"
 	"net/http"
@@ -36,6 +37,7 @@ import (
 	"strings"
 	"testing"
 
+	"github.com/51Degrees/device-detection-examples-go/v4/web/clienthintstest"
 	"github.com/51Degrees/device-detection-go/v4/dd"
 )
 
@@ -177,6 +179,13 @@ func TestHandler(t *testing.T) {
 						"Sec-CH-UA",
 					},
 				},
+				{
+					"Critical-CH",
+					[]string{
+						"Sec-CH-UA-Model",
+						"Sec-CH-UA-Platform-Version",
+					},
+				},
 			},
 		},
 		{
@@ -190,6 +199,12 @@ func TestHandler(t *testing.T) {
 						"Sec-CH-UA-Platform",
 					},
 				},
+				{
+					"Critical-CH",
+					[]string{
+						"Sec-CH-UA-Platform-Version",
+					},
+				},
 			},
 		},
 		{
@@ -203,6 +218,12 @@ func TestHandler(t *testing.T) {
 						"Sec-CH-UA-Model",
 					},
 				},
+				{
+					"Critical-CH",
+					[]string{
+						"Sec-CH-UA-Model",
+					},
+				},
 			},
 		},
 		{
@@ -218,6 +239,10 @@ func TestHandler(t *testing.T) {
 						"Sec-CH-UA-Platform",
 					},
 				},
+				{
+					"Critical-CH",
+					nil,
+				},
 			},
 		},
 		{
@@ -228,6 +253,10 @@ func TestHandler(t *testing.T) {
 					"Accept-CH",
 					nil,
 				},
+				{
+					"Critical-CH",
+					nil,
+				},
 			},
 		},
 		{
@@ -238,6 +267,10 @@ func TestHandler(t *testing.T) {
 					"Accept-CH",
 					nil,
 				},
+				{
+					"Critical-CH",
+					nil,
+				},
 			},
 		},
 	}
@@ -326,3 +359,134 @@ func TestHandler(t *testing.T) {
 		}
 	}
 }
+
+// initTestManager initialises the manager used by the handlers with all
+// properties and frees it at the end of the test.
+func initTestManager(t *testing.T) {
+	manager = dd.NewResourceManager()
+	t.Cleanup(manager.Free)
+	config = dd.NewConfigHash(dd.Balanced)
+	config.SetUseUpperPrefixHeaders(false)
+	dataFiles := []string{"51Degrees-LiteV4.1.hash"}
+	filePath, err := dd.GetFilePath("..", dataFiles)
+	if err != nil {
+		t.Skipf("Cannot find file that matches any of \"%s\".",
+			strings.Join(dataFiles, ", "))
+	}
+	if err := dd.InitManagerFromFile(manager, *config, "", filePath); err != nil {
+		t.Fatalf("Failed to initialize resource manager. %v", err)
+	}
+}
+
+// Test if a browser honouring Accept-CH and Critical-CH retries the first
+// request so that the page shows detection using the platform version and
+// model, and sends them with the next request without a retry.
+func TestHandlerClientHints(t *testing.T) {
+	initTestManager(t)
+
+	client := clienthintstest.NewClient(
+		http.HandlerFunc(handler),
+		chromeUA,
+		map[string]string{
+			"Sec-CH-UA":                  `" Not A;Brand";v="99", "Chromium";v="95", "Google Chrome";v="95"`,
+			"Sec-CH-UA-Mobile":           "?0",
+			"Sec-CH-UA-Platform":         `"Windows"`,
+			"Sec-CH-UA-Platform-Version": `"14.0.0"`,
+			"Sec-CH-UA-Model":            `""`,
+		})
+	for _, expectedRequests := range []int{2, 3} {
+		rr := client.Get("/")
+		if len(client.Requests) != expectedRequests {
+			t.Fatalf("Expected %d requests but got %d",
+				expectedRequests, len(client.Requests))
+		}
+		// The evidence used is listed in the page
+		body := strings.ToLower(rr.Body.String())
+		for _, hint := range []string{"Sec-CH-UA-Platform-Version", "Sec-CH-UA-Model"} {
+			if !strings.Contains(body, strings.ToLower(hint)) {
+				t.Errorf("Expected detection to use '%s'", hint)
+			}
+		}
+	}
+}
+
+// Test if high entropy values are converted to query parameters with the
+// values of the client hints headers.
+func TestHighEntropyQuery(t *testing.T) {
+	var values highEntropyValues
+	err := json.Unmarshal([]byte(`{
+		"brands": [{"brand": "Chromium", "version": "118"}, {"brand": "Not=A?Brand", "version": "99"}],
+		"mobile": true,
+		"model": "Pixel \"7\"",
+		"platform": "Android",
+		"platformVersion": "13.0.0"
+	}`), &values)
+	if err != nil {
+		t.Fatalf("Failed to decode values. %v", err)
+	}
+
+	expected := url.Values{
+		"sec-ch-ua":                  {`"Chromium";v="118", "Not=A?Brand";v="99"`},
+		"sec-ch-ua-mobile":           {"?1"},
+		"sec-ch-ua-model":            {`"Pixel \"7\""`},
+		"sec-ch-ua-platform":         {`"Android"`},
+		"sec-ch-ua-platform-version": {`"13.0.0"`},
+	}
+	if query := values.query(); query.Encode() != expected.Encode() {
+		t.Errorf("Expected query '%s' but got '%s'", expected.Encode(), query.Encode())
+	}
+}
+
+// Test if client hints posted to the hints path are used as query evidence.
+func TestHintsHandler(t *testing.T) {
+	initTestManager(t)
+
+	body := `{"platform":"Windows","platformVersion":"14.0.0","model":""}`
+	r := httptest.NewRequest(http.MethodPost, "/hints", strings.NewReader(body))
+	r.Header.Set("User-Agent", chromeUA)
+	rr := httptest.NewRecorder()
+	hintsHandler(rr, r)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d but got %d", http.StatusOK, rr.Code)
+	}
+
+	var response hintsResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to decode response. %v", err)
+	}
+	query, err := url.ParseQuery(response.Query)
+	if err != nil || query.Get("sec-ch-ua-platform-version") != `"14.0.0"` {
+		t.Errorf("Expected the platform version in query '%s'", response.Query)
+	}
+	found := false
+	for _, e := range response.Results.Keys {
+		found = found || (e.Prefix == queryPrefix &&
+			strings.EqualFold(e.Key, "Sec-CH-UA-Platform-Version"))
+	}
+	if !found {
+		t.Errorf("Expected the platform version as query evidence but got %v",
+			response.Results.Keys)
+	}
+}
+
+// Test if invalid requests to the hints path are rejected.
+func TestHintsHandlerInvalid(t *testing.T) {
+	testData := []struct {
+		method   string
+		body     string
+		expected int
+	}{
+		{http.MethodGet, "", http.StatusMethodNotAllowed},
+		{http.MethodPost, "{", http.StatusBadRequest},
+		{http.MethodPost, `{"mobile":"yes"}`, http.StatusBadRequest},
+	}
+	for _, data := range testData {
+		r := httptest.NewRequest(data.method, "/hints", strings.NewReader(data.body))
+		rr := httptest.NewRecorder()
+		hintsHandler(rr, r)
+		if rr.Code != data.expected {
+			t.Errorf("Expected status code %d for %s '%s' but got %d",
+				data.expected, data.method, data.body, rr.Code)
+		}
+	}
+}
@@ -0,0 +1,127 @@
+/* *********************************************************************
+ * This Original Work is copyright of 51 Degrees Mobile Experts Limited.
+ * Copyright 2019 51 Degrees Mobile Experts Limited, 5 Charlotte Close,
+ * Caversham, Reading, Berkshire, United Kingdom RG4 7BY.
+ *
+ * This Original Work is licensed under the European Union Public Licence (EUPL)
+ * v.1.2 and is subject to its terms as set out below.
+ *
+ * If a copy of the EUPL was not distributed with this file, You can obtain
+ * one at https://opensource.org/licenses/EUPL-1.2.
+ *
+ * The 'Compatible Licences' set out in the Appendix to the EUPL (as may be
+ * amended by the European Commission) shall be deemed incompatible for
+ * the purposes of the Work and the provisions of the compatibility
+ * clause in Article 5 of the EUPL shall not apply.
+ *
+ * If using the Work as, or as part of, a network application, by
+ * including the attribution notice(s) required under Article 5 of the EUPL
+ * in the end user terms of the application under an appropriate heading,
+ * such notice(s) shall fulfill the requirements of that article.
+ * ********************************************************************* */
+
+/*
+Package clienthintstest provides a client which negotiates User-Agent Client
+Hints with a handler the way Chromium based browsers do, for testing how a
+server requests hints across requests.
+
+Usage:
+```
+client := clienthintstest.NewClient(handler, userAgent, hints)
+rr := client.Get("/")
+```
+*/
+package clienthintstest
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	"github.com/51Degrees/device-detection-examples-go/v4/onpremise/common"
+)
+
+// LowEntropyHints are sent with every request without being requested.
+var LowEntropyHints = []string{
+	"Sec-CH-UA",
+	"Sec-CH-UA-Mobile",
+	"Sec-CH-UA-Platform",
+}
+
+// Client simulates a Chromium based browser navigating to a single origin.
+// It sends the low entropy hints with every request and the other hints once
+// they have been requested by an Accept-CH response header. If a response
+// lists a hint in Critical-CH which was not sent but is now accepted, the
+// request is retried once with it, as the browser would do before showing
+// the response.
+type Client struct {
+	// Handler of the origin
+	Handler http.Handler
+	// User-Agent sent with every request
+	UserAgent string
+	// Hints are the values of the client hints the browser can send, keyed by
+	// header name.
+	Hints map[string]string
+	// Requests are the requests sent so far, including retries.
+	Requests []*http.Request
+	// Hints requested by the last Accept-CH header
+	accepted []string
+}
+
+// NewClient creates a client which sends requests to the handler.
+func NewClient(
+	handler http.Handler,
+	userAgent string,
+	hints map[string]string) *Client {
+	return &Client{Handler: handler, UserAgent: userAgent, Hints: hints}
+}
+
+// Get navigates to the target and returns the response which would be shown.
+func (c *Client) Get(target string) *httptest.ResponseRecorder {
+	r, rr := c.send(target)
+	// Chromium replaces the hints for the origin when Accept-CH is present
+	if values := rr.Header().Values("Accept-CH"); len(values) > 0 {
+		c.accepted = common.SplitHeaderList(values...)
+	}
+	for _, hint := range common.SplitHeaderList(rr.Header().Values("Critical-CH")...) {
+		if r.Header.Get(hint) == "" && c.value(hint) != "" {
+			_, rr = c.send(target)
+			break
+		}
+	}
+	return rr
+}
+
+// Accepted returns the hints requested by the last Accept-CH header.
+func (c *Client) Accepted() []string {
+	return c.accepted
+}
+
+// send sends a request with the hints the client currently sends.
+func (c *Client) send(target string) (*http.Request, *httptest.ResponseRecorder) {
+	r := httptest.NewRequest(http.MethodGet, target, nil)
+	r.Header.Set("User-Agent", c.UserAgent)
+	for name := range c.Hints {
+		if value := c.value(name); value != "" {
+			r.Header.Set(name, value)
+		}
+	}
+	c.Requests = append(c.Requests, r)
+	rr := httptest.NewRecorder()
+	c.Handler.ServeHTTP(rr, r)
+	return r, rr
+}
+
+// value returns the value the client sends for a hint, or an empty string
+// if it does not send the hint.
+func (c *Client) value(hint string) string {
+	if !common.ContainsFold(LowEntropyHints, hint) && !common.ContainsFold(c.accepted, hint) {
+		return ""
+	}
+	for name, value := range c.Hints {
+		if strings.EqualFold(name, hint) {
+			return value
+		}
+	}
+	return ""
+}
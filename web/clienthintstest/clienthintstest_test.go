@@ -0,0 +1,87 @@
+/* *********************************************************************
+ * This Original Work is copyright of 51 Degrees Mobile Experts Limited.
+ * Copyright 2019 51 Degrees Mobile Experts Limited, 5 Charlotte Close,
+ * Caversham, Reading, Berkshire, United Kingdom RG4 7BY.
+ *
+ * This Original Work is licensed under the European Union Public Licence (EUPL)
+ * v.1.2 and is subject to its terms as set out below.
+ *
+ * If a copy of the EUPL was not distributed with this file, You can obtain
+ * one at https://opensource.org/licenses/EUPL-1.2.
+ *
+ * The 'Compatible Licences' set out in the Appendix to the EUPL (as may be
+ * amended by the European Commission) shall be deemed incompatible for
+ * the purposes of the Work and the provisions of the compatibility
+ * clause in Article 5 of the EUPL shall not apply.
+ *
+ * If using the Work as, or as part of, a network application, by
+ * including the attribution notice(s) required under Article 5 of the EUPL
+ * in the end user terms of the application under an appropriate heading,
+ * such notice(s) shall fulfill the requirements of that article.
+ * ********************************************************************* */
+
+package clienthintstest
+
+import (
+	"net/http"
+	"testing"
+)
+
+// Handler which requests the model and platform version, with the model
+// being critical.
+var hintsHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Accept-CH", "Sec-CH-UA-Model, Sec-CH-UA-Platform-Version")
+	w.Header().Set("Critical-CH", "Sec-CH-UA-Model")
+})
+
+// Test if the first request is retried with the critical hints and the
+// accepted hints are sent with later requests.
+func TestClientCriticalHints(t *testing.T) {
+	c := NewClient(hintsHandler, "Mozilla/5.0", map[string]string{
+		"Sec-CH-UA-Platform":         `"Android"`,
+		"Sec-CH-UA-Platform-Version": `"13.0.0"`,
+		"Sec-CH-UA-Model":            `"Pixel 7"`,
+	})
+
+	c.Get("/")
+	if len(c.Requests) != 2 {
+		t.Fatalf("Expected the first request to be retried but got %d requests",
+			len(c.Requests))
+	}
+	first, retry := c.Requests[0], c.Requests[1]
+	if first.Header.Get("Sec-CH-UA-Platform") != `"Android"` ||
+		first.Header.Get("Sec-CH-UA-Model") != "" {
+		t.Errorf("Expected only low entropy hints in the first request but got %v",
+			first.Header)
+	}
+	if retry.Header.Get("Sec-CH-UA-Model") != `"Pixel 7"` ||
+		retry.Header.Get("Sec-CH-UA-Platform-Version") != `"13.0.0"` {
+		t.Errorf("Expected the accepted hints in the retry but got %v", retry.Header)
+	}
+
+	c.Get("/next")
+	if len(c.Requests) != 3 {
+		t.Fatalf("Expected no retry once hints are accepted but got %d requests",
+			len(c.Requests))
+	}
+	if c.Requests[2].Header.Get("Sec-CH-UA-Model") != `"Pixel 7"` {
+		t.Errorf("Expected the accepted hints in the next request but got %v",
+			c.Requests[2].Header)
+	}
+}
+
+// Test if a request is not retried for a critical hint the client cannot
+// send.
+func TestClientMissingCriticalHint(t *testing.T) {
+	c := NewClient(hintsHandler, "Mozilla/5.0", map[string]string{
+		"Sec-CH-UA-Platform": `"Windows"`,
+	})
+	c.Get("/")
+	if len(c.Requests) != 1 {
+		t.Errorf("Expected no retry without a model but got %d requests",
+			len(c.Requests))
+	}
+	if len(c.Accepted()) != 2 {
+		t.Errorf("Expected 2 accepted hints but got %v", c.Accepted())
+	}
+}
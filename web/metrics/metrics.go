@@ -0,0 +1,254 @@
+/* *********************************************************************
+ * This Original Work is copyright of 51 Degrees Mobile Experts Limited.
+ * Copyright 2019 51 Degrees Mobile Experts Limited, 5 Charlotte Close,
+ * Caversham, Reading, Berkshire, United Kingdom RG4 7BY.
+ *
+ * This Original Work is licensed under the European Union Public Licence (EUPL)
+ * v.1.2 and is subject to its terms as set out below.
+ *
+ * If a copy of the EUPL was not distributed with this file, You can obtain
+ * one at https://opensource.org/licenses/EUPL-1.2.
+ *
+ * The 'Compatible Licences' set out in the Appendix to the EUPL (as may be
+ * amended by the European Commission) shall be deemed incompatible for
+ * the purposes of the Work and the provisions of the compatibility
+ * clause in Article 5 of the EUPL shall not apply.
+ *
+ * If using the Work as, or as part of, a network application, by
+ * including the attribution notice(s) required under Article 5 of the EUPL
+ * in the end user terms of the application under an appropriate heading,
+ * such notice(s) shall fulfill the requirements of that article.
+ * ********************************************************************* */
+
+/*
+Package metrics records device detection throughput, match quality and data
+file update counts, and exposes them in the Prometheus text format.
+
+Usage:
+```
+m := metrics.New()
+mw := middleware.New(manager, middleware.WithMetrics(m))
+http.Handle("/", mw.Handler(http.HandlerFunc(page)))
+http.Handle("/metrics", m.Handler())
+```
+
+The following metrics are exposed:
+```
+device_detection_duration_seconds     Histogram of the time taken by detections
+device_detection_total                Detections by match method
+device_detection_errors_total         Detections which failed
+device_detection_drift                Histogram of the drift of detections
+device_detection_difference           Histogram of the difference of detections
+device_detection_reloads_total        Data file reloads by result
+device_detection_update_events_total  Data file update events by type
+```
+*/
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/51Degrees/device-detection-examples-go/v4/onpremise/common"
+	"github.com/51Degrees/device-detection-go/v4/dd"
+)
+
+// Content type of the Prometheus text format
+const contentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// Prefix of all metric names
+const namespace = "device_detection_"
+
+// Upper bounds of the detection duration buckets in seconds
+var DurationBuckets = []float64{
+	0.00001, 0.000025, 0.00005, 0.0001, 0.00025, 0.0005,
+	0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1}
+
+// Upper bounds of the drift and difference buckets
+var MatchBuckets = []float64{0, 1, 2, 5, 10, 20, 50, 100, 200, 500, 1000}
+
+// Results of a data file reload
+const (
+	reloadSuccess = "success"
+	reloadFailure = "failure"
+)
+
+// histogram counts observations in buckets with cumulative upper bounds.
+type histogram struct {
+	bounds []float64
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+func newHistogram(bounds []float64) *histogram {
+	return &histogram{bounds: bounds, counts: make([]uint64, len(bounds))}
+}
+
+func (h *histogram) observe(v float64) {
+	for i, bound := range h.bounds {
+		if v <= bound {
+			h.counts[i]++
+		}
+	}
+	h.sum += v
+	h.count++
+}
+
+// Metrics holds the metrics of a detection service. It is safe for
+// concurrent use.
+type Metrics struct {
+	mutex        sync.Mutex
+	duration     *histogram
+	drift        *histogram
+	difference   *histogram
+	methods      map[string]uint64
+	errors       uint64
+	reloads      map[string]uint64
+	updateEvents map[string]uint64
+}
+
+// New creates metrics with no observations.
+func New() *Metrics {
+	m := &Metrics{
+		duration:     newHistogram(DurationBuckets),
+		drift:        newHistogram(MatchBuckets),
+		difference:   newHistogram(MatchBuckets),
+		methods:      make(map[string]uint64),
+		reloads:      map[string]uint64{reloadSuccess: 0, reloadFailure: 0},
+		updateEvents: make(map[string]uint64),
+	}
+	// Report all methods so that rates can be calculated from the start
+	for _, method := range []dd.MatchMethod{
+		dd.Performance, dd.Combined, dd.Predictive, dd.None} {
+		m.methods[common.MatchMethodName(method)] = 0
+	}
+	return m
+}
+
+// ObserveDetection records a successful detection which took the duration.
+func (m *Metrics) ObserveDetection(results *dd.ResultsHash, d time.Duration) {
+	m.observe(
+		results.Method(),
+		results.Drift(),
+		results.Difference(),
+		d)
+}
+
+func (m *Metrics) observe(
+	method dd.MatchMethod,
+	drift int32,
+	difference int32,
+	d time.Duration) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.duration.observe(d.Seconds())
+	m.methods[common.MatchMethodName(method)]++
+	m.drift.observe(float64(drift))
+	m.difference.observe(float64(difference))
+}
+
+// ObserveError records a detection which failed.
+func (m *Metrics) ObserveError() {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.errors++
+}
+
+// ObserveReload records a reload of the data file. A nil error is counted
+// as a success.
+func (m *Metrics) ObserveReload(err error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if err != nil {
+		m.reloads[reloadFailure]++
+	} else {
+		m.reloads[reloadSuccess]++
+	}
+}
+
+// ObserveUpdateEvent records a data file update event of an engine. Reloaded
+// and reload failed events are also counted as reloads. It can be used as
+// the handler of a common.UpdateEventLogger.
+func (m *Metrics) ObserveUpdateEvent(event common.UpdateEvent) {
+	switch event.Type {
+	case common.UpdateReloaded:
+		m.ObserveReload(nil)
+	case common.UpdateReloadFailed:
+		m.ObserveReload(fmt.Errorf("%s", event.Message))
+	}
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.updateEvents[event.Type.String()]++
+}
+
+// Handler returns a handler which responds with the metrics in the
+// Prometheus text format.
+func (m *Metrics) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", contentType)
+		if err := m.Write(w); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	})
+}
+
+// Write writes the metrics to the writer in the Prometheus text format.
+func (m *Metrics) Write(w io.Writer) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	b := bufio.NewWriter(w)
+	writeHistogram(b, "duration_seconds",
+		"Time taken to perform a detection.", m.duration)
+	writeCounters(b, "total", "Detections by match method.", "method",
+		m.methods)
+	writeHeader(b, "errors_total", "Detections which failed.", "counter")
+	fmt.Fprintf(b, "%serrors_total %d\n", namespace, m.errors)
+	writeHistogram(b, "drift", "Drift of detections.", m.drift)
+	writeHistogram(b, "difference", "Difference of detections.",
+		m.difference)
+	writeCounters(b, "reloads_total", "Data file reloads by result.",
+		"result", m.reloads)
+	writeCounters(b, "update_events_total",
+		"Data file update events by type.", "event", m.updateEvents)
+	return b.Flush()
+}
+
+func writeHeader(w io.Writer, name, help, metricType string) {
+	fmt.Fprintf(w, "# HELP %s%s %s\n", namespace, name, help)
+	fmt.Fprintf(w, "# TYPE %s%s %s\n", namespace, name, metricType)
+}
+
+// writeCounters writes a counter with a label in the order of label values.
+func writeCounters(
+	w io.Writer,
+	name, help, label string,
+	values map[string]uint64) {
+	writeHeader(w, name, help, "counter")
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		fmt.Fprintf(w, "%s%s{%s=%q} %d\n", namespace, name, label, k, values[k])
+	}
+}
+
+func writeHistogram(w io.Writer, name, help string, h *histogram) {
+	writeHeader(w, name, help, "histogram")
+	for i, bound := range h.bounds {
+		fmt.Fprintf(w, "%s%s_bucket{le=\"%s\"} %d\n", namespace, name,
+			strconv.FormatFloat(bound, 'g', -1, 64), h.counts[i])
+	}
+	fmt.Fprintf(w, "%s%s_bucket{le=\"+Inf\"} %d\n", namespace, name, h.count)
+	fmt.Fprintf(w, "%s%s_sum %s\n", namespace, name,
+		strconv.FormatFloat(h.sum, 'g', -1, 64))
+	fmt.Fprintf(w, "%s%s_count %d\n", namespace, name, h.count)
+}
@@ -0,0 +1,101 @@
+/* *********************************************************************
+ * This Original Work is copyright of 51 Degrees Mobile Experts Limited.
+ * Copyright 2019 51 Degrees Mobile Experts Limited, 5 Charlotte Close,
+ * Caversham, Reading, Berkshire, United Kingdom RG4 7BY.
+ *
+ * This Original Work is licensed under the European Union Public Licence (EUPL)
+ * v.1.2 and is subject to its terms as set out below.
+ *
+ * If a copy of the EUPL was not distributed with this file, You can obtain
+ * one at https://opensource.org/licenses/EUPL-1.2.
+ *
+ * The 'Compatible Licences' set out in the Appendix to the EUPL (as may be
+ * amended by the European Commission) shall be deemed incompatible for
+ * the purposes of the Work and the provisions of the compatibility
+ * clause in Article 5 of the EUPL shall not apply.
+ *
+ * If using the Work as, or as part of, a network application, by
+ * including the attribution notice(s) required under Article 5 of the EUPL
+ * in the end user terms of the application under an appropriate heading,
+ * such notice(s) shall fulfill the requirements of that article.
+ * ********************************************************************* */
+
+package metrics
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/51Degrees/device-detection-examples-go/v4/onpremise/common"
+	"github.com/51Degrees/device-detection-go/v4/dd"
+)
+
+// Test if observations are written in the Prometheus text format.
+func TestMetrics(t *testing.T) {
+	m := New()
+	m.observe(dd.Performance, 0, 0, 200*time.Microsecond)
+	m.observe(dd.Performance, 0, 3, 2*time.Millisecond)
+	m.observe(dd.Predictive, 10, 0, 20*time.Millisecond)
+	m.ObserveError()
+	m.ObserveReload(errors.New("bad file"))
+	m.ObserveUpdateEvent(common.UpdateEvent{Type: common.UpdateDownloaded})
+	m.ObserveUpdateEvent(common.UpdateEvent{Type: common.UpdateReloaded})
+
+	var b strings.Builder
+	if err := m.Write(&b); err != nil {
+		t.Fatalf("Failed to write metrics. %v", err)
+	}
+	output := b.String()
+
+	for _, expected := range []string{
+		"# TYPE device_detection_duration_seconds histogram\n",
+		"device_detection_duration_seconds_bucket{le=\"0.00025\"} 1\n",
+		"device_detection_duration_seconds_bucket{le=\"0.0025\"} 2\n",
+		"device_detection_duration_seconds_bucket{le=\"+Inf\"} 3\n",
+		"device_detection_duration_seconds_count 3\n",
+		"# TYPE device_detection_total counter\n",
+		"device_detection_total{method=\"PERFORMANCE\"} 2\n",
+		"device_detection_total{method=\"PREDICTIVE\"} 1\n",
+		"device_detection_total{method=\"COMBINED\"} 0\n",
+		"device_detection_total{method=\"NONE\"} 0\n",
+		"device_detection_errors_total 1\n",
+		"device_detection_drift_bucket{le=\"0\"} 2\n",
+		"device_detection_drift_bucket{le=\"10\"} 3\n",
+		"device_detection_drift_sum 10\n",
+		"device_detection_difference_bucket{le=\"2\"} 2\n",
+		"device_detection_difference_bucket{le=\"5\"} 3\n",
+		"device_detection_reloads_total{result=\"failure\"} 1\n",
+		"device_detection_reloads_total{result=\"success\"} 1\n",
+		"device_detection_update_events_total{event=\"downloaded\"} 1\n",
+		"device_detection_update_events_total{event=\"reloaded\"} 1\n",
+	} {
+		if !strings.Contains(output, expected) {
+			t.Errorf("Expected output to contain '%s' but got:\n%s",
+				strings.TrimSpace(expected), output)
+		}
+	}
+}
+
+// Test if the handler responds with the Prometheus content type.
+func TestHandler(t *testing.T) {
+	m := New()
+	m.observe(dd.Combined, 0, 0, time.Millisecond)
+
+	rr := httptest.NewRecorder()
+	m.Handler().ServeHTTP(rr, httptest.NewRequest("GET", "/metrics", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status %d but got %d", http.StatusOK, rr.Code)
+	}
+	if ct := rr.Header().Get("Content-Type"); ct != contentType {
+		t.Errorf("Expected content type '%s' but got '%s'", contentType, ct)
+	}
+	if !strings.Contains(rr.Body.String(),
+		"device_detection_total{method=\"COMBINED\"} 1\n") {
+		t.Errorf("Expected detection to be counted but got:\n%s",
+			rr.Body.String())
+	}
+}
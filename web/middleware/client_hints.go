@@ -0,0 +1,115 @@
+/* *********************************************************************
+ * This Original Work is copyright of 51 Degrees Mobile Experts Limited.
+ * Copyright 2019 51 Degrees Mobile Experts Limited, 5 Charlotte Close,
+ * Caversham, Reading, Berkshire, United Kingdom RG4 7BY.
+ *
+ * This Original Work is licensed under the European Union Public Licence (EUPL)
+ * v.1.2 and is subject to its terms as set out below.
+ *
+ * If a copy of the EUPL was not distributed with this file, You can obtain
+ * one at https://opensource.org/licenses/EUPL-1.2.
+ *
+ * The 'Compatible Licences' set out in the Appendix to the EUPL (as may be
+ * amended by the European Commission) shall be deemed incompatible for
+ * the purposes of the Work and the provisions of the compatibility
+ * clause in Article 5 of the EUPL shall not apply.
+ *
+ * If using the Work as, or as part of, a network application, by
+ * including the attribution notice(s) required under Article 5 of the EUPL
+ * in the end user terms of the application under an appropriate heading,
+ * such notice(s) shall fulfill the requirements of that article.
+ * ********************************************************************* */
+
+package middleware
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/51Degrees/device-detection-examples-go/v4/onpremise/common"
+	"github.com/51Degrees/device-detection-go/v4/dd"
+)
+
+// Response headers used to negotiate User-Agent Client Hints
+const (
+	acceptCHHeader   = "Accept-CH"
+	criticalCHHeader = "Critical-CH"
+	varyHeader       = "Vary"
+)
+
+// DefaultCriticalHints are the client hints which materially change the
+// detection results: the platform version distinguishes Windows 11 from
+// Windows 10 and the model identifies Android devices.
+var DefaultCriticalHints = []string{
+	"Sec-CH-UA-Model",
+	"Sec-CH-UA-Platform-Version",
+}
+
+// SetClientHintsHeaders sets the response headers which request User-Agent
+// Client Hints from the browser:
+//   - Accept-CH lists the hints the engine can use for the results, which the
+//     browser sends in subsequent requests.
+//   - Critical-CH lists those of the accepted hints which are in `critical`. A
+//     compliant browser which did not send them retries the request straight
+//     away with them, rather than waiting for the next request.
+//   - Vary adds the User-Agent and the accepted hints to any existing value,
+//     so that caches keep a response for each combination of them.
+func SetClientHintsHeaders(
+	w http.ResponseWriter,
+	manager *dd.ResourceManager,
+	results *dd.ResultsHash,
+	critical []string) error {
+	responseHeaders, err := results.ResponseHeaders(manager)
+	if err != nil {
+		return err
+	}
+	setClientHintsHeaders(w, responseHeaders, critical)
+	return nil
+}
+
+// setClientHintsHeaders sets the response headers for the response headers
+// of the results, see SetClientHintsHeaders.
+func setClientHintsHeaders(
+	w http.ResponseWriter,
+	responseHeaders map[string]string,
+	critical []string) {
+	var accepted []string
+	for header, value := range responseHeaders {
+		if strings.EqualFold(header, acceptCHHeader) {
+			accepted = append(accepted, common.SplitHeaderList(value)...)
+		} else {
+			w.Header().Set(header, value)
+		}
+	}
+
+	h := w.Header()
+	AddVary(h, "User-Agent")
+	if len(accepted) == 0 {
+		return
+	}
+	h.Set(acceptCHHeader, strings.Join(accepted, ", "))
+	var criticalAccepted []string
+	for _, hint := range accepted {
+		if common.ContainsFold(critical, hint) {
+			criticalAccepted = append(criticalAccepted, hint)
+		}
+	}
+	if len(criticalAccepted) > 0 {
+		h.Set(criticalCHHeader, strings.Join(criticalAccepted, ", "))
+	}
+	AddVary(h, accepted...)
+}
+
+// AddVary adds header names to the Vary header unless they are already
+// present.
+func AddVary(h http.Header, names ...string) {
+	existing := common.SplitHeaderList(h.Values(varyHeader)...)
+	for _, name := range names {
+		if !common.ContainsFold(existing, name) {
+			existing = append(existing, name)
+		}
+	}
+	if len(existing) > 0 {
+		h.Set(varyHeader, strings.Join(existing, ", "))
+	}
+}
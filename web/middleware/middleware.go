@@ -0,0 +1,319 @@
+/* *********************************************************************
+ * This Original Work is copyright of 51 Degrees Mobile Experts Limited.
+ * Copyright 2019 51 Degrees Mobile Experts Limited, 5 Charlotte Close,
+ * Caversham, Reading, Berkshire, United Kingdom RG4 7BY.
+ *
+ * This Original Work is licensed under the European Union Public Licence (EUPL)
+ * v.1.2 and is subject to its terms as set out below.
+ *
+ * If a copy of the EUPL was not distributed with this file, You can obtain
+ * one at https://opensource.org/licenses/EUPL-1.2.
+ *
+ * The 'Compatible Licences' set out in the Appendix to the EUPL (as may be
+ * amended by the European Commission) shall be deemed incompatible for
+ * the purposes of the Work and the provisions of the compatibility
+ * clause in Article 5 of the EUPL shall not apply.
+ *
+ * If using the Work as, or as part of, a network application, by
+ * including the attribution notice(s) required under Article 5 of the EUPL
+ * in the end user terms of the application under an appropriate heading,
+ * such notice(s) shall fulfill the requirements of that article.
+ * ********************************************************************* */
+
+/*
+Package middleware provides a net/http middleware which performs device
+detection once per request and makes the result available to the wrapped
+handler through the request context.
+
+Usage:
+```
+mw := middleware.New(manager)
+http.Handle("/", mw.Handler(http.HandlerFunc(page)))
+```
+
+Inside the wrapped handler the result is obtained with FromContext:
+```
+result, ok := middleware.FromContext(r.Context())
+browserName, hasValues, err := result.Value("BrowserName")
+```
+
+By default the Accept-CH response header is set from the detection results so
+that User-Agent Client Hints required by the engine are sent by the browser in
+subsequent requests. Critical-CH is set for the hints which materially change
+the results, see WithCriticalHints, so that compliant browsers retry the
+first request with them. Vary is set to the User-Agent and the requested
+hints so that caches keep a response for each combination.
+
+Detection can be avoided for repeated evidence with a result cache, see
+WithResultCache:
+```
+cache := common.NewResultCache(10000)
+mw := middleware.New(manager, middleware.WithResultCache(cache))
+```
+*/
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/51Degrees/device-detection-examples-go/v4/onpremise/common"
+	"github.com/51Degrees/device-detection-examples-go/v4/web/metrics"
+	"github.com/51Degrees/device-detection-go/v4/dd"
+	"github.com/51Degrees/device-detection-go/v4/onpremise"
+)
+
+// Prefix added to header keys when the engine uses upper prefixed headers
+const upperHeaderPrefix = "HTTP_"
+
+// ErrorHandler is called when detection fails for a request. The wrapped
+// handler is not called.
+type ErrorHandler func(w http.ResponseWriter, r *http.Request, err error)
+
+// Middleware performs device detection for each request using a resource
+// manager and stores the result in the request context.
+type Middleware struct {
+	manager            *dd.ResourceManager
+	setResponseHeaders bool
+	criticalHints      []string
+	errorHandler       ErrorHandler
+	metrics            *metrics.Metrics
+	tracer             *common.Tracer
+	cache              *common.ResultCache
+	cacheProperties    []string
+}
+
+// Option configures a Middleware
+type Option func(m *Middleware)
+
+// WithResponseHeaders enables or disables setting the Accept-CH,
+// Critical-CH and Vary response headers from the detection results. Default is
+// true.
+func WithResponseHeaders(enabled bool) Option {
+	return func(m *Middleware) {
+		m.setResponseHeaders = enabled
+	}
+}
+
+// WithCriticalHints sets the client hints listed in the Critical-CH response
+// header when they are also in Accept-CH. Default is DefaultCriticalHints.
+func WithCriticalHints(hints ...string) Option {
+	return func(m *Middleware) {
+		m.criticalHints = hints
+	}
+}
+
+// WithErrorHandler sets the handler called when detection fails. The default
+// handler logs the error and responds with 500 Internal Server Error.
+func WithErrorHandler(handler ErrorHandler) Option {
+	return func(m *Middleware) {
+		m.errorHandler = handler
+	}
+}
+
+// WithMetrics records the duration and match metrics of each detection.
+// Default is no metrics.
+func WithMetrics(m *metrics.Metrics) Option {
+	return func(mw *Middleware) {
+		mw.metrics = m
+	}
+}
+
+// WithTracer performs each detection in a span which is a child of any span
+// in the request context. Default is no tracing.
+func WithTracer(tracer *common.Tracer) Option {
+	return func(mw *Middleware) {
+		mw.tracer = tracer
+	}
+}
+
+// WithResultCache reuses the results of previous requests with the same
+// evidence from the cache rather than performing detection again. Only the
+// values of the properties are cached, or of all available properties if
+// none are given, so Result.Results is nil and Result.Value must be used.
+// Results served from the cache are not recorded in the metrics. Default is
+// no cache.
+func WithResultCache(cache *common.ResultCache, properties ...string) Option {
+	return func(mw *Middleware) {
+		mw.cache = cache
+		mw.cacheProperties = properties
+	}
+}
+
+// New creates a middleware which performs detection using the manager. The
+// manager must be initialised and must outlive the middleware.
+func New(manager *dd.ResourceManager, opts ...Option) *Middleware {
+	m := &Middleware{
+		manager:            manager,
+		setResponseHeaders: true,
+		criticalHints:      DefaultCriticalHints,
+		errorHandler:       defaultErrorHandler,
+	}
+	for _, opt := range opts {
+		opt(m)
+	}
+	return m
+}
+
+// defaultErrorHandler logs the error and responds with a server error.
+func defaultErrorHandler(w http.ResponseWriter, r *http.Request, err error) {
+	log.Printf("ERROR: Failed to perform detection. %v\n", err)
+	http.Error(w, http.StatusText(http.StatusInternalServerError),
+		http.StatusInternalServerError)
+}
+
+// Handler wraps the next handler so that detection is performed before it is
+// called. The results are freed once the next handler returns.
+func (m *Middleware) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		evidence := ExtractEvidence(r, m.manager.HttpHeaderKeys)
+		if m.cache != nil {
+			m.serveCached(w, r, next, evidence)
+			return
+		}
+		results, err := m.detect(r, evidence)
+		if err != nil {
+			m.errorHandler(w, r, err)
+			return
+		}
+		// Make sure results object is freed after the request is handled.
+		defer results.Free()
+
+		// NOTE: Add response headers to request User-Agent Client Hints
+		// from client so that they are returned in subsequent requests.
+		if m.setResponseHeaders {
+			err := SetClientHintsHeaders(w, m.manager, results, m.criticalHints)
+			if err != nil {
+				m.errorHandler(w, r, err)
+				return
+			}
+		}
+
+		result := &Result{Evidence: evidence, Results: results}
+		next.ServeHTTP(w, r.WithContext(NewContext(r.Context(), result)))
+	})
+}
+
+// serveCached calls the next handler with the cached result for the evidence,
+// performing detection and caching the result if there is none.
+func (m *Middleware) serveCached(
+	w http.ResponseWriter,
+	r *http.Request,
+	next http.Handler,
+	evidence []onpremise.Evidence) {
+	// Clear results of a previous data file if the manager has been reloaded
+	generation := m.cache.Validate(dd.GetPublishedDate(m.manager))
+	key := common.NewResultCacheKey(evidence, m.manager.HttpHeaderKeys)
+	cached, ok := m.cache.Get(key)
+	if !ok {
+		results, err := m.detect(r, evidence)
+		if err != nil {
+			m.errorHandler(w, r, err)
+			return
+		}
+		cached, err = common.NewCachedResult(
+			m.manager, results, m.cacheProperties)
+		results.Free()
+		if err != nil {
+			m.errorHandler(w, r, err)
+			return
+		}
+		m.cache.Add(key, generation, cached)
+	}
+
+	if m.setResponseHeaders {
+		setClientHintsHeaders(w, cached.ResponseHeaders, m.criticalHints)
+	}
+
+	result := &Result{Evidence: evidence, Cached: cached}
+	next.ServeHTTP(w, r.WithContext(NewContext(r.Context(), result)))
+}
+
+// detect performs detection for the request and records it in the metrics.
+func (m *Middleware) detect(
+	r *http.Request,
+	evidence []onpremise.Evidence) (*dd.ResultsHash, error) {
+	start := time.Now()
+	results, err := DetectContext(r.Context(), m.tracer, m.manager, evidence)
+	if err != nil {
+		if m.metrics != nil {
+			m.metrics.ObserveError()
+		}
+		return nil, err
+	}
+	if m.metrics != nil {
+		m.metrics.ObserveDetection(results, time.Since(start))
+	}
+	return results, nil
+}
+
+// ExtractEvidence looks into a list of required evidence keys and extracts
+// them from a http request. Keys without a value in the request are omitted.
+func ExtractEvidence(
+	r *http.Request,
+	keys []dd.EvidenceKey) []onpremise.Evidence {
+	evidence := make([]onpremise.Evidence, 0, len(keys))
+	query := r.URL.Query()
+	for _, k := range keys {
+		name := strings.TrimPrefix(k.Key, upperHeaderPrefix)
+		var value string
+		switch k.Prefix {
+		case dd.HttpEvidenceQuery:
+			// Get evidence from query parameter
+			value = query.Get(strings.ToLower(name))
+		case dd.HttpEvidenceCookie:
+			// Get evidence from cookies
+			if c, err := r.Cookie(name); err == nil {
+				value = c.Value
+			}
+		default:
+			// Get evidence from headers
+			value = r.Header.Get(name)
+		}
+		if value != "" {
+			evidence = append(evidence, onpremise.Evidence{
+				Prefix: k.Prefix,
+				Key:    k.Key,
+				Value:  value,
+			})
+		}
+	}
+	return evidence
+}
+
+// Detect performs detection on the evidence using the manager. The caller is
+// responsible for freeing the returned results.
+func Detect(
+	manager *dd.ResourceManager,
+	evidence []onpremise.Evidence) (*dd.ResultsHash, error) {
+	return DetectContext(context.Background(), nil, manager, evidence)
+}
+
+// DetectContext is Detect with the detection performed by the tracer in a
+// span which is a child of any span in the context. The tracer can be nil to
+// disable tracing.
+func DetectContext(
+	ctx context.Context,
+	tracer *common.Tracer,
+	manager *dd.ResourceManager,
+	evidence []onpremise.Evidence) (*dd.ResultsHash, error) {
+	evidenceHash := dd.NewEvidenceHash(uint32(len(evidence)))
+	// Make sure evidence is freed at the end
+	defer evidenceHash.Free()
+	for _, e := range evidence {
+		if err := evidenceHash.Add(e.Prefix, e.Key, e.Value); err != nil {
+			return nil, fmt.Errorf("failed to add evidence: %w", err)
+		}
+	}
+
+	results := dd.NewResultsHash(manager, uint32(evidenceHash.Count()), 0)
+	if err := tracer.MatchEvidence(ctx, results, evidenceHash); err != nil {
+		results.Free()
+		return nil, fmt.Errorf("failed to match evidence: %w", err)
+	}
+	return results, nil
+}
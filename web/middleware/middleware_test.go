@@ -0,0 +1,290 @@
+/* *********************************************************************
+ * This Original Work is copyright of 51 Degrees Mobile Experts Limited.
+ * Copyright 2019 51 Degrees Mobile Experts Limited, 5 Charlotte Close,
+ * Caversham, Reading, Berkshire, United Kingdom RG4 7BY.
+ *
+ * This Original Work is licensed under the European Union Public Licence (EUPL)
+ * v.1.2 and is subject to its terms as set out below.
+ *
+ * If a copy of the EUPL was not distributed with this file, You can obtain
+ * one at https://opensource.org/licenses/EUPL-1.2.
+ *
+ * The 'Compatible Licences' set out in the Appendix to the EUPL (as may be
+ * amended by the European Commission) shall be deemed incompatible for
+ * the purposes of the Work and the provisions of the compatibility
+ * clause in Article 5 of the EUPL shall not apply.
+ *
+ * If using the Work as, or as part of, a network application, by
+ * including the attribution notice(s) required under Article 5 of the EUPL
+ * in the end user terms of the application under an appropriate heading,
+ * such notice(s) shall fulfill the requirements of that article.
+ * ********************************************************************* */
+
+package middleware
+
+import (
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/51Degrees/device-detection-examples-go/v4/onpremise/common"
+	"github.com/51Degrees/device-detection-examples-go/v4/web/clienthintstest"
+	"github.com/51Degrees/device-detection-examples-go/v4/web/metrics"
+	"github.com/51Degrees/device-detection-go/v4/dd"
+	"github.com/51Degrees/device-detection-go/v4/onpremise"
+)
+
+var manager *dd.ResourceManager
+
+// Test User Agents
+const chromeUA = "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/95.0.4638.69 Safari/537.36"
+const safariUA = "Mozilla/5.0 (iPhone; CPU iPhone OS 7_1 like Mac OS X) AppleWebKit/537.51.2 (KHTML, like Gecko) Version/7.0 Mobile/11D167 Safari/9537.53"
+
+func TestMain(m *testing.M) {
+	// Initialise manager
+	manager = dd.NewResourceManager()
+	config := dd.NewConfigHash(dd.Balanced)
+	config.SetUseUpperPrefixHeaders(false)
+	dataFiles := []string{"51Degrees-LiteV4.1.hash"}
+	filePath, err := dd.GetFilePath("../..", dataFiles)
+	if err != nil {
+		log.Fatalf("Cannot find file that matches any of \"%s\".\n",
+			strings.Join(dataFiles, ", "))
+	}
+
+	err = dd.InitManagerFromFile(
+		manager,
+		*config,
+		"",
+		filePath)
+	if err != nil {
+		log.Fatalln("ERROR: Failed to initialize resource manager.")
+	}
+
+	// Execute the test
+	code := m.Run()
+
+	// Make sure manager object will be freed after the function execution
+	manager.Free()
+	os.Exit(code)
+}
+
+// Test if evidence is extracted from headers, query parameters and cookies.
+func TestExtractEvidence(t *testing.T) {
+	r := httptest.NewRequest("GET", "/?sec-ch-ua-model=Pixel", nil)
+	r.Header.Set("User-Agent", chromeUA)
+	r.AddCookie(&http.Cookie{Name: "Sec-CH-UA-Platform", Value: "Android"})
+
+	keys := []dd.EvidenceKey{
+		{Prefix: dd.HttpHeaderString, Key: "HTTP_User-Agent"},
+		{Prefix: dd.HttpEvidenceQuery, Key: "Sec-CH-UA-Model"},
+		{Prefix: dd.HttpEvidenceCookie, Key: "Sec-CH-UA-Platform"},
+		{Prefix: dd.HttpHeaderString, Key: "Sec-CH-UA-Mobile"},
+	}
+	evidence := ExtractEvidence(r, keys)
+	if len(evidence) != 3 {
+		t.Fatalf("Expected 3 evidence but got %d", len(evidence))
+	}
+
+	expected := []string{chromeUA, "Pixel", "Android"}
+	for i, e := range evidence {
+		if e.Key != keys[i].Key || e.Prefix != keys[i].Prefix {
+			t.Errorf("Expected key '%s' but got '%s'", keys[i].Key, e.Key)
+		}
+		if e.Value != expected[i] {
+			t.Errorf("Expected value '%s' but got '%s'", expected[i], e.Value)
+		}
+	}
+}
+
+// Test if the middleware stores the result in the context and sets the
+// Accept-CH header.
+func TestHandler(t *testing.T) {
+	testData := []struct {
+		ua              string
+		responseHeaders bool
+		browserName     string
+		acceptCH        bool
+	}{
+		{chromeUA, true, "Chrome", true},
+		{chromeUA, false, "Chrome", false},
+		{safariUA, true, "Mobile Safari", false},
+	}
+
+	for _, data := range testData {
+		var browserName string
+		next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			result, ok := FromContext(r.Context())
+			if !ok {
+				t.Fatalf("Expected detection result in request context")
+			}
+			value, hasValues, err := result.Value("BrowserName")
+			if err != nil || !hasValues {
+				t.Fatalf("Expected BrowserName value but got error '%v'", err)
+			}
+			browserName = value
+		})
+
+		r := httptest.NewRequest("GET", "/", nil)
+		r.Header.Set("User-Agent", data.ua)
+		rr := httptest.NewRecorder()
+		New(manager, WithResponseHeaders(data.responseHeaders)).
+			Handler(next).
+			ServeHTTP(rr, r)
+
+		if rr.Code != http.StatusOK {
+			t.Errorf("Expected status code %d but got %d",
+				http.StatusOK, rr.Code)
+		}
+		if browserName != data.browserName {
+			t.Errorf("Expected BrowserName '%s' but got '%s'",
+				data.browserName, browserName)
+		}
+		if acceptCH := rr.Header().Get("Accept-CH") != ""; acceptCH != data.acceptCH {
+			t.Errorf("Expected Accept-CH set to be %t for '%s' but got '%s'",
+				data.acceptCH, data.ua, rr.Header().Get("Accept-CH"))
+		}
+	}
+}
+
+// Test if detections performed by the handler are recorded in the metrics.
+func TestHandlerMetrics(t *testing.T) {
+	m := metrics.New()
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	for i := 0; i < 2; i++ {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.Header.Set("User-Agent", chromeUA)
+		New(manager, WithMetrics(m)).
+			Handler(next).
+			ServeHTTP(httptest.NewRecorder(), r)
+	}
+
+	var b strings.Builder
+	if err := m.Write(&b); err != nil {
+		t.Fatalf("Failed to write metrics. %v", err)
+	}
+	if !strings.Contains(b.String(), "device_detection_duration_seconds_count 2\n") {
+		t.Errorf("Expected 2 detections to be recorded but got:\n%s", b.String())
+	}
+}
+
+// Client hints sent by Chrome on Windows with chromeUA
+var chromeHints = map[string]string{
+	"Sec-CH-UA":                  `" Not A;Brand";v="99", "Chromium";v="95", "Google Chrome";v="95"`,
+	"Sec-CH-UA-Mobile":           "?0",
+	"Sec-CH-UA-Platform":         `"Windows"`,
+	"Sec-CH-UA-Platform-Version": `"14.0.0"`,
+	"Sec-CH-UA-Model":            `""`,
+}
+
+// Test if a browser honouring Accept-CH and Critical-CH retries the first
+// request with the critical hints, so that every detection uses them.
+func TestHandlerClientHints(t *testing.T) {
+	var used []onpremise.Evidence
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if result, ok := FromContext(r.Context()); ok {
+			used = result.Evidence
+		}
+	})
+	client := clienthintstest.NewClient(New(manager).Handler(next), chromeUA, chromeHints)
+
+	// The first navigation is retried, the second is not
+	for _, expectedRequests := range []int{2, 3} {
+		rr := client.Get("/")
+		if len(client.Requests) != expectedRequests {
+			t.Fatalf("Expected %d requests but got %d",
+				expectedRequests, len(client.Requests))
+		}
+		critical := common.SplitHeaderList(rr.Header().Get("Critical-CH"))
+		vary := common.SplitHeaderList(rr.Header().Get("Vary"))
+		if !common.ContainsFold(vary, "User-Agent") {
+			t.Errorf("Expected Vary to contain User-Agent but got %v", vary)
+		}
+		for _, hint := range DefaultCriticalHints {
+			if !common.ContainsFold(critical, hint) {
+				t.Errorf("Expected Critical-CH to contain '%s' but got %v", hint, critical)
+			}
+			if !common.ContainsFold(vary, hint) {
+				t.Errorf("Expected Vary to contain '%s' but got %v", hint, vary)
+			}
+			found := false
+			for _, e := range used {
+				found = found || strings.EqualFold(e.Key, hint)
+			}
+			if !found {
+				t.Errorf("Expected detection to use '%s' but got %v", hint, used)
+			}
+		}
+	}
+}
+
+// Test if repeated evidence is served from the result cache with the same
+// values and response headers, and without performing detection again.
+func TestHandlerResultCache(t *testing.T) {
+	m := metrics.New()
+	cache := common.NewResultCache(10)
+	var browsers []string
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		result, ok := FromContext(r.Context())
+		if !ok {
+			t.Fatalf("Expected detection result in request context")
+		}
+		value, _, err := result.Value("BrowserName")
+		if err != nil {
+			t.Fatalf("Failed to get BrowserName. %v", err)
+		}
+		browsers = append(browsers, value)
+	})
+	handler := New(manager, WithMetrics(m), WithResultCache(cache, "BrowserName")).
+		Handler(next)
+
+	var acceptCH []string
+	for _, ua := range []string{chromeUA, chromeUA, safariUA} {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.Header.Set("User-Agent", ua)
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, r)
+		acceptCH = append(acceptCH, rr.Header().Get("Accept-CH"))
+	}
+
+	if browsers[0] != "Chrome" || browsers[1] != "Chrome" ||
+		browsers[2] != "Mobile Safari" {
+		t.Errorf("Expected Chrome, Chrome and Mobile Safari but got %v", browsers)
+	}
+	if acceptCH[0] == "" || acceptCH[1] != acceptCH[0] {
+		t.Errorf("Expected cached Accept-CH '%s' but got '%s'",
+			acceptCH[0], acceptCH[1])
+	}
+	stats := cache.Stats()
+	if stats.Hits != 1 || stats.Misses != 2 || stats.Entries != 2 {
+		t.Errorf("Expected 1 hit, 2 misses and 2 entries but got %+v", stats)
+	}
+	var b strings.Builder
+	if err := m.Write(&b); err != nil {
+		t.Fatalf("Failed to write metrics. %v", err)
+	}
+	if !strings.Contains(b.String(), "device_detection_duration_seconds_count 2\n") {
+		t.Errorf("Expected 2 detections to be recorded but got:\n%s", b.String())
+	}
+}
+
+// Test if Vary values are added once to any existing values.
+func TestAddVary(t *testing.T) {
+	h := make(http.Header)
+	h.Add("Vary", "Accept-Encoding, user-agent")
+	AddVary(h, "User-Agent", "Sec-CH-UA-Model", "Sec-CH-UA-Model")
+	if vary := h.Get("Vary"); vary != "Accept-Encoding, user-agent, Sec-CH-UA-Model" {
+		t.Errorf("Expected merged Vary header but got '%s'", vary)
+	}
+}
+
+// Test if no result is available outside of the middleware.
+func TestFromContextEmpty(t *testing.T) {
+	r := httptest.NewRequest("GET", "/", nil)
+	if _, ok := FromContext(r.Context()); ok {
+		t.Errorf("Expected no detection result in request context")
+	}
+}
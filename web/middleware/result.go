@@ -0,0 +1,75 @@
+/* *********************************************************************
+ * This Original Work is copyright of 51 Degrees Mobile Experts Limited.
+ * Copyright 2019 51 Degrees Mobile Experts Limited, 5 Charlotte Close,
+ * Caversham, Reading, Berkshire, United Kingdom RG4 7BY.
+ *
+ * This Original Work is licensed under the European Union Public Licence (EUPL)
+ * v.1.2 and is subject to its terms as set out below.
+ *
+ * If a copy of the EUPL was not distributed with this file, You can obtain
+ * one at https://opensource.org/licenses/EUPL-1.2.
+ *
+ * The 'Compatible Licences' set out in the Appendix to the EUPL (as may be
+ * amended by the European Commission) shall be deemed incompatible for
+ * the purposes of the Work and the provisions of the compatibility
+ * clause in Article 5 of the EUPL shall not apply.
+ *
+ * If using the Work as, or as part of, a network application, by
+ * including the attribution notice(s) required under Article 5 of the EUPL
+ * in the end user terms of the application under an appropriate heading,
+ * such notice(s) shall fulfill the requirements of that article.
+ * ********************************************************************* */
+
+package middleware
+
+import (
+	"context"
+
+	"github.com/51Degrees/device-detection-examples-go/v4/onpremise/common"
+	"github.com/51Degrees/device-detection-go/v4/dd"
+	"github.com/51Degrees/device-detection-go/v4/onpremise"
+)
+
+// Result is the outcome of the detection performed for a request.
+type Result struct {
+	// Evidence extracted from the request and used for the detection
+	Evidence []onpremise.Evidence
+	// Results of the detection. Only valid until the wrapped handler returns.
+	// Nil when a result cache is used, see WithResultCache.
+	Results *dd.ResultsHash
+	// Property values of the detection when a result cache is used
+	Cached *common.CachedResult
+}
+
+// Value returns the values of a property joined by ','. The returned boolean
+// is false if the property does not have a matched value.
+func (r *Result) Value(property string) (string, bool, error) {
+	if r.Cached != nil {
+		value, ok := r.Cached.Value(property)
+		return value, ok, nil
+	}
+	hasValues, err := r.Results.HasValues(property)
+	if err != nil || !hasValues {
+		return "", false, err
+	}
+
+	value, err := r.Results.ValuesString(property, ",")
+	if err != nil {
+		return "", false, err
+	}
+	return value, true, nil
+}
+
+// Key type for values stored in a context by this package
+type contextKey struct{}
+
+// NewContext returns a copy of the context carrying the result.
+func NewContext(ctx context.Context, result *Result) context.Context {
+	return context.WithValue(ctx, contextKey{}, result)
+}
+
+// FromContext returns the result stored in the context, if any.
+func FromContext(ctx context.Context) (*Result, bool) {
+	result, ok := ctx.Value(contextKey{}).(*Result)
+	return result, ok
+}
@@ -24,7 +24,8 @@ package main
 
 /*
 This example illustrates how to perform device detection on User-Agent extracted
-from web request.
+from web request. Detection is performed by the reusable middleware in the
+`web/middleware` package which can wrap any `http.Handler`.
 
 To run this example, perform the following command:
 ```
@@ -43,15 +44,36 @@ used:
 ```
 curl -A [User-Agent string] localhost:8000
 ```
+
+Detection duration, match metrics and data file reloads are exposed in the
+Prometheus text format at "localhost:8000/metrics". The data file is checked
+for changes every `-reload-interval`, one minute by default, and reloaded when
+it has been replaced. Detections are performed in OpenTelemetry
+spans which are discarded unless a tracer provider is registered with
+otel.SetTracerProvider.
+
+Repeated requests can be served from a cache of the property values rather
+than performing detection again. The cache is enabled by giving its size:
+```
+go run web_integration.go -cache-size 10000
+```
+The cache is cleared when the data file is reloaded. Its hits, misses and
+evictions are exposed in JSON at "localhost:8000/cache".
 */
 
 import (
+	"encoding/json"
+	"flag"
 	"fmt"
 	"html/template"
 	"log"
 	"net/http"
 	"strings"
+	"time"
 
+	"github.com/51Degrees/device-detection-examples-go/v4/onpremise/common"
+	"github.com/51Degrees/device-detection-examples-go/v4/web/metrics"
+	"github.com/51Degrees/device-detection-examples-go/v4/web/middleware"
 	"github.com/51Degrees/device-detection-go/v4/dd"
 )
 
@@ -64,6 +86,18 @@ type Page struct {
 var manager *dd.ResourceManager
 var config *dd.ConfigHash
 
+// Metrics of the detections performed by the middleware
+var detectionMetrics = metrics.New()
+
+// Tracer of the detections performed by the middleware
+var tracer = common.NewTracer(nil)
+
+// Cache of the results of the middleware, nil if disabled
+var resultCache *common.ResultCache
+
+// Properties required for a response page and stored in the result cache
+var pageProperties = []string{"BrowserName", "ScreenPixelsWidth"}
+
 // Template for the response HTML page.
 var templ = `<!DOCTYPE HTML>
 <html>
@@ -77,35 +111,15 @@ var templ = `<!DOCTYPE HTML>
   </body>
 </html>`
 
-// function match performs a match on an input User-Agent string and determine
-// if the device is a mobile device.
-func match(
-	results *dd.ResultsHash,
-	ua string) {
-	// Perform detection
-	err := results.MatchUserAgent(ua)
-	if err != nil {
-		log.Fatalf("ERROR: Failed to perform detection on User-Agent \"%s\".\n", ua)
-	}
-}
-
 // function getValue return a value results for a property
 func getValue(
-	results *dd.ResultsHash,
+	result *middleware.Result,
 	propertyName string) string {
 	// Get the values in string
-	value, err := results.ValuesString(
-		propertyName,
-		",")
-	if err != nil {
-		log.Fatalln("ERROR: Failed to get results values string.")
-	}
-
-	hasValues, err := results.HasValues(propertyName)
+	value, hasValues, err := result.Value(propertyName)
 	if err != nil {
 		log.Fatalf(
-			"ERROR: Failed to check if a matched value exists for property "+
-				"%s.\n", propertyName)
+			"ERROR: Failed to get values for property %s.\n", propertyName)
 	}
 
 	if !hasValues {
@@ -116,18 +130,41 @@ func getValue(
 	return value
 }
 
-// Handler for web request
-func handler(w http.ResponseWriter, r *http.Request) {
-	// Create results
-	results := dd.NewResultsHash(manager, 1, 0)
+// newHandler creates the handler for web requests. Detection is performed by
+// the middleware and the results are obtained from the request context. It
+// must be called once the manager is initialised.
+func newHandler() http.Handler {
+	opts := []middleware.Option{
+		middleware.WithMetrics(detectionMetrics),
+		middleware.WithTracer(tracer),
+	}
+	if resultCache != nil {
+		opts = append(opts,
+			middleware.WithResultCache(resultCache, pageProperties...))
+	}
+	mw := middleware.New(manager, opts...)
+	return mw.Handler(http.HandlerFunc(page))
+}
 
-	// Make sure results object is freed after function execution.
-	defer results.Free()
+// Handler responding with the statistics of the result cache in JSON.
+func cacheHandler(w http.ResponseWriter, r *http.Request) {
+	if resultCache == nil {
+		http.Error(w, "Result cache is disabled.", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resultCache.Stats())
+}
 
-	// Perform detection on mobile User-Agent
-	match(results, r.UserAgent())
-	browserName := getValue(results, "BrowserName")
-	screenPixelWidth := getValue(results, "ScreenPixelsWidth")
+// Page for a web request which has already been through detection
+func page(w http.ResponseWriter, r *http.Request) {
+	result, ok := middleware.FromContext(r.Context())
+	if !ok {
+		log.Fatalln("ERROR: No detection results in request context.")
+	}
+
+	browserName := getValue(result, "BrowserName")
+	screenPixelWidth := getValue(result, "ScreenPixelsWidth")
 	p := &Page{
 		browserName,
 		screenPixelWidth,
@@ -140,6 +177,15 @@ func handler(w http.ResponseWriter, r *http.Request) {
 }
 
 func main() {
+	cacheSize := flag.Int("cache-size", 0,
+		"Number of results to cache, 0 to disable the cache")
+	reloadInterval := flag.Duration("reload-interval", time.Minute,
+		"Interval the data file is checked for changes and reloaded, 0 to disable")
+	flag.Parse()
+	if *cacheSize > 0 {
+		resultCache = common.NewResultCache(*cacheSize)
+	}
+
 	// Initialise manager
 	manager = dd.NewResourceManager()
 	config = dd.NewConfigHash(dd.Balanced)
@@ -164,7 +210,22 @@ func main() {
 	// Make sure manager object will be freed after the function execution
 	defer manager.Free()
 
-	http.HandleFunc("/", handler)
+	// Reload the data file when it is replaced, recording each reload in the
+	// metrics
+	if *reloadInterval > 0 {
+		stop := common.WatchDataFile(filePath, *reloadInterval, func() {
+			err := manager.ReloadFromOriginalFile()
+			if err != nil {
+				log.Printf("ERROR: Failed to reload data file \"%s\". %v\n", filePath, err)
+			}
+			detectionMetrics.ObserveReload(err)
+		})
+		defer stop()
+	}
+
+	http.Handle("/", newHandler())
+	http.Handle("/metrics", detectionMetrics.Handler())
+	http.HandleFunc("/cache", cacheHandler)
 	const port = 8000
 	fmt.Printf("Server listening on port: %d\n", port)
 	log.Fatal(http.ListenAndServe(fmt.Sprintf("localhost:%d", port), nil))
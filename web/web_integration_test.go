@@ -37,6 +37,7 @@ import (
 	"strings"
 	"testing"
 
+	"github.com/51Degrees/device-detection-examples-go/v4/onpremise/common"
 	"github.com/51Degrees/device-detection-go/v4/dd"
 )
 
@@ -97,7 +98,7 @@ func TestHandler(t *testing.T) {
 
 	// Create a ResponseRecorder to capture the response
 	rr := httptest.NewRecorder()
-	h := http.HandlerFunc(handler)
+	h := newHandler()
 
 	// Serve the http request
 	h.ServeHTTP(rr, r)
@@ -122,3 +123,32 @@ func TestHandler(t *testing.T) {
 			"\"\n", exp, act)
 	}
 }
+
+// Test if the handler responds with the same page when the results are
+// served from the result cache.
+func TestHandlerResultCache(t *testing.T) {
+	resultCache = common.NewResultCache(10)
+	defer func() { resultCache = nil }()
+
+	h := newHandler()
+	var bodies []string
+	for i := 0; i < 2; i++ {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.Header.Add(
+			"User-Agent",
+			"Mozilla/5.0 (iPhone; CPU iPhone OS 7_1 like Mac OS X) "+
+				"AppleWebKit/537.51.2 (KHTML, like Gecko) Version/7.0 Mobile/11D167 "+
+				"Safari/9537.53")
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, r)
+		bodies = append(bodies, rr.Body.String())
+	}
+
+	if !strings.Contains(bodies[0], "Mobile Safari") || bodies[1] != bodies[0] {
+		t.Errorf("Expected the same page for a cached result but got:\n"+
+			"%s\n%s", bodies[0], bodies[1])
+	}
+	if stats := resultCache.Stats(); stats.Hits != 1 || stats.Misses != 1 {
+		t.Errorf("Expected 1 hit and 1 miss but got %+v", stats)
+	}
+}